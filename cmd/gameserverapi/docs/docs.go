@@ -290,6 +290,47 @@ const docTemplate = `{
                 }
             }
         },
+        "/gameserverbuilds/{namespace}/{buildName}/resetcrashes": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "reset the crashes of a GameServerBuild by buildName and namespace, so it becomes Healthy again and its crash backoff ends",
+                "operationId": "reset-gameserverbuild-crashes-by-buildname-and-namespace",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "buildNameParam",
+                        "name": "buildName",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespaceParam",
+                        "name": "namespace",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/v1alpha1.GameServerBuild"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
         "/gameserverbuilds/{namespace}/{gameServerDetailName}": {
             "get": {
                 "produces": [
@@ -438,6 +479,50 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/gameservers/{namespace}/{gameServerName}/terminate": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "mark GameServer for termination by GameServerName and namespace",
+                "operationId": "terminate-gameserver-by-gameservername-and-namespace",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "gameServerNameParam",
+                        "name": "gameServerName",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespaceParam",
+                        "name": "namespace",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            }
         }
     },
     "definitions": {
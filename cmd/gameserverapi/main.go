@@ -12,6 +12,7 @@ import (
 	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -123,9 +124,11 @@ func setupRouter() *gin.Engine {
 	r.GET(fmt.Sprintf("%s/gameserverbuilds/:namespace/:buildName", urlprefix), getGameServerBuild)
 	r.DELETE(fmt.Sprintf("%s/gameserverbuilds/:namespace/:buildName", urlprefix), deleteGameServerBuild)
 	r.GET(fmt.Sprintf("%s/gameserverbuilds/:namespace/:buildName/gameservers", urlprefix), listGameServersForBuild)
+	r.POST(fmt.Sprintf("%s/gameserverbuilds/:namespace/:buildName/resetcrashes", urlprefix), resetGameServerBuildCrashes)
 	r.GET(fmt.Sprintf("%s/gameservers", urlprefix), listGameServers)
 	r.GET(fmt.Sprintf("%s/gameservers/:namespace/:gameServerName", urlprefix), getGameServer)
 	r.DELETE(fmt.Sprintf("%s/gameservers/:namespace/:gameServerName", urlprefix), deleteGameServer)
+	r.POST(fmt.Sprintf("%s/gameservers/:namespace/:gameServerName/terminate", urlprefix), terminateGameServer)
 	r.PATCH(fmt.Sprintf("%s/gameserverbuilds/:namespace/:buildName", urlprefix), patchGameServerBuild)
 	r.GET(fmt.Sprintf("%s/gameserverbuilds/:namespace/:buildName/gameserverdetails", urlprefix), listGameServerDetailsForBuild)
 	r.GET(fmt.Sprintf("%s/gameserverdetails/:namespace/:gameServerDetailName", urlprefix), getGameServerDetail)
@@ -296,6 +299,79 @@ func deleteGameServer(c *gin.Context) {
 	}
 }
 
+// @Summary mark GameServer for termination by GameServerName and namespace
+// @ID terminate-gameserver-by-gameservername-and-namespace
+// @Produce json
+// @Param gameServerName path string true "gameServerNameParam"
+// @Param namespace path string true "namespaceParam"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /gameservers/{namespace}/{gameServerName}/terminate [post]
+func terminateGameServer(c *gin.Context) {
+	var gs mpsv1alpha1.GameServer
+	err := kubeClient.Get(ctx, client.ObjectKey{Name: c.Param(gameServerNameParam), Namespace: c.Param(namespaceParam)}, &gs)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	// the game server process is asked to terminate by the NodeAgent and the GameServer is deleted by the controller if it does not exit in time
+	if gs.Status.TerminationRequestedOn == nil {
+		patch := client.MergeFrom(gs.DeepCopy())
+		now := metav1.Now()
+		gs.Status.TerminationRequestedOn = &now
+		if err := kubeClient.Status().Patch(ctx, &gs, patch); err != nil {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Game server marked for termination"})
+}
+
+// @Summary reset the crashes of a GameServerBuild by buildName and namespace, so it becomes Healthy again and its crash backoff ends
+// @ID reset-gameserverbuild-crashes-by-buildname-and-namespace
+// @Produce json
+// @Param buildName path string true "buildNameParam"
+// @Param namespace path string true "namespaceParam"
+// @Success 200 {object} mpsv1alpha1.GameServerBuild
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /gameserverbuilds/{namespace}/{buildName}/resetcrashes [post]
+func resetGameServerBuildCrashes(c *gin.Context) {
+	var gsb mpsv1alpha1.GameServerBuild
+	err := kubeClient.Get(ctx, client.ObjectKey{Name: c.Param(buildNameParam), Namespace: c.Param(namespaceParam)}, &gsb)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	// the controller resumes the reconciliation of the GameServerBuild once it is Healthy
+	// and creates GameServers again once the backoff after the process crashes has ended
+	patch := client.MergeFrom(gsb.DeepCopy())
+	gsb.Status.CrashesCount = 0
+	gsb.Status.RecentCrashes = nil
+	gsb.Status.RecentProcessCrashes = nil
+	gsb.Status.CrashBackoffSeconds = 0
+	gsb.Status.CrashBackoffEndTime = nil
+	gsb.Status.Health = mpsv1alpha1.BuildHealthy
+	if err := kubeClient.Status().Patch(ctx, &gsb, patch); err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gsb)
+}
+
 // @Summary patch GameServerBuild by buildName and namespace
 // @ID path-gameserverbuild-by-buildname-and-namespace
 // @Produce json
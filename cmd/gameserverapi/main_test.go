@@ -13,8 +13,10 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
@@ -315,6 +317,64 @@ var _ = Describe("GameServer API service tests", func() {
 		defer res.Body.Close()
 		Expect(res.StatusCode).To(Equal(http.StatusNotFound))
 	})
+	It("should reset the crashes of a GameServerBuild", func() {
+		var crashed mpsv1alpha1.GameServerBuild
+		Expect(kubeClient.Get(ctx, client.ObjectKey{Name: "test-build", Namespace: testNamespace}, &crashed)).To(Succeed())
+		patch := client.MergeFrom(crashed.DeepCopy())
+		now := metav1.Now()
+		crashed.Status.RecentCrashes = []metav1.Time{now}
+		crashed.Status.RecentProcessCrashes = []metav1.Time{now}
+		crashed.Status.CrashBackoffSeconds = 60
+		crashed.Status.CrashBackoffEndTime = &now
+		Expect(kubeClient.Status().Patch(ctx, &crashed, patch)).To(Succeed())
+		r := setupRouter()
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("%s/gameserverbuilds/%s/test-build/resetcrashes", url, testNamespace), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var gsb mpsv1alpha1.GameServerBuild
+		err := kubeClient.Get(ctx, client.ObjectKey{Name: "test-build", Namespace: testNamespace}, &gsb)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gsb.Status.CrashesCount).To(Equal(0))
+		Expect(gsb.Status.RecentCrashes).To(BeEmpty())
+		Expect(gsb.Status.RecentProcessCrashes).To(BeEmpty())
+		Expect(gsb.Status.CrashBackoffSeconds).To(BeZero())
+		Expect(gsb.Status.CrashBackoffEndTime).To(BeNil())
+		Expect(gsb.Status.Health).To(Equal(mpsv1alpha1.BuildHealthy))
+	})
+	It("should return 404 when resetting the crashes of non-existent GameServerBuild", func() {
+		r := setupRouter()
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("%s/gameserverbuilds/%s/non-existent-build/resetcrashes", url, testNamespace), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+	})
+	It("should mark a GameServer for termination", func() {
+		r := setupRouter()
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("%s/gameservers/%s/test-gameserver/terminate", url, testNamespace), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var gs mpsv1alpha1.GameServer
+		err := kubeClient.Get(ctx, client.ObjectKey{Name: "test-gameserver", Namespace: testNamespace}, &gs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gs.Status.TerminationRequestedOn).ToNot(BeNil())
+	})
+	It("should return 404 when terminating non-existent GameServer", func() {
+		r := setupRouter()
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("%s/gameservers/%s/non-existent-server/terminate", url, testNamespace), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+	})
 	It("should delete a GameServer", func() {
 		r := setupRouter()
 		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("%s/gameservers/%s/test-gameserver", url, testNamespace), nil)
@@ -379,6 +439,11 @@ var _ = BeforeSuite(func() {
 			Name:      "test-build",
 			Namespace: testNamespace,
 		},
+		Status: mpsv1alpha1.GameServerBuildStatus{
+			CrashesCount:  3,
+			RecentCrashes: []metav1.Time{metav1.Now(), metav1.Now(), metav1.Now()},
+			Health:        mpsv1alpha1.BuildUnhealthy,
+		},
 	}
 
 	testGameServer := &mpsv1alpha1.GameServer{
@@ -404,7 +469,7 @@ var _ = BeforeSuite(func() {
 	err := mpsv1alpha1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
-	clientBuilder := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(testBuild, testGameServer, testGameServerDetail)
+	clientBuilder := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(testBuild, testGameServer, testGameServerDetail).WithStatusSubresource(testGameServer, testBuild)
 
 	kubeClient = clientBuilder.Build()
 	Expect(kubeClient).NotTo(BeNil())
@@ -59,6 +59,7 @@ type NodeAgentManager struct {
 	nowFunc                   func() time.Time
 	heartbeatTimeout          int64 // timeouts for not receiving a heartbeat in milliseconds
 	firstHeartbeatTimeout     int64 // the first heartbeat gets a longer window considering initialization time
+	heartbeatPublishInterval  int64 // how often the last heartbeat times are published on the Node in milliseconds, zero disables publishing
 }
 
 func NewNodeAgentManager(dynamicClient dynamic.Interface, nodeName string, logEveryHeartbeat bool, ignoreHealthFromHeartbeat bool, now func() time.Time, withHeartbeatTimeChecker bool) *NodeAgentManager {
@@ -74,8 +75,12 @@ func NewNodeAgentManager(dynamicClient dynamic.Interface, nodeName string, logEv
 	n.runWatch()
 	n.firstHeartbeatTimeout = ParseInt64FromEnv("FIRST_HEARTBEAT_TIMEOUT", 60000)
 	n.heartbeatTimeout = ParseInt64FromEnv("HEARTBEAT_TIMEOUT", 5000)
+	n.heartbeatPublishInterval = ParseInt64FromEnv("HEARTBEAT_PUBLISH_INTERVAL", 0)
 	if withHeartbeatTimeChecker {
 		n.runHeartbeatTimeCheckerLoop()
+		if n.heartbeatPublishInterval > 0 {
+			n.runHeartbeatPublisherLoop()
+		}
 	}
 	return n
 }
@@ -147,6 +152,58 @@ func (n *NodeAgentManager) HeartbeatTimeChecker() {
 	})
 }
 
+// runHeartbeatPublisherLoop runs publishHeartbeats on an infinite loop
+func (n *NodeAgentManager) runHeartbeatPublisherLoop() {
+	go func() {
+		for {
+			if err := n.publishHeartbeats(); err != nil {
+				log.Errorf("publishing heartbeats on Node %s: %s", n.nodeName, err.Error())
+			}
+			time.Sleep(time.Duration(n.heartbeatPublishInterval) * time.Millisecond)
+		}
+	}()
+}
+
+// publishHeartbeats patches the annotation of this Node with the last heartbeat times of the GameServers in the local gameServerMap
+// the allocation API service uses them to skip GameServers that have stopped heartbeating but have not been marked as Unhealthy yet
+// GameServers that have never sent a heartbeat are not included
+func (n *NodeAgentManager) publishHeartbeats() error {
+	heartbeats := mpsv1alpha1.NodeHeartbeats{
+		PublishedAt: n.nowFunc().UnixMilli(),
+		GameServers: make(map[string]int64),
+	}
+	n.gameServerMap.Range(func(key interface{}, value interface{}) bool {
+		gsi := value.(*GameServerInfo)
+		gsi.Mutex.RLock()
+		if gsi.LastHeartbeatTime != 0 {
+			heartbeats.GameServers[gsi.GameServerNamespace+"/"+key.(string)] = gsi.LastHeartbeatTime
+		}
+		gsi.Mutex.RUnlock()
+		return true
+	})
+	heartbeatsBytes, err := json.Marshal(heartbeats)
+	if err != nil {
+		return err
+	}
+	u := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]interface{}{
+					mpsv1alpha1.NodeHeartbeatsAnnotation: string(heartbeatsBytes),
+				},
+			},
+		},
+	}
+	payloadBytes, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), time.Second*defaultTimeout)
+	defer cancel()
+	_, err = n.dynamicClient.Resource(nodeGVR).Patch(ctxWithTimeout, n.nodeName, types.MergePatchType, payloadBytes, metav1.PatchOptions{})
+	return err
+}
+
 // markGameServerUnhealthy sends a patch to mark the GameServer, described by its name
 // and namespace, as Unhealthy
 func (n *NodeAgentManager) markGameServerUnhealthy(gameServerName, gameServerNamespace string, state HeartbeatState) error {
@@ -243,6 +300,17 @@ func (n *NodeAgentManager) gameServerCreatedOrUpdated(obj *unstructured.Unstruct
 
 	}
 
+	// the GameServer was marked for termination, the game server process will be asked to terminate on its next heartbeat
+	if parseTerminationRequested(obj) {
+		gsd := gsdi.(*GameServerInfo)
+		gsd.Mutex.Lock()
+		if !gsd.TerminationRequested {
+			logger.Infof("GameServer %s/%s was marked for termination", gameServerNamespace, gameServerName)
+			gsd.TerminationRequested = true
+		}
+		gsd.Mutex.Unlock()
+	}
+
 	// we only care to continue if the state is Active and the GameServer is healthy
 	if gameServerState != string(GameStateActive) || gameServerHealth != string(mpsv1alpha1.GameServerHealthy) {
 		logger.Debugf("skipping create/update handler since GameServer %s/%s has state %s and health %s", gameServerNamespace, gameServerName, gameServerState, gameServerHealth)
@@ -250,19 +318,31 @@ func (n *NodeAgentManager) gameServerCreatedOrUpdated(obj *unstructured.Unstruct
 	}
 
 	// server is Active, so get session details as well initial players details
-	sessionID, sessionCookie, initialPlayers := parseSessionDetails(obj, gameServerName, gameServerNamespace)
+	sessionID, sessionCookie, initialPlayers, sessionMetadata := parseSessionDetails(obj, gameServerName, gameServerNamespace)
 	// sessionCookie:<valueOfCookie> string is looked for in the e2e tests, be careful not to modify it!
-	logger.Infof("getting values from allocation - GameServer CR, sessionID:%s, sessionCookie:%s, initialPlayers: %v", sessionID, sessionCookie, initialPlayers)
+	logger.Infof("getting values from allocation - GameServer CR, sessionID:%s, sessionCookie:%s, initialPlayers: %v, sessionMetadata: %v", sessionID, sessionCookie, initialPlayers, sessionMetadata)
+
+	// get a reference to the GameServerDetails instance for this GameServer
+	gsd := gsdi.(*GameServerInfo)
+
+	// the game server process might have released this session before the operator cleared it from the GameServer CR
+	// in this case, the event is stale and the session must not be activated again
+	reuseCount := parseReuseCount(obj)
+	gsd.Mutex.RLock()
+	released := reuseCount < gsd.MinReuseCount
+	gsd.Mutex.RUnlock()
+	if released {
+		logger.Debugf("skipping create/update handler since the session %s of GameServer %s/%s was already released", sessionID, gameServerNamespace, gameServerName)
+		return
+	}
 
 	// create the GameServerDetails CR
+	// it already exists if the game server was released back to StandingBy after a previous session
 	err = n.createGameServerDetails(ctx, obj.GetUID(), gameServerName, gameServerNamespace, gameServerBuildName, nil)
-	if err != nil {
+	if err != nil && !apierrors.IsAlreadyExists(err) {
 		logger.Errorf("error creating GameServerDetails: %s", err.Error())
 	}
 
-	// get a reference to the GameServerDetails instance for this GameServer
-	gsd := gsdi.(*GameServerInfo)
-
 	// we are setting the current state to 1 and the previous to zero (if exists)
 	// in this way, we can add all the "1"s together to get a total number of GameServers in a specific state
 	GameServerStates.WithLabelValues(gameServerName, gameServerState).Set(1)
@@ -275,9 +355,16 @@ func (n *NodeAgentManager) gameServerCreatedOrUpdated(obj *unstructured.Unstruct
 	// we mark the server as allocated plus add session details
 	// we're locking the mutex so the heartbeat handler method won't read this data at the same time
 	gsd.IsActive = true
+	gsd.ReuseCount = reuseCount
+	// the game server process will be asked to release the session on its next heartbeat
+	if parseReleaseRequested(obj) && !gsd.ReleaseRequested {
+		logger.Infof("The release of the session %s of GameServer %s/%s was requested", sessionID, gameServerNamespace, gameServerName)
+		gsd.ReleaseRequested = true
+	}
 	gsd.SessionCookie = sessionCookie
 	gsd.SessionID = sessionID
 	gsd.InitialPlayers = initialPlayers
+	gsd.SessionMetadata = sessionMetadata
 }
 
 // gameServerDeleted is called when a GameServer CR is deleted
@@ -341,8 +428,8 @@ func (n *NodeAgentManager) metricsHandler(w http.ResponseWriter, r *http.Request
 
 // heartbeatHandler is the http handler handling heartbeats from the GameServer Pods running on this Node
 // it responds by sending instructions/signal for the next operation
-// on Thundernetes, the only operation that NodeAgent can signal to the GameServer is that the GameServer has been allocated (its state has transitioned to Active)
-// when it's allocated, it will return an "Active" operation
+// on Thundernetes, the NodeAgent can signal to the GameServer that it has been allocated (its state has transitioned to Active), that the release of its session was requested or that it has been marked for termination
+// when it's allocated, it will return an "Active" operation, when its release was requested a "Release" operation and when it's marked for termination it will return a "Terminate" operation
 // in all other cases, it will return "Continue" (which basically means continue doing what you are already doing)
 func (n *NodeAgentManager) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
@@ -406,11 +493,14 @@ func (n *NodeAgentManager) heartbeatHandler(w http.ResponseWriter, r *http.Reque
 	gsd.Mutex.RLock()
 	// check if the game server is active
 	isActive := gsd.IsActive
+	terminationRequested := gsd.TerminationRequested
+	releaseRequested := gsd.ReleaseRequested
 	// get the session details (if any)
 	sc := &SessionConfig{
 		SessionId:      gsd.SessionID,
 		SessionCookie:  gsd.SessionCookie,
 		InitialPlayers: gsd.InitialPlayers,
+		Metadata:       gsd.SessionMetadata,
 	}
 	gsd.Mutex.RUnlock()
 
@@ -422,6 +512,16 @@ func (n *NodeAgentManager) heartbeatHandler(w http.ResponseWriter, r *http.Reque
 		logger.Debugf("GameServer %s is transitioning to Active", gameServerName)
 		operation = GameOperationActive
 	}
+	// the release of the session was requested, the game server process should report StandingBy when it is ready for the next one
+	if hb.CurrentGameState == GameStateActive && releaseRequested {
+		logger.Debugf("GameServer %s is asked to release its session", gameServerName)
+		operation = GameOperationRelease
+	}
+	// the GameServer was marked for termination, this takes precedence over any other operation
+	if terminationRequested {
+		logger.Debugf("GameServer %s is asked to terminate", gameServerName)
+		operation = GameOperationTerminate
+	}
 
 	// prepare the heartbeat response
 	// this includes the current designated operation as well as any session configuration
@@ -513,6 +613,12 @@ func (n *NodeAgentManager) updateHealthAndStateIfNeeded(ctx context.Context, hb
 
 	gsd.Mutex.Lock()
 	defer gsd.Mutex.Unlock()
+	// the game server process finished its session and is ready for the next one
+	// the operator will clear the session details from the GameServer CR and put it back in the allocation queue
+	if gsd.PreviousGameState == GameStateActive && hb.CurrentGameState == GameStateStandingBy {
+		logger.Infof("GameServer %s was released back to StandingBy, resetting session details", gameServerName)
+		gsd.resetSession()
+	}
 	gsd.PreviousGameHealth = hb.CurrentGameHealth
 	gsd.PreviousGameState = hb.CurrentGameState
 
@@ -522,40 +628,40 @@ func (n *NodeAgentManager) updateHealthAndStateIfNeeded(ctx context.Context, hb
 // updateConnectedPlayersIfNeeded updates the connected players of the GameServerDetail CR if it has changed
 func (n *NodeAgentManager) updateConnectedPlayersIfNeeded(ctx context.Context, hb *HeartbeatRequest, gameServerName string, gsd *GameServerInfo) error {
 	logger := getLogger(gameServerName, gsd.GameServerNamespace)
-	// we're not interested in updating the connected players count if the game is not active or if the player population has not changed
-	if hb.CurrentGameState != GameStateActive || gsd.ConnectedPlayersCount == len(hb.CurrentPlayers) {
+	// a game server that is not Active has no connected players, so they are reset when it is released back to StandingBy
+	currentPlayers := hb.CurrentPlayers
+	if hb.CurrentGameState != GameStateActive {
+		currentPlayers = nil
+	}
+	// we're not interested in updating the connected players count if the player population has not changed
+	if gsd.ConnectedPlayersCount == len(currentPlayers) {
 		return nil
 	}
 
-	connectedPlayersCount := len(hb.CurrentPlayers)
+	connectedPlayersCount := len(currentPlayers)
 
 	// set the prometheus gauge
 	ConnectedPlayersGauge.WithLabelValues(gsd.GameServerNamespace, gameServerName, gsd.BuildName).Set(float64(connectedPlayersCount))
 
 	currentPlayerIDs := make([]string, connectedPlayersCount)
-	for i := 0; i < len(hb.CurrentPlayers); i++ {
-		currentPlayerIDs[i] = hb.CurrentPlayers[i].PlayerId
+	for i := 0; i < len(currentPlayers); i++ {
+		currentPlayerIDs[i] = currentPlayers[i].PlayerId
 	}
-	logger.Infof("ConnectedPlayersCount is different than before, updating. Old connectedPlayersCount: %d, new connectedPlayersCount: %d", gsd.ConnectedPlayersCount, len(hb.CurrentPlayers))
+	logger.Infof("ConnectedPlayersCount is different than before, updating. Old connectedPlayersCount: %d, new connectedPlayersCount: %d", gsd.ConnectedPlayersCount, len(currentPlayers))
 
-	gsdPatchSpec := mpsv1alpha1.GameServerDetailSpec{}
-	if connectedPlayersCount == 0 {
-		gsdPatchSpec.ConnectedPlayersCount = 0
-		gsdPatchSpec.ConnectedPlayers = make([]string, 0)
-	} else {
-		gsdPatchSpec.ConnectedPlayersCount = connectedPlayersCount
-		gsdPatchSpec.ConnectedPlayers = currentPlayerIDs
-	}
-
-	// the reason we're using unstructured to serialize the GameServerDetailSpec instead of the GameServerDetail object
+	// the reason we're using unstructured to serialize the spec instead of the GameServerDetail object
 	// is that we don't want extra fields (.Status, .ObjectMeta) to be serialized
+	// the fields are set explicitly since the omitempty tags of GameServerDetailSpec would drop them when there are no connected players
 	u := &unstructured.Unstructured{
 		Object: map[string]interface{}{
-			"spec": gsdPatchSpec,
+			"spec": map[string]interface{}{
+				"connectedPlayersCount": connectedPlayersCount,
+				"connectedPlayers":      currentPlayerIDs,
+			},
 		},
 	}
 
-	// this will be marshaled as fmt.Sprintf("{\"spec\":{\"connectedPlayersCount\":%d,\"connectedPlayers\":[\"%s\"]}}", len(hb.CurrentPlayers), strings.Join(currentPlayerIDs, "\",\""))
+	// this will be marshaled as fmt.Sprintf("{\"spec\":{\"connectedPlayersCount\":%d,\"connectedPlayers\":[\"%s\"]}}", len(currentPlayers), strings.Join(currentPlayerIDs, "\",\""))
 	payloadBytes, err := json.Marshal(u)
 	if err != nil {
 		return err
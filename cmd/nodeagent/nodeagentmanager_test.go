@@ -188,6 +188,127 @@ var _ = Describe("nodeagent tests", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(hbr.Operation).To(Equal(GameOperationContinue))
 	})
+	It("should reset the session when an Active game server transitions back to StandingBy", FlakeAttempts(numberOfAttemps), func() {
+		dynamicClient := newDynamicInterface()
+
+		n := NewNodeAgentManager(dynamicClient, testNodeName, false, false, time.Now, true)
+		gs := createUnstructuredTestGameServer(testGameServerName, testGameServerNamespace)
+		gs.Object["status"].(map[string]interface{})["state"] = "Active"
+		gs.Object["status"].(map[string]interface{})["health"] = "Healthy"
+		gs.Object["status"].(map[string]interface{})["sessionID"] = "testSessionID"
+
+		_, err := dynamicClient.Resource(gameserverGVR).Namespace(testGameServerNamespace).Create(context.Background(), gs, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		// wait for the create trigger on the watch
+		var gsinfo interface{}
+		Eventually(func() bool {
+			var ok bool
+			gsinfo, ok = n.gameServerMap.Load(testGameServerName)
+			if !ok {
+				return false
+			}
+			gsinfo.(*GameServerInfo).Mutex.RLock()
+			defer gsinfo.(*GameServerInfo).Mutex.RUnlock()
+			return gsinfo.(*GameServerInfo).IsActive
+		}).Should(BeTrue())
+
+		// wait till the GameServerDetail CR has been created
+		Eventually(func(g Gomega) {
+			_, err := dynamicClient.Resource(gameserverDetailGVR).Namespace(testGameServerNamespace).Get(context.Background(), gs.GetName(), metav1.GetOptions{})
+			g.Expect(err).ToNot(HaveOccurred())
+		}).Should(Succeed())
+
+		_, err = dynamicClient.Resource(gameserverDetailGVR).Namespace(testGameServerNamespace).Patch(context.Background(), testGameServerName, types.MergePatchType,
+			[]byte(`{"spec":{"connectedPlayersCount":2,"connectedPlayers":["player1","player2"]}}`), metav1.PatchOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		// simulate previous heartbeats by GSDK, with two connected players
+		gsinfo.(*GameServerInfo).Mutex.Lock()
+		gsinfo.(*GameServerInfo).PreviousGameState = GameStateActive
+		gsinfo.(*GameServerInfo).PreviousGameHealth = "Healthy"
+		gsinfo.(*GameServerInfo).ConnectedPlayersCount = 2
+		gsinfo.(*GameServerInfo).Mutex.Unlock()
+
+		// the game server process finished its session and is ready for the next one
+		hb := &HeartbeatRequest{
+			CurrentGameState:  GameStateStandingBy,
+			CurrentGameHealth: "Healthy",
+		}
+		b, _ := json.Marshal(hb)
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/sessionHosts/%s", testGameServerName), bytes.NewReader(b))
+		w := httptest.NewRecorder()
+		n.heartbeatHandler(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		hbr := HeartbeatResponse{}
+		Expect(json.NewDecoder(res.Body).Decode(&hbr)).To(Succeed())
+		Expect(hbr.Operation).To(Equal(GameOperationContinue))
+		Expect(hbr.SessionConfig.SessionId).To(BeEmpty())
+
+		gsinfo.(*GameServerInfo).Mutex.RLock()
+		Expect(gsinfo.(*GameServerInfo).IsActive).To(BeFalse())
+		Expect(gsinfo.(*GameServerInfo).SessionID).To(BeEmpty())
+		Expect(gsinfo.(*GameServerInfo).ConnectedPlayersCount).To(BeZero())
+		gsinfo.(*GameServerInfo).Mutex.RUnlock()
+
+		// the connected players of the GameServerDetail CR should be reset
+		gsdu, err := dynamicClient.Resource(gameserverDetailGVR).Namespace(testGameServerNamespace).Get(context.Background(), testGameServerName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		connectedPlayersCount, _, err := unstructured.NestedInt64(gsdu.Object, "spec", "connectedPlayersCount")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connectedPlayersCount).To(BeZero())
+		connectedPlayers, _, err := unstructured.NestedStringSlice(gsdu.Object, "spec", "connectedPlayers")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connectedPlayers).To(BeEmpty())
+
+		// the state of the GameServer CR should be StandingBy
+		u, err := dynamicClient.Resource(gameserverGVR).Namespace(testGameServerNamespace).Get(context.Background(), testGameServerName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		state, _, err := parseStateHealth(u)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).To(Equal(string(GameStateStandingBy)))
+	})
+	It("should signal the game server process to terminate when the GameServer is marked for termination", FlakeAttempts(numberOfAttemps), func() {
+		dynamicClient := newDynamicInterface()
+
+		n := NewNodeAgentManager(dynamicClient, testNodeName, false, false, time.Now, true)
+		gs := createUnstructuredTestGameServer(testGameServerName, testGameServerNamespace)
+		gs.Object["status"].(map[string]interface{})["state"] = "Active"
+		gs.Object["status"].(map[string]interface{})["health"] = "Healthy"
+		gs.Object["status"].(map[string]interface{})["sessionID"] = "testSessionID"
+		gs.Object["status"].(map[string]interface{})["terminationRequestedOn"] = "2022-06-01T10:00:00Z"
+
+		_, err := dynamicClient.Resource(gameserverGVR).Namespace(testGameServerNamespace).Create(context.Background(), gs, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		// wait for the create trigger on the watch
+		Eventually(func() bool {
+			gsinfo, ok := n.gameServerMap.Load(testGameServerName)
+			if !ok {
+				return false
+			}
+			gsinfo.(*GameServerInfo).Mutex.RLock()
+			defer gsinfo.(*GameServerInfo).Mutex.RUnlock()
+			return gsinfo.(*GameServerInfo).TerminationRequested
+		}).Should(BeTrue())
+
+		hb := &HeartbeatRequest{
+			CurrentGameState:  GameStateActive,
+			CurrentGameHealth: "Healthy",
+		}
+		b, _ := json.Marshal(hb)
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/sessionHosts/%s", testGameServerName), bytes.NewReader(b))
+		w := httptest.NewRecorder()
+		n.heartbeatHandler(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		hbr := HeartbeatResponse{}
+		Expect(json.NewDecoder(res.Body).Decode(&hbr)).To(Succeed())
+		Expect(hbr.Operation).To(Equal(GameOperationTerminate))
+	})
 	It("should not create a GameServerDetail if the server is not Active", FlakeAttempts(numberOfAttemps), func() {
 		dynamicClient := newDynamicInterface()
 
@@ -497,6 +618,7 @@ var _ = Describe("nodeagent tests", func() {
 				gs.Object["status"].(map[string]interface{})["health"] = "Healthy"
 				gs.Object["status"].(map[string]interface{})["sessionCookie"] = "cookie123"
 				gs.Object["status"].(map[string]interface{})["initialPlayers"] = []interface{}{"player1", "player2"}
+				gs.Object["status"].(map[string]interface{})["sessionMetadata"] = map[string]interface{}{"map": "dust"}
 				_, err = dynamicClient.Resource(gameserverGVR).Namespace(testGameServerNamespace).Update(context.Background(), gs, metav1.UpdateOptions{})
 				Expect(err).ToNot(HaveOccurred())
 
@@ -538,6 +660,8 @@ var _ = Describe("nodeagent tests", func() {
 				hbr := HeartbeatResponse{}
 				_ = json.Unmarshal(resBody, &hbr)
 				Expect(hbr.Operation).To(Equal(GameOperationActive))
+				Expect(hbr.SessionConfig.InitialPlayers).To(Equal([]string{"player1", "player2"}))
+				Expect(hbr.SessionConfig.Metadata).To(Equal(map[string]string{"map": "dust"}))
 
 				// next heartbeat response should be continue
 				hb = &HeartbeatRequest{
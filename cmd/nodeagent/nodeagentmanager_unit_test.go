@@ -16,6 +16,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/fake"
@@ -449,6 +450,94 @@ func TestUnitGameServerCreatedOrUpdated_ActiveHealthyTriggersSessionDetails(t *t
 	assert.Equal(t, testGameServerName, u.GetName())
 }
 
+func TestUnitGameServerCreatedOrUpdated_StaleActiveAfterRelease(t *testing.T) {
+	dynamicClient := newDynamicInterfaceWithDetails()
+	n := newTestNodeAgentManager(dynamicClient)
+
+	gs := createUnstructuredTestGameServer(testGameServerName, testGameServerNamespace)
+	_, err := dynamicClient.Resource(gameserverGVR).Namespace(testGameServerNamespace).Create(context.Background(), gs, metav1.CreateOptions{})
+	require.NoError(t, err)
+	gs.Object["status"].(map[string]interface{})["state"] = "Active"
+	gs.Object["status"].(map[string]interface{})["health"] = "Healthy"
+	gs.Object["status"].(map[string]interface{})["sessionID"] = "session-123"
+	n.gameServerCreatedOrUpdated(gs)
+
+	// the game server process releases the session
+	val, ok := n.gameServerMap.Load(testGameServerName)
+	require.True(t, ok)
+	gsi := val.(*GameServerInfo)
+	gsi.PreviousGameState = GameStateActive
+	gsi.PreviousGameHealth = "Healthy"
+	_, hbr, _ := sendHeartbeat(t, n, testGameServerName, &HeartbeatRequest{
+		CurrentGameState:  GameStateStandingBy,
+		CurrentGameHealth: "Healthy",
+	})
+	assert.Equal(t, GameOperationContinue, hbr.Operation)
+
+	// an Active event of the released session, from before the operator cleared it, is ignored
+	n.gameServerCreatedOrUpdated(gs)
+	gsi.Mutex.RLock()
+	assert.False(t, gsi.IsActive)
+	assert.Empty(t, gsi.SessionID)
+	gsi.Mutex.RUnlock()
+	_, hbr, _ = sendHeartbeat(t, n, testGameServerName, &HeartbeatRequest{
+		CurrentGameState:  GameStateStandingBy,
+		CurrentGameHealth: "Healthy",
+	})
+	assert.Equal(t, GameOperationContinue, hbr.Operation)
+
+	// the next session is activated
+	gs.Object["status"].(map[string]interface{})["sessionID"] = "session-456"
+	gs.Object["status"].(map[string]interface{})["reuseCount"] = int64(1)
+	n.gameServerCreatedOrUpdated(gs)
+	gsi.Mutex.RLock()
+	assert.True(t, gsi.IsActive)
+	assert.Equal(t, "session-456", gsi.SessionID)
+	gsi.Mutex.RUnlock()
+}
+
+func TestUnitHeartbeatHandler_ReleaseRequested(t *testing.T) {
+	dynamicClient := newDynamicInterfaceWithDetails()
+	n := newTestNodeAgentManager(dynamicClient)
+
+	gs := createUnstructuredTestGameServer(testGameServerName, testGameServerNamespace)
+	_, err := dynamicClient.Resource(gameserverGVR).Namespace(testGameServerNamespace).Create(context.Background(), gs, metav1.CreateOptions{})
+	require.NoError(t, err)
+	gs.Object["status"].(map[string]interface{})["state"] = "Active"
+	gs.Object["status"].(map[string]interface{})["health"] = "Healthy"
+	gs.Object["status"].(map[string]interface{})["sessionID"] = "session-123"
+	n.gameServerCreatedOrUpdated(gs)
+	val, ok := n.gameServerMap.Load(testGameServerName)
+	require.True(t, ok)
+	gsi := val.(*GameServerInfo)
+	gsi.PreviousGameState = GameStateActive
+	gsi.PreviousGameHealth = "Healthy"
+
+	active := &HeartbeatRequest{CurrentGameState: GameStateActive, CurrentGameHealth: "Healthy"}
+	_, hbr, _ := sendHeartbeat(t, n, testGameServerName, active)
+	assert.Equal(t, GameOperationContinue, hbr.Operation)
+
+	// the release is requested through the allocation API service
+	gs.Object["status"].(map[string]interface{})["releaseRequestedOn"] = "2026-01-01T00:00:00Z"
+	n.gameServerCreatedOrUpdated(gs)
+	_, hbr, _ = sendHeartbeat(t, n, testGameServerName, active)
+	assert.Equal(t, GameOperationRelease, hbr.Operation)
+	assert.Equal(t, "session-123", hbr.SessionConfig.SessionId)
+
+	// the game server process releases the session
+	_, hbr, _ = sendHeartbeat(t, n, testGameServerName, &HeartbeatRequest{CurrentGameState: GameStateStandingBy, CurrentGameHealth: "Healthy"})
+	assert.Equal(t, GameOperationContinue, hbr.Operation)
+	gsi.Mutex.RLock()
+	assert.False(t, gsi.ReleaseRequested)
+	gsi.Mutex.RUnlock()
+
+	// an Active event from before the operator cleared the session does not request the release again
+	n.gameServerCreatedOrUpdated(gs)
+	gsi.Mutex.RLock()
+	assert.False(t, gsi.ReleaseRequested)
+	gsi.Mutex.RUnlock()
+}
+
 // ---------- gameServerDeleted tests ----------
 
 func TestUnitGameServerDeleted_RemovesFromMap(t *testing.T) {
@@ -866,3 +955,40 @@ func TestUnitHeartbeatTimeChecker_TableDriven(t *testing.T) {
 		})
 	}
 }
+
+// ---------- publishHeartbeats tests ----------
+
+func TestUnitPublishHeartbeats(t *testing.T) {
+	baseTime := time.Now()
+	dynamicClient := newDynamicInterface()
+	n := newTestNodeAgentManager(dynamicClient, func(n *NodeAgentManager) {
+		n.nowFunc = func() time.Time { return baseTime }
+	})
+	node := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Node",
+		"metadata":   map[string]interface{}{"name": testNodeName},
+	}}
+	_, err := dynamicClient.Resource(nodeGVR).Create(context.Background(), node, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	n.gameServerMap.Store(testGameServerName, &GameServerInfo{
+		GameServerNamespace: testGameServerNamespace,
+		LastHeartbeatTime:   baseTime.Add(-time.Second).UnixMilli(),
+		Mutex:               &sync.RWMutex{},
+	})
+	// GameServers that have never sent a heartbeat are not published
+	n.gameServerMap.Store("initializing", &GameServerInfo{
+		GameServerNamespace: testGameServerNamespace,
+		Mutex:               &sync.RWMutex{},
+	})
+
+	require.NoError(t, n.publishHeartbeats())
+
+	u, err := dynamicClient.Resource(nodeGVR).Get(context.Background(), testNodeName, metav1.GetOptions{})
+	require.NoError(t, err)
+	var heartbeats mpsv1alpha1.NodeHeartbeats
+	require.NoError(t, json.Unmarshal([]byte(u.GetAnnotations()[mpsv1alpha1.NodeHeartbeatsAnnotation]), &heartbeats))
+	assert.Equal(t, baseTime.UnixMilli(), heartbeats.PublishedAt)
+	assert.Equal(t, map[string]int64{testGameServerNamespace + "/" + testGameServerName: baseTime.Add(-time.Second).UnixMilli()}, heartbeats.GameServers)
+}
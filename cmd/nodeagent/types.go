@@ -21,6 +21,12 @@ var (
 		Version:  "v1alpha1",
 		Resource: "gameserverdetails",
 	}
+
+	nodeGVR = schema.GroupVersionResource{
+		Group:    "",
+		Version:  "v1",
+		Resource: "nodes",
+	}
 )
 
 // GameState represents the current state of the game.
@@ -44,6 +50,8 @@ const (
 	GameOperationContinue  GameOperation = "Continue"
 	GameOperationActive    GameOperation = "Active"
 	GameOperationTerminate GameOperation = "Terminate"
+	// GameOperationRelease asks the game server process to release its session and report StandingBy when it is ready for the next one
+	GameOperationRelease GameOperation = "Release"
 )
 
 var (
@@ -122,6 +130,7 @@ type GameServerInfo struct {
 	SessionID             string
 	SessionCookie         string
 	InitialPlayers        []string
+	SessionMetadata       map[string]string
 	PreviousGameState     GameState // the GameState on the previous heartbeat
 	PreviousGameHealth    string    // the GameHealth on the previous heartbeat
 	GameServerNamespace   string
@@ -132,4 +141,21 @@ type GameServerInfo struct {
 	LastHeartbeatTime     int64     // time since the nodeagent received a heartbeat from this GameServer
 	MarkedUnhealthy       bool      // if the GameServer was marked unhealthy by a heartbeat condition, used to avoid repeating the patch
 	BuildName             string    // the name of the GameServerBuild that this GameServer belongs to
+	TerminationRequested  bool      // the GameServer was marked for termination, so the game server process is asked to terminate
+	ReuseCount            int64     // the reuseCount of the GameServer when its current session was activated
+	MinReuseCount         int64     // Active events with a lower reuseCount belong to a session that was already released, so they are ignored
+	ReleaseRequested      bool      // the release of the session was requested, so the game server process is asked to release it
+}
+
+// resetSession clears the session details, it is called when the GameServer is released back to StandingBy
+// caller should hold the mutex
+func (gsi *GameServerInfo) resetSession() {
+	gsi.IsActive = false
+	gsi.ReleaseRequested = false
+	// the operator increments the reuseCount when it clears the session from the GameServer CR
+	gsi.MinReuseCount = gsi.ReuseCount + 1
+	gsi.SessionID = ""
+	gsi.SessionCookie = ""
+	gsi.InitialPlayers = nil
+	gsi.SessionMetadata = nil
 }
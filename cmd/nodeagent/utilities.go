@@ -80,6 +80,7 @@ func initializeKubernetesClient() (dynamic.Interface, error) {
 // transition from "" to Initializing and StandingBy is valid
 // transition from Initializing to StandingBy is valid
 // transition from StandingBy to Active is valid
+// transition from Active to StandingBy is valid, it happens when a reusable game server is ready for its next session
 func isValidStateTransition(old, new GameState) bool {
 	if old == "" && new == GameStateInitializing {
 		return true
@@ -93,6 +94,9 @@ func isValidStateTransition(old, new GameState) bool {
 	if old == GameStateStandingBy && new == GameStateActive {
 		return true
 	}
+	if old == GameStateActive && new == GameStateStandingBy {
+		return true
+	}
 	if old == new {
 		return true
 	}
@@ -111,12 +115,14 @@ func sanitize(s string) string {
 	return strings.Replace(s2, "\r", "", -1)
 }
 
-// parseSessionDetails returns the sessionID and sessionCookie from the unstructured GameServer CR
-func parseSessionDetails(u *unstructured.Unstructured, gameServerName, gameServerNamespace string) (string, string, []string) {
+// parseSessionDetails returns the sessionID, sessionCookie, initialPlayers and sessionMetadata from the unstructured GameServer CR
+func parseSessionDetails(u *unstructured.Unstructured, gameServerName, gameServerNamespace string) (string, string, []string, map[string]string) {
 	logger := getLogger(gameServerName, gameServerNamespace)
 	sessionID, sessionIDExists, sessionIDErr := unstructured.NestedString(u.Object, "status", "sessionID")
 	sessionCookie, sessionCookieExists, sessionCookieErr := unstructured.NestedString(u.Object, "status", "sessionCookie")
 	initialPlayers, initialPlayersExists, initialPlayersErr := unstructured.NestedStringSlice(u.Object, "status", "initialPlayers")
+	// sessionMetadata is optional, so we don't log if it does not exist
+	sessionMetadata, _, sessionMetadataErr := unstructured.NestedStringMap(u.Object, "status", "sessionMetadata")
 
 	if !sessionIDExists || !sessionCookieExists || !initialPlayersExists {
 		logger.Debugf("sessionID or sessionCookie or initialPlayers do not exist, sessionIDExists: %t, sessionCookieExists: %t, initialPlayersExists: %t", sessionIDExists, sessionCookieExists, initialPlayersExists)
@@ -134,7 +140,29 @@ func parseSessionDetails(u *unstructured.Unstructured, gameServerName, gameServe
 		logger.Debugf("error getting initialPlayers: %s", initialPlayersErr.Error())
 	}
 
-	return sessionID, sessionCookie, initialPlayers
+	if sessionMetadataErr != nil {
+		logger.Debugf("error getting sessionMetadata: %s", sessionMetadataErr.Error())
+	}
+
+	return sessionID, sessionCookie, initialPlayers, sessionMetadata
+}
+
+// parseReuseCount returns the number of times the GameServer was released back to StandingBy, zero if it was never released
+func parseReuseCount(u *unstructured.Unstructured) int64 {
+	reuseCount, _, _ := unstructured.NestedInt64(u.Object, "status", "reuseCount")
+	return reuseCount
+}
+
+// parseReleaseRequested returns true if the release of the session of the GameServer has been requested
+func parseReleaseRequested(u *unstructured.Unstructured) bool {
+	_, exists, err := unstructured.NestedString(u.Object, "status", "releaseRequestedOn")
+	return exists && err == nil
+}
+
+// parseTerminationRequested returns true if the GameServer has been marked for termination
+func parseTerminationRequested(u *unstructured.Unstructured) bool {
+	_, exists, err := unstructured.NestedString(u.Object, "status", "terminationRequestedOn")
+	return exists && err == nil
 }
 
 // parseStateHealth parses the GameServer state and health from the unstructured GameServer CR.
@@ -159,7 +159,7 @@ func TestIsValidStateTransition(t *testing.T) {
 		{"same state Initializing", GameStateInitializing, GameStateInitializing, true},
 		{"same state StandingBy", GameStateStandingBy, GameStateStandingBy, true},
 		{"same state Active", GameStateActive, GameStateActive, true},
-		{"Active to StandingBy invalid", GameStateActive, GameStateStandingBy, false},
+		{"Active to StandingBy (reusable game server)", GameStateActive, GameStateStandingBy, true},
 		{"StandingBy to Initializing invalid", GameStateStandingBy, GameStateInitializing, false},
 		{"Active to Initializing invalid", GameStateActive, GameStateInitializing, false},
 		{"Initializing to Active invalid (skip StandingBy)", GameStateInitializing, GameStateActive, false},
@@ -227,6 +227,7 @@ func TestParseSessionDetails(t *testing.T) {
 		expectedSessionID     string
 		expectedSessionCookie string
 		expectedPlayers       []string
+		expectedMetadata      map[string]string
 	}{
 		{
 			name: "all fields present",
@@ -235,11 +236,16 @@ func TestParseSessionDetails(t *testing.T) {
 					"sessionID":      "session-123",
 					"sessionCookie":  "cookie-abc",
 					"initialPlayers": []interface{}{"player1", "player2"},
+					"sessionMetadata": map[string]interface{}{
+						"map":  "dust",
+						"mode": "ctf",
+					},
 				},
 			},
 			expectedSessionID:     "session-123",
 			expectedSessionCookie: "cookie-abc",
 			expectedPlayers:       []string{"player1", "player2"},
+			expectedMetadata:      map[string]string{"map": "dust", "mode": "ctf"},
 		},
 		{
 			name: "missing session fields",
@@ -275,10 +281,11 @@ func TestParseSessionDetails(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			u := &unstructured.Unstructured{Object: tt.obj}
-			sessionID, sessionCookie, initialPlayers := parseSessionDetails(u, "test-gs", "test-ns")
+			sessionID, sessionCookie, initialPlayers, sessionMetadata := parseSessionDetails(u, "test-gs", "test-ns")
 			assert.Equal(t, tt.expectedSessionID, sessionID)
 			assert.Equal(t, tt.expectedSessionCookie, sessionCookie)
 			assert.Equal(t, tt.expectedPlayers, initialPlayers)
+			assert.Equal(t, tt.expectedMetadata, sessionMetadata)
 		})
 	}
 }
@@ -0,0 +1,207 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: api/allocation/v1/allocation.proto
+
+package allocationv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	AllocationService_Allocate_FullMethodName      = "/thundernetes.allocation.v1.AllocationService/Allocate"
+	AllocationService_BatchAllocate_FullMethodName = "/thundernetes.allocation.v1.AllocationService/BatchAllocate"
+	AllocationService_GetSession_FullMethodName    = "/thundernetes.allocation.v1.AllocationService/GetSession"
+)
+
+// AllocationServiceClient is the client API for AllocationService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// AllocationService allocates GameServers, it offers the same functionality as the HTTP allocation API service
+type AllocationServiceClient interface {
+	// Allocate allocates a StandingBy GameServer for a new game session
+	Allocate(ctx context.Context, in *AllocateRequest, opts ...grpc.CallOption) (*AllocateResponse, error)
+	// BatchAllocate allocates multiple GameServers, each allocation is processed independently
+	BatchAllocate(ctx context.Context, in *BatchAllocateRequest, opts ...grpc.CallOption) (*BatchAllocateResponse, error)
+	// GetSession returns the details of the GameServer that hosts a game session
+	GetSession(ctx context.Context, in *GetSessionRequest, opts ...grpc.CallOption) (*GetSessionResponse, error)
+}
+
+type allocationServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAllocationServiceClient(cc grpc.ClientConnInterface) AllocationServiceClient {
+	return &allocationServiceClient{cc}
+}
+
+func (c *allocationServiceClient) Allocate(ctx context.Context, in *AllocateRequest, opts ...grpc.CallOption) (*AllocateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AllocateResponse)
+	err := c.cc.Invoke(ctx, AllocationService_Allocate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *allocationServiceClient) BatchAllocate(ctx context.Context, in *BatchAllocateRequest, opts ...grpc.CallOption) (*BatchAllocateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchAllocateResponse)
+	err := c.cc.Invoke(ctx, AllocationService_BatchAllocate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *allocationServiceClient) GetSession(ctx context.Context, in *GetSessionRequest, opts ...grpc.CallOption) (*GetSessionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetSessionResponse)
+	err := c.cc.Invoke(ctx, AllocationService_GetSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AllocationServiceServer is the server API for AllocationService service.
+// All implementations must embed UnimplementedAllocationServiceServer
+// for forward compatibility.
+//
+// AllocationService allocates GameServers, it offers the same functionality as the HTTP allocation API service
+type AllocationServiceServer interface {
+	// Allocate allocates a StandingBy GameServer for a new game session
+	Allocate(context.Context, *AllocateRequest) (*AllocateResponse, error)
+	// BatchAllocate allocates multiple GameServers, each allocation is processed independently
+	BatchAllocate(context.Context, *BatchAllocateRequest) (*BatchAllocateResponse, error)
+	// GetSession returns the details of the GameServer that hosts a game session
+	GetSession(context.Context, *GetSessionRequest) (*GetSessionResponse, error)
+	mustEmbedUnimplementedAllocationServiceServer()
+}
+
+// UnimplementedAllocationServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAllocationServiceServer struct{}
+
+func (UnimplementedAllocationServiceServer) Allocate(context.Context, *AllocateRequest) (*AllocateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Allocate not implemented")
+}
+func (UnimplementedAllocationServiceServer) BatchAllocate(context.Context, *BatchAllocateRequest) (*BatchAllocateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchAllocate not implemented")
+}
+func (UnimplementedAllocationServiceServer) GetSession(context.Context, *GetSessionRequest) (*GetSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSession not implemented")
+}
+func (UnimplementedAllocationServiceServer) mustEmbedUnimplementedAllocationServiceServer() {}
+func (UnimplementedAllocationServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafeAllocationServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AllocationServiceServer will
+// result in compilation errors.
+type UnsafeAllocationServiceServer interface {
+	mustEmbedUnimplementedAllocationServiceServer()
+}
+
+func RegisterAllocationServiceServer(s grpc.ServiceRegistrar, srv AllocationServiceServer) {
+	// If the following call pancis, it indicates UnimplementedAllocationServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&AllocationService_ServiceDesc, srv)
+}
+
+func _AllocationService_Allocate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AllocateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AllocationServiceServer).Allocate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AllocationService_Allocate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AllocationServiceServer).Allocate(ctx, req.(*AllocateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AllocationService_BatchAllocate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchAllocateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AllocationServiceServer).BatchAllocate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AllocationService_BatchAllocate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AllocationServiceServer).BatchAllocate(ctx, req.(*BatchAllocateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AllocationService_GetSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AllocationServiceServer).GetSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AllocationService_GetSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AllocationServiceServer).GetSession(ctx, req.(*GetSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AllocationService_ServiceDesc is the grpc.ServiceDesc for AllocationService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AllocationService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "thundernetes.allocation.v1.AllocationService",
+	HandlerType: (*AllocationServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Allocate",
+			Handler:    _AllocationService_Allocate_Handler,
+		},
+		{
+			MethodName: "BatchAllocate",
+			Handler:    _AllocationService_BatchAllocate_Handler,
+		},
+		{
+			MethodName: "GetSession",
+			Handler:    _AllocationService_GetSession_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "api/allocation/v1/allocation.proto",
+}
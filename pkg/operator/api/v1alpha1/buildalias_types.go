@@ -0,0 +1,75 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BuildAliasSpec defines the desired state of BuildAlias
+type BuildAliasSpec struct {
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Format=uuid
+	// AliasID is the ID that can be used instead of a BuildID during allocation
+	AliasID string `json:"aliasID"`
+
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:MinItems=1
+	// Builds is the list of GameServerBuilds this BuildAlias points to
+	Builds []BuildAliasTarget `json:"builds"`
+}
+
+// BuildAliasTarget is a GameServerBuild that a BuildAlias points to
+type BuildAliasTarget struct {
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Format=uuid
+	// BuildID is the BuildID of the GameServerBuild
+	BuildID string `json:"buildID"`
+
+	//+kubebuilder:validation:Minimum=0
+	// Weight is the relative weight used to pick this GameServerBuild among the ones with the same priority, zero means that it is only used as a fallback
+	Weight int `json:"weight,omitempty"`
+
+	//+kubebuilder:validation:Minimum=0
+	// Priority is the order in which GameServerBuilds are tried, lower values are tried first
+	Priority int `json:"priority,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:singular=buildalias,path=buildaliases,scope=Namespaced,shortName=ba
+//+kubebuilder:printcolumn:name="AliasID",type=string,JSONPath=`.spec.aliasID`
+
+// BuildAlias is the Schema for the buildaliases API
+type BuildAlias struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BuildAliasSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BuildAliasList contains a list of BuildAlias
+type BuildAliasList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BuildAlias `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BuildAlias{}, &BuildAliasList{})
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// NodeHeartbeatsAnnotation is the annotation on a Node where the NodeAgent publishes the last heartbeat times
+// of the GameServers on that Node, its value is a NodeHeartbeats object in JSON
+const NodeHeartbeatsAnnotation = "mps.playfab.com/gameserver-heartbeats"
+
+// +kubebuilder:object:generate=false
+// NodeHeartbeats contains the last heartbeat times of the GameServers on a Node, as published by the NodeAgent
+type NodeHeartbeats struct {
+	// PublishedAt is the time the NodeAgent published this object, in Unix milliseconds
+	PublishedAt int64 `json:"publishedAt"`
+	// GameServers contains the time of the last heartbeat of each GameServer that has sent one, in Unix milliseconds
+	// key to the map is namespace/name of the GameServer
+	GameServers map[string]int64 `json:"gameServers"`
+}
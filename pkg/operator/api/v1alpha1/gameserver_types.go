@@ -25,13 +25,14 @@ import (
 // GameServerHealth describes the health of the game server
 type GameServerHealth string
 
-// +kubebuilder:validation:Enum=Initializing;Active;StandingBy;Crashed;GameCompleted
+// +kubebuilder:validation:Enum=Initializing;Active;StandingBy;Reserved;Crashed;GameCompleted
 // GameServerState describes the state of the game server
 type GameServerState string
 
 const (
 	GameServerStateInitializing  GameServerState = "Initializing"
 	GameServerStateStandingBy    GameServerState = "StandingBy"
+	GameServerStateReserved      GameServerState = "Reserved"
 	GameServerStateActive        GameServerState = "Active"
 	GameServerStateCrashed       GameServerState = "Crashed"
 	GameServerStateGameCompleted GameServerState = "GameCompleted"
@@ -90,6 +91,8 @@ type GameServerStatus struct {
 	SessionCookie string `json:"sessionCookie,omitempty"`
 	// InitialPlayers is an optional list of usernames of the initial players that will enter the server. It is used for validation via the game server process
 	InitialPlayers []string `json:"initialPlayers,omitempty"`
+	// SessionMetadata is an optional set of key/value pairs that can be set during allocation. It is passed to the game server process
+	SessionMetadata map[string]string `json:"sessionMetadata,omitempty"`
 	// NodeAge is the age in days of the Node (VM) hosting this game server
 	NodeAge int `json:"nodeAge,omitempty"`
 	// NodeName is the name of the Node (VM) hosting this game server
@@ -97,6 +100,16 @@ type GameServerStatus struct {
 	ReachedInitializingOn *metav1.Time `json:"ReachedInitializingOn,omitempty"`
 	ReachedStandingByOn   *metav1.Time `json:"ReachedStandingByOn,omitempty"`
 	ReachedActiveOn       *metav1.Time `json:"ReachedActiveOn,omitempty"`
+	// ReservedUntil is the time a Reserved game server returns to StandingBy if its reservation has not been confirmed
+	ReservedUntil *metav1.Time `json:"reservedUntil,omitempty"`
+	// ReleaseRequestedOn is the time the release of the session was requested through the allocation API service
+	// the game server process is asked to release it on its next heartbeat
+	ReleaseRequestedOn *metav1.Time `json:"releaseRequestedOn,omitempty"`
+	// ReuseCount is the number of times the game server was released back to StandingBy after hosting a session
+	ReuseCount int `json:"reuseCount,omitempty"`
+	// TerminationRequestedOn is the time the game server was marked for termination
+	// the game server process is asked to terminate and the GameServer is deleted if it has not exited after a grace period
+	TerminationRequestedOn *metav1.Time `json:"terminationRequestedOn,omitempty"`
 }
 
 //+kubebuilder:object:root=true
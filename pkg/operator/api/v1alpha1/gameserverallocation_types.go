@@ -0,0 +1,106 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GameServerAllocationSpec defines the desired state of GameServerAllocation
+type GameServerAllocationSpec struct {
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Format=uuid
+	// BuildID is the BuildID of the GameServerBuild or the AliasID of the BuildAlias to allocate a GameServer from
+	BuildID string `json:"buildID"`
+
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Format=uuid
+	// SessionID is the ID of the game session, it is passed to the game server process
+	SessionID string `json:"sessionID"`
+
+	// SessionCookie is an optional string that is passed to the game server process
+	SessionCookie string `json:"sessionCookie,omitempty"`
+
+	// InitialPlayers is an optional list of the IDs of the players that are expected to connect to the game server
+	InitialPlayers []string `json:"initialPlayers,omitempty"`
+
+	// SessionMetadata is an optional set of key/value pairs that is passed to the game server process
+	SessionMetadata map[string]string `json:"sessionMetadata,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Allocated;Failed
+// GameServerAllocationState describes the result of a GameServerAllocation
+type GameServerAllocationState string
+
+const (
+	GameServerAllocationStateAllocated GameServerAllocationState = "Allocated"
+	GameServerAllocationStateFailed    GameServerAllocationState = "Failed"
+)
+
+// GameServerAllocationStatus defines the observed state of GameServerAllocation
+type GameServerAllocationStatus struct {
+	// State is the result of the allocation, it is empty while the allocation is pending
+	State GameServerAllocationState `json:"state,omitempty"`
+	// GameServerName is the name of the allocated GameServer
+	GameServerName string `json:"gameServerName,omitempty"`
+	// GameServerNamespace is the namespace of the allocated GameServer
+	GameServerNamespace string `json:"gameServerNamespace,omitempty"`
+	// NodeName is the name of the Node the allocated GameServer runs on
+	NodeName string `json:"nodeName,omitempty"`
+	// PublicIP is the public IP of the Node the allocated GameServer runs on
+	PublicIP string `json:"publicIP,omitempty"`
+	// Ports is a concatenated list of the ports of the allocated GameServer, in the same format as the ports of the GameServer status
+	Ports string `json:"ports,omitempty"`
+	// AllocatedOn is the time the GameServer was allocated
+	AllocatedOn *metav1.Time `json:"allocatedOn,omitempty"`
+	// Reason is a short, machine readable reason of a failed allocation, e.g. BuildNotFound
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description of a failed allocation
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=gsa
+//+kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+//+kubebuilder:printcolumn:name="GameServer",type=string,JSONPath=`.status.gameServerName`
+//+kubebuilder:printcolumn:name="PublicIP",type=string,JSONPath=`.status.publicIP`
+//+kubebuilder:printcolumn:name="Ports",type=string,JSONPath=`.status.ports`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.reason`
+
+// GameServerAllocation is the Schema for the gameserverallocations API
+// a GameServerAllocation is fulfilled once, changing its spec after it has been fulfilled has no effect
+type GameServerAllocation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GameServerAllocationSpec   `json:"spec,omitempty"`
+	Status GameServerAllocationStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// GameServerAllocationList contains a list of GameServerAllocation
+type GameServerAllocationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GameServerAllocation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GameServerAllocation{}, &GameServerAllocationList{})
+}
@@ -19,6 +19,7 @@ package v1alpha1
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -34,6 +35,41 @@ const (
 	BuildUnhealthy GameServerBuildHealth = "Unhealthy"
 )
 
+// +kubebuilder:validation:Enum=NodeAge;Packed;Distributed;Weighted
+// AllocationStrategy describes how a StandingBy GameServer is selected during allocation
+type AllocationStrategy string
+
+const (
+	// AllocationStrategyNodeAge prefers GameServers on the newest Nodes
+	AllocationStrategyNodeAge AllocationStrategy = "NodeAge"
+	// AllocationStrategyPacked prefers GameServers on the Nodes with the most Active GameServers
+	AllocationStrategyPacked AllocationStrategy = "Packed"
+	// AllocationStrategyDistributed prefers GameServers on the zones and Nodes with the fewest Active GameServers
+	AllocationStrategyDistributed AllocationStrategy = "Distributed"
+	// AllocationStrategyWeighted scores GameServers using the weights in WeightedAllocation
+	AllocationStrategyWeighted AllocationStrategy = "Weighted"
+)
+
+// +kubebuilder:validation:Enum=Running;Paused;Draining
+// GameServerBuildMode describes whether a GameServerBuild creates GameServers
+type GameServerBuildMode string
+
+const (
+	// BuildModeRunning keeps the requested number of StandingBy GameServers
+	BuildModeRunning GameServerBuildMode = "Running"
+	// BuildModePaused does not create GameServers and keeps the existing ones
+	BuildModePaused GameServerBuildMode = "Paused"
+	// BuildModeDraining deletes the non-Active GameServers, stops allocations and waits for the Active GameServers to end their sessions
+	BuildModeDraining GameServerBuildMode = "Draining"
+)
+
+const (
+	// GameServerBuildFinalizer is the finalizer that makes the deletion of a GameServerBuild wait for its Active GameServers to end their sessions
+	GameServerBuildFinalizer = "mps.playfab.com/active-sessions"
+	// GameServerBuildForceDeleteAnnotation is the annotation that deletes a GameServerBuild without waiting for its Active GameServers, if set to "true"
+	GameServerBuildForceDeleteAnnotation = "mps.playfab.com/force-delete"
+)
+
 // GameServerBuildSpec defines the desired state of GameServerBuild
 type GameServerBuildSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -68,11 +104,39 @@ type GameServerBuildSpec struct {
 	PortsToExpose []int32 `json:"portsToExpose"`
 
 	//+kubebuilder:validation:Minimum=0
-	// CrashesToMarkUnhealthy is the number of crashes needed to mark the build unhealthy
+	// CrashesToMarkUnhealthy is the number of crashes within CrashWindowSeconds needed to mark the build unhealthy
 	CrashesToMarkUnhealthy *int `json:"crashesToMarkUnhealthy,omitempty"`
 
+	//+kubebuilder:validation:Minimum=1
+	// CrashWindowSeconds is the sliding window of the crashes that count towards CrashesToMarkUnhealthy, defaults to 3600
+	// an Unhealthy build becomes Healthy again once it has fewer than CrashesToMarkUnhealthy crashes within the window
+	CrashWindowSeconds int `json:"crashWindowSeconds,omitempty"`
+
 	// BuildMetadata is the metadata for this GameServerBuild
 	BuildMetadata []BuildMetadataItem `json:"buildMetadata,omitempty"`
+
+	// AllocationStrategy is the strategy used to select a StandingBy GameServer during allocation, defaults to NodeAge
+	AllocationStrategy AllocationStrategy `json:"allocationStrategy,omitempty"`
+
+	// WeightedAllocation contains the weights used by the Weighted allocation strategy
+	WeightedAllocation *WeightedAllocation `json:"weightedAllocation,omitempty"`
+
+	// RolloutStrategy configures how the non-Active GameServers are replaced when the Template changes
+	RolloutStrategy *RolloutStrategy `json:"rolloutStrategy,omitempty"`
+
+	// Autoscaling configures the StandingBy number based on the number of Active GameServers, if set StandingBy is ignored
+	Autoscaling *GameServerBuildAutoscaling `json:"autoscaling,omitempty"`
+
+	// Schedules override StandingBy and Max during recurring time windows, if more than one window is active the first schedule in the list is used
+	Schedules []ScalingSchedule `json:"schedules,omitempty"`
+
+	// ExternalScaling configures an HTTP endpoint that decides StandingBy and Max, it cannot be set along with Autoscaling
+	ExternalScaling *ExternalScaling `json:"externalScaling,omitempty"`
+
+	// Mode is Running, Paused or Draining, defaults to Running
+	// a Paused GameServerBuild does not create GameServers and keeps the existing ones, a Draining GameServerBuild deletes its non-Active GameServers,
+	// is not available for allocation and waits for its Active GameServers to end their sessions
+	Mode GameServerBuildMode `json:"mode,omitempty"`
 }
 
 // GameServerBuildStatus defines the observed state of GameServerBuild
@@ -87,10 +151,44 @@ type GameServerBuildStatus struct {
 	CurrentStandingByReadyDesired string `json:"currentStandingByReadyDesired,omitempty"`
 	// CurrentActive is the number of active servers
 	CurrentActive int `json:"currentActive,omitempty"`
+	// CurrentReserved is the number of reserved servers
+	CurrentReserved int `json:"currentReserved,omitempty"`
 	// CrashesCount is the number of crashed servers
 	CrashesCount int `json:"crashesCount,omitempty"`
+	// RecentCrashes contains the times of the crashes within CrashWindowSeconds, oldest first
+	RecentCrashes []metav1.Time `json:"recentCrashes,omitempty"`
+	// RecentProcessCrashes contains the times of the crashes of game server processes within the last CrashBackoffMaxSeconds, oldest first,
+	// GameServers that were marked as Unhealthy are not included since only the processes that crashed back off the creation of GameServers
+	RecentProcessCrashes []metav1.Time `json:"recentProcessCrashes,omitempty"`
+	// CrashBackoffSeconds is the current backoff of the creation of GameServers after the last process crash, it doubles with every recent process crash
+	CrashBackoffSeconds int `json:"crashBackoffSeconds,omitempty"`
+	// CrashBackoffEndTime is the time GameServers will be created again, it is not set if there is no backoff
+	CrashBackoffEndTime *metav1.Time `json:"crashBackoffEndTime,omitempty"`
+	// ReusesCount is the number of times the current game servers were released back to StandingBy after hosting a session
+	ReusesCount int `json:"reusesCount,omitempty"`
 	// Health is the health of the GameServerBuild
 	Health GameServerBuildHealth `json:"health,omitempty"`
+	// TemplateHash is the hash of the current Template, GameServers created from it have the same value in their TemplateHash label
+	TemplateHash string `json:"templateHash,omitempty"`
+	// ObservedGeneration is the generation of the GameServerBuild the status was last updated for
+	// it is used to tell a change of the Template from a change of how its hash is computed
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// UpdatedGameServers is the number of GameServers, in any state, that were created from the current Template
+	UpdatedGameServers int `json:"updatedGameServers,omitempty"`
+	// OutdatedGameServers is the number of non-Active GameServers that were created from a previous Template and are waiting to be replaced
+	OutdatedGameServers int `json:"outdatedGameServers,omitempty"`
+	// EffectiveStandingBy is the number of standingBy servers the controller is keeping, it differs from StandingBy when Autoscaling or ExternalScaling is set or a schedule is active
+	EffectiveStandingBy int `json:"effectiveStandingBy,omitempty"`
+	// LastScaleDownTime is the last time EffectiveStandingBy was decreased by Autoscaling
+	LastScaleDownTime *metav1.Time `json:"lastScaleDownTime,omitempty"`
+	// ActiveSchedule is the name of the schedule whose window is active
+	ActiveSchedule string `json:"activeSchedule,omitempty"`
+	// ActiveScheduleEndTime is the end of the window of the active schedule
+	ActiveScheduleEndTime *metav1.Time `json:"activeScheduleEndTime,omitempty"`
+	// ExternalScaling contains the last decision of the external scaling endpoint
+	ExternalScaling *ExternalScalingStatus `json:"externalScaling,omitempty"`
+	// DrainingComplete is true if the GameServerBuild is Draining and it has no GameServers left
+	DrainingComplete bool `json:"drainingComplete,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -129,3 +227,117 @@ type BuildMetadataItem struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 }
+
+// WeightedAllocation contains the weights used by the Weighted allocation strategy
+// each StandingBy GameServer gets a score and the one with the lowest score is allocated first
+type WeightedAllocation struct {
+	//+kubebuilder:validation:Minimum=0
+	// NodeAgeWeight is multiplied by the Node age in days, so GameServers on newer Nodes are preferred
+	NodeAgeWeight int `json:"nodeAgeWeight,omitempty"`
+	//+kubebuilder:validation:Minimum=0
+	// NodeUtilizationWeight is multiplied by the number of Active GameServers on the Node and subtracted, so busier Nodes are preferred
+	NodeUtilizationWeight int `json:"nodeUtilizationWeight,omitempty"`
+	//+kubebuilder:validation:Minimum=0
+	// ZoneWeight is multiplied by the number of Active GameServers in the zone of the Node, so less busy zones are preferred
+	ZoneWeight int `json:"zoneWeight,omitempty"`
+}
+
+// RolloutStrategy configures how the non-Active GameServers created from a previous Template are replaced
+// Active and Reserved GameServers are never replaced, they are replaced once they are released back to StandingBy
+// values can be an absolute number or a percentage of StandingBy
+type RolloutStrategy struct {
+	// MaxSurge is the maximum number of non-Active GameServers that can be created above StandingBy during a rollout
+	// defaults to 25%, rounded up. Max is never exceeded
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+	// MaxUnavailable is the maximum number of StandingBy GameServers below StandingBy during a rollout
+	// defaults to 25%, rounded down. MaxSurge and MaxUnavailable cannot both be zero
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// GameServerBuildAutoscaling configures the StandingBy number of a GameServerBuild based on the number of its Active GameServers
+// the effective StandingBy is calculated on every reconcile and reported in the status
+type GameServerBuildAutoscaling struct {
+	//+kubebuilder:validation:Required
+	// Buffer configures how many StandingBy GameServers are kept for the Active ones
+	Buffer *BufferPolicy `json:"buffer"`
+	//+kubebuilder:validation:Minimum=0
+	// ScaleDownCoolOffSeconds is the minimum time between two decreases of the effective StandingBy, zero disables the cool-off
+	ScaleDownCoolOffSeconds int `json:"scaleDownCoolOffSeconds,omitempty"`
+	//+kubebuilder:validation:Minimum=0
+	// MaxScaleDownStep is the maximum decrease of the effective StandingBy at a time, zero means no limit
+	MaxScaleDownStep int `json:"maxScaleDownStep,omitempty"`
+}
+
+// BufferPolicy keeps a buffer of StandingBy GameServers, as an absolute number or as a percentage of the Active GameServers
+type BufferPolicy struct {
+	//+kubebuilder:validation:Required
+	// Size is the number of StandingBy GameServers, or a percentage of the Active and Reserved GameServers rounded up
+	Size intstr.IntOrString `json:"size"`
+	//+kubebuilder:validation:Minimum=0
+	// MinStandingBy is the minimum number of StandingBy GameServers, it must be at least 1 if Size is a percentage
+	MinStandingBy int `json:"minStandingBy,omitempty"`
+	//+kubebuilder:validation:Minimum=0
+	// MaxStandingBy is the maximum number of StandingBy GameServers, zero means no limit other than Max
+	MaxStandingBy int `json:"maxStandingBy,omitempty"`
+}
+
+// ScalingSchedule overrides the StandingBy and Max of a GameServerBuild during recurring time windows
+// every window starts at a time matched by the cron expression and lasts for DurationSeconds
+type ScalingSchedule struct {
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:MinLength=1
+	// Name identifies the schedule, it must be unique in the GameServerBuild
+	Name string `json:"name"`
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:MinLength=1
+	// Schedule is a cron expression in the standard five field format, e.g. "0 18 * * 5", or a descriptor like @daily
+	Schedule string `json:"schedule"`
+	// TimeZone is the IANA name of the time zone of the cron expression, e.g. "Europe/Athens", defaults to UTC
+	TimeZone string `json:"timeZone,omitempty"`
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Minimum=1
+	// DurationSeconds is the length of every window
+	DurationSeconds int `json:"durationSeconds"`
+	//+kubebuilder:validation:Minimum=0
+	// StandingBy overrides the StandingBy of the GameServerBuild during the window
+	// if Autoscaling is set, it is the minimum effective StandingBy during the window
+	StandingBy *int `json:"standingBy,omitempty"`
+	//+kubebuilder:validation:Minimum=0
+	// Max overrides the Max of the GameServerBuild during the window
+	Max *int `json:"max,omitempty"`
+}
+
+// ExternalScaling configures an HTTP endpoint that is called on a fixed interval with the status of the GameServerBuild
+// and returns the desired StandingBy and Max. If a request fails, the last successful decision is kept
+type ExternalScaling struct {
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Pattern=`^https?://`
+	// URL is the HTTP endpoint that receives a POST request with the status of the GameServerBuild
+	URL string `json:"url"`
+	//+kubebuilder:validation:Minimum=1
+	// IntervalSeconds is the time between two requests to the endpoint, defaults to 30
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=10
+	// TimeoutSeconds is the timeout of every request to the endpoint, defaults to 5
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	//+kubebuilder:validation:Minimum=0
+	// MinStandingBy is the minimum StandingBy that is applied, regardless of the decision of the endpoint
+	MinStandingBy int `json:"minStandingBy,omitempty"`
+	//+kubebuilder:validation:Minimum=0
+	// MaxStandingBy is the maximum StandingBy that is applied, zero means no limit other than Max
+	// the Max of the GameServerBuild is always the upper bound of the Max decided by the endpoint
+	MaxStandingBy int `json:"maxStandingBy,omitempty"`
+}
+
+// ExternalScalingStatus contains the last decision of the external scaling endpoint, after the safety bounds were applied
+type ExternalScalingStatus struct {
+	// StandingBy is the StandingBy decided by the endpoint
+	StandingBy int `json:"standingBy,omitempty"`
+	// Max is the Max decided by the endpoint
+	Max int `json:"max,omitempty"`
+	// LastDecisionTime is the time of the last successful request, StandingBy and Max are only applied if it is set
+	LastDecisionTime *metav1.Time `json:"lastDecisionTime,omitempty"`
+	// LastError is the error of the last request, it is empty if the last request was successful
+	LastError string `json:"lastError,omitempty"`
+}
@@ -19,11 +19,16 @@ package v1alpha1
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/robfig/cron/v3"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -39,13 +44,26 @@ var (
 )
 
 const (
-	errNoHostPort                 = "ports to expose must not have a hostPort value"
-	errNoPortName                 = "ports to expose must have a name"
-	errBuildIdUnique              = "cannot have more than one GameServerBuild with the same BuildID"
-	errBuildIdImmutable           = "changing buildID on an existing GameServerBuild is not allowed"
-	errPortsMatchingPortsToExpose = "there must be at least one port that matches each value in portsToExpose"
-	errNoOwner                    = "a GameServer must have a GameServerBuild as an owner"
-	errStandingByLessThanMax      = "standingby must be less or equal than max"
+	errNoHostPort                     = "ports to expose must not have a hostPort value"
+	errNoPortName                     = "ports to expose must have a name"
+	errBuildIdUnique                  = "cannot have more than one GameServerBuild with the same BuildID"
+	errBuildIdImmutable               = "changing buildID on an existing GameServerBuild is not allowed"
+	errPortsMatchingPortsToExpose     = "there must be at least one port that matches each value in portsToExpose"
+	errNoOwner                        = "a GameServer must have a GameServerBuild as an owner"
+	errStandingByLessThanMax          = "standingby must be less or equal than max"
+	errInvalidRolloutValue            = "must be a non-negative integer or percentage"
+	errRolloutBothZero                = "maxSurge and maxUnavailable cannot both be zero"
+	errBufferSizeInvalid              = "buffer size must be a non-negative integer or percentage"
+	errBufferMinMoreThanMax           = "buffer minStandingBy must be less or equal than maxStandingBy"
+	errBufferMinMoreThanBuildMax      = "buffer minStandingBy must be less or equal than max"
+	errBufferPercentWithoutMin        = "buffer minStandingBy must be at least 1 when the buffer size is a percentage"
+	errScheduleNameNotUnique          = "schedule names must be unique"
+	errScheduleInvalid                = "must be a cron expression in the standard five field format or a descriptor, without a time zone"
+	errScheduleTimeZoneInvalid        = "must be a valid IANA time zone name"
+	errScheduleStandingByMoreThanMax  = "schedule standingBy must be less or equal than the max of the schedule or of the GameServerBuild"
+	errExternalScalingWithAutoscaling = "externalScaling cannot be set along with autoscaling"
+	errExternalScalingURLInvalid      = "must be an absolute http or https URL"
+	errExternalScalingMinMoreThanMax  = "externalScaling minStandingBy must be less or equal than maxStandingBy and max"
 )
 
 func (r *GameServerBuild) SetupWebhookWithManager(mgr ctrl.Manager) error {
@@ -80,6 +98,18 @@ func (r *GameServerBuild) ValidateCreate(ctx context.Context, obj runtime.Object
 	if err := gsb.validateStandingBy(); err != nil {
 		allErrs = append(allErrs, err)
 	}
+	if errs := gsb.validateRolloutStrategy(); errs != nil {
+		allErrs = append(allErrs, errs...)
+	}
+	if errs := gsb.validateAutoscaling(); errs != nil {
+		allErrs = append(allErrs, errs...)
+	}
+	if errs := gsb.validateSchedules(); errs != nil {
+		allErrs = append(allErrs, errs...)
+	}
+	if errs := gsb.validateExternalScaling(); errs != nil {
+		allErrs = append(allErrs, errs...)
+	}
 	if len(allErrs) == 0 {
 		return nil, nil
 	}
@@ -102,6 +132,18 @@ func (r *GameServerBuild) ValidateUpdate(ctx context.Context, oldObj, newObj run
 	if err := gsb.validateStandingBy(); err != nil {
 		allErrs = append(allErrs, err)
 	}
+	if errs := gsb.validateRolloutStrategy(); errs != nil {
+		allErrs = append(allErrs, errs...)
+	}
+	if errs := gsb.validateAutoscaling(); errs != nil {
+		allErrs = append(allErrs, errs...)
+	}
+	if errs := gsb.validateSchedules(); errs != nil {
+		allErrs = append(allErrs, errs...)
+	}
+	if errs := gsb.validateExternalScaling(); errs != nil {
+		allErrs = append(allErrs, errs...)
+	}
 	if len(allErrs) == 0 {
 		return nil, nil
 	}
@@ -158,6 +200,113 @@ func (r *GameServerBuild) validateStandingBy() *field.Error {
 	return nil
 }
 
+// validateRolloutStrategy checks that maxSurge and maxUnavailable are valid and not both zero
+func (r *GameServerBuild) validateRolloutStrategy() field.ErrorList {
+	if r.Spec.RolloutStrategy == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	path := field.NewPath("spec").Child("rolloutStrategy")
+	maxSurge, ok := getScaledIntOrPercent(r.Spec.RolloutStrategy.MaxSurge)
+	if !ok {
+		errs = append(errs, field.Invalid(path.Child("maxSurge"), r.Spec.RolloutStrategy.MaxSurge.String(), errInvalidRolloutValue))
+	}
+	maxUnavailable, ok := getScaledIntOrPercent(r.Spec.RolloutStrategy.MaxUnavailable)
+	if !ok {
+		errs = append(errs, field.Invalid(path.Child("maxUnavailable"), r.Spec.RolloutStrategy.MaxUnavailable.String(), errInvalidRolloutValue))
+	}
+	if len(errs) == 0 && maxSurge == 0 && maxUnavailable == 0 {
+		errs = append(errs, field.Invalid(path, r.Name, errRolloutBothZero))
+	}
+	return errs
+}
+
+// getScaledIntOrPercent returns the provided value scaled to 100 and true if it is a non-negative integer or percentage
+// an unset value is the default 25% of maxSurge and maxUnavailable
+func getScaledIntOrPercent(value *intstr.IntOrString) (int, bool) {
+	if value == nil {
+		return 25, true
+	}
+	scaled, err := intstr.GetScaledValueFromIntOrPercent(value, 100, true)
+	if err != nil || scaled < 0 {
+		return 0, false
+	}
+	return scaled, true
+}
+
+// validateAutoscaling checks that the buffer size is valid and that its minimum is not more than its maximum or max
+// a percentage buffer needs a minimum, otherwise a build without Active GameServers has no StandingBy and never scales up
+func (r *GameServerBuild) validateAutoscaling() field.ErrorList {
+	if r.Spec.Autoscaling == nil || r.Spec.Autoscaling.Buffer == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	buffer := r.Spec.Autoscaling.Buffer
+	path := field.NewPath("spec").Child("autoscaling").Child("buffer")
+	if _, ok := getScaledIntOrPercent(&buffer.Size); !ok {
+		errs = append(errs, field.Invalid(path.Child("size"), buffer.Size.String(), errBufferSizeInvalid))
+	} else if buffer.Size.Type == intstr.String && buffer.MinStandingBy < 1 {
+		errs = append(errs, field.Invalid(path.Child("minStandingBy"), buffer.MinStandingBy, errBufferPercentWithoutMin))
+	}
+	if buffer.MaxStandingBy > 0 && buffer.MinStandingBy > buffer.MaxStandingBy {
+		errs = append(errs, field.Invalid(path.Child("minStandingBy"), buffer.MinStandingBy, errBufferMinMoreThanMax))
+	}
+	if buffer.MinStandingBy > r.Spec.Max {
+		errs = append(errs, field.Invalid(path.Child("minStandingBy"), buffer.MinStandingBy, errBufferMinMoreThanBuildMax))
+	}
+	return errs
+}
+
+// validateSchedules checks that the schedules have unique names, valid cron expressions and time zones
+// and that their standingBy is not more than their max
+func (r *GameServerBuild) validateSchedules() field.ErrorList {
+	var errs field.ErrorList
+	names := make(map[string]struct{}, len(r.Spec.Schedules))
+	for i, schedule := range r.Spec.Schedules {
+		path := field.NewPath("spec").Child("schedules").Index(i)
+		if _, exists := names[schedule.Name]; exists {
+			errs = append(errs, field.Invalid(path.Child("name"), schedule.Name, errScheduleNameNotUnique))
+		}
+		names[schedule.Name] = struct{}{}
+		// the time zone is set with the timeZone field, and @every descriptors have no fixed start time for the windows
+		if _, err := cron.ParseStandard(schedule.Schedule); err != nil || strings.Contains(schedule.Schedule, "TZ=") || strings.HasPrefix(schedule.Schedule, "@every") {
+			errs = append(errs, field.Invalid(path.Child("schedule"), schedule.Schedule, errScheduleInvalid))
+		}
+		if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+			errs = append(errs, field.Invalid(path.Child("timeZone"), schedule.TimeZone, errScheduleTimeZoneInvalid))
+		}
+		max := r.Spec.Max
+		if schedule.Max != nil {
+			max = *schedule.Max
+		}
+		if schedule.StandingBy != nil && *schedule.StandingBy > max {
+			errs = append(errs, field.Invalid(path.Child("standingBy"), *schedule.StandingBy, errScheduleStandingByMoreThanMax))
+		}
+	}
+	return errs
+}
+
+// validateExternalScaling checks that externalScaling is not set along with autoscaling, that its URL is valid
+// and that its minStandingBy is not more than its maxStandingBy or max
+func (r *GameServerBuild) validateExternalScaling() field.ErrorList {
+	es := r.Spec.ExternalScaling
+	if es == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	path := field.NewPath("spec").Child("externalScaling")
+	if r.Spec.Autoscaling != nil {
+		errs = append(errs, field.Invalid(path, r.Name, errExternalScalingWithAutoscaling))
+	}
+	if u, err := url.ParseRequestURI(es.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, field.Invalid(path.Child("url"), es.URL, errExternalScalingURLInvalid))
+	}
+	if es.MinStandingBy > r.Spec.Max || (es.MaxStandingBy > 0 && es.MinStandingBy > es.MaxStandingBy) {
+		errs = append(errs, field.Invalid(path.Child("minStandingBy"), es.MinStandingBy, errExternalScalingMinMoreThanMax))
+	}
+	return errs
+}
+
 // validatePortsToExposeInternal validates portsToExpose slice
 // it performs the following validations
 //   - if a port number is in portsToExpose, there must be at least one
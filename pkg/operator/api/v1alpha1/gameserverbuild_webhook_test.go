@@ -7,6 +7,7 @@ import (
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/uuid"
 )
 
@@ -73,6 +74,118 @@ var _ = Describe("GameServerBuild webhook tests", func() {
 			Expect(err.Error()).Should(ContainSubstring(errStandingByLessThanMax))
 		})
 
+		It("validates the rollout strategy", func() {
+			buildName, buildID := getNewNameAndID()
+			gsb := createTestGameServerBuild(buildName, buildID, 2, 4, false)
+			Expect(gsb.validateRolloutStrategy()).To(BeEmpty())
+			zero, invalid, percent := intstr.FromInt(0), intstr.FromString("ten"), intstr.FromString("50%")
+			gsb.Spec.RolloutStrategy = &RolloutStrategy{MaxSurge: &zero}
+			Expect(gsb.validateRolloutStrategy()).To(BeEmpty())
+			gsb.Spec.RolloutStrategy = &RolloutStrategy{MaxSurge: &zero, MaxUnavailable: &percent}
+			Expect(gsb.validateRolloutStrategy()).To(BeEmpty())
+			gsb.Spec.RolloutStrategy = &RolloutStrategy{MaxSurge: &invalid}
+			errs := gsb.validateRolloutStrategy()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Error()).Should(ContainSubstring(errInvalidRolloutValue))
+			gsb.Spec.RolloutStrategy = &RolloutStrategy{MaxSurge: &zero, MaxUnavailable: &zero}
+			errs = gsb.validateRolloutStrategy()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Error()).Should(ContainSubstring(errRolloutBothZero))
+			err := k8sClient.Create(ctx, &gsb)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring(errRolloutBothZero))
+		})
+
+		It("validates the autoscaling buffer", func() {
+			buildName, buildID := getNewNameAndID()
+			gsb := createTestGameServerBuild(buildName, buildID, 2, 10, false)
+			gsb.Spec.Autoscaling = &GameServerBuildAutoscaling{Buffer: &BufferPolicy{Size: intstr.FromString("20%"), MinStandingBy: 2, MaxStandingBy: 5}}
+			Expect(gsb.validateAutoscaling()).To(BeEmpty())
+			gsb.Spec.Autoscaling.Buffer.Size = intstr.FromString("many")
+			errs := gsb.validateAutoscaling()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Error()).Should(ContainSubstring(errBufferSizeInvalid))
+			gsb.Spec.Autoscaling.Buffer = &BufferPolicy{Size: intstr.FromString("20%")}
+			errs = gsb.validateAutoscaling()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Error()).Should(ContainSubstring(errBufferPercentWithoutMin))
+			gsb.Spec.Autoscaling.Buffer = &BufferPolicy{Size: intstr.FromInt(3)}
+			Expect(gsb.validateAutoscaling()).To(BeEmpty())
+			gsb.Spec.Autoscaling.Buffer = &BufferPolicy{Size: intstr.FromInt(3), MinStandingBy: 6, MaxStandingBy: 5}
+			errs = gsb.validateAutoscaling()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Error()).Should(ContainSubstring(errBufferMinMoreThanMax))
+			gsb.Spec.Autoscaling.Buffer = &BufferPolicy{Size: intstr.FromInt(3), MinStandingBy: 11}
+			errs = gsb.validateAutoscaling()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Error()).Should(ContainSubstring(errBufferMinMoreThanBuildMax))
+			err := k8sClient.Create(ctx, &gsb)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring(errBufferMinMoreThanBuildMax))
+		})
+
+		It("validates the schedules", func() {
+			buildName, buildID := getNewNameAndID()
+			gsb := createTestGameServerBuild(buildName, buildID, 2, 10, false)
+			standingBy, max := 20, 30
+			gsb.Spec.Schedules = []ScalingSchedule{
+				{Name: "evenings", Schedule: "0 18 * * *", TimeZone: "Europe/Athens", DurationSeconds: 14400, StandingBy: &standingBy, Max: &max},
+				{Name: "launch", Schedule: "@yearly", DurationSeconds: 3600},
+			}
+			Expect(gsb.validateSchedules()).To(BeEmpty())
+			gsb.Spec.Schedules[1].Name = "evenings"
+			errs := gsb.validateSchedules()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Error()).Should(ContainSubstring(errScheduleNameNotUnique))
+			gsb.Spec.Schedules[1].Name = "launch"
+			for _, schedule := range []string{"0 18 * *", "@every 1h", "CRON_TZ=UTC 0 18 * * *", "0 25 * * *"} {
+				gsb.Spec.Schedules[1].Schedule = schedule
+				errs = gsb.validateSchedules()
+				Expect(errs).To(HaveLen(1), schedule)
+				Expect(errs[0].Error()).Should(ContainSubstring(errScheduleInvalid))
+			}
+			gsb.Spec.Schedules[1].Schedule = "@yearly"
+			gsb.Spec.Schedules[1].TimeZone = "Mars/Olympus"
+			errs = gsb.validateSchedules()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Error()).Should(ContainSubstring(errScheduleTimeZoneInvalid))
+			gsb.Spec.Schedules[1].TimeZone = ""
+			// without a max override, the standingBy is compared to the max of the GameServerBuild
+			gsb.Spec.Schedules[0].Max = nil
+			errs = gsb.validateSchedules()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Error()).Should(ContainSubstring(errScheduleStandingByMoreThanMax))
+			err := k8sClient.Create(ctx, &gsb)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring(errScheduleStandingByMoreThanMax))
+		})
+
+		It("validates the external scaling", func() {
+			buildName, buildID := getNewNameAndID()
+			gsb := createTestGameServerBuild(buildName, buildID, 2, 10, false)
+			gsb.Spec.ExternalScaling = &ExternalScaling{URL: "http://capacity.default.svc:8080/scale", MinStandingBy: 2, MaxStandingBy: 5}
+			Expect(gsb.validateExternalScaling()).To(BeEmpty())
+			for _, u := range []string{"capacity:8080/scale", "ftp://capacity/scale", "http://"} {
+				gsb.Spec.ExternalScaling.URL = u
+				errs := gsb.validateExternalScaling()
+				Expect(errs).To(HaveLen(1), u)
+				Expect(errs[0].Error()).Should(ContainSubstring(errExternalScalingURLInvalid))
+			}
+			gsb.Spec.ExternalScaling.URL = "https://capacity.example.com/scale"
+			gsb.Spec.ExternalScaling.MinStandingBy = 6
+			errs := gsb.validateExternalScaling()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Error()).Should(ContainSubstring(errExternalScalingMinMoreThanMax))
+			gsb.Spec.ExternalScaling.MinStandingBy = 2
+			gsb.Spec.Autoscaling = &GameServerBuildAutoscaling{Buffer: &BufferPolicy{Size: intstr.FromInt(3)}}
+			errs = gsb.validateExternalScaling()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Error()).Should(ContainSubstring(errExternalScalingWithAutoscaling))
+			err := k8sClient.Create(ctx, &gsb)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring(errExternalScalingWithAutoscaling))
+		})
+
 	})
 })
 
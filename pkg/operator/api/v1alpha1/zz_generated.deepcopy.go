@@ -21,9 +21,120 @@ limitations under the License.
 package v1alpha1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BufferPolicy) DeepCopyInto(out *BufferPolicy) {
+	*out = *in
+	out.Size = in.Size
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BufferPolicy.
+func (in *BufferPolicy) DeepCopy() *BufferPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(BufferPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildAlias) DeepCopyInto(out *BuildAlias) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildAlias.
+func (in *BuildAlias) DeepCopy() *BuildAlias {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildAlias)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BuildAlias) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildAliasList) DeepCopyInto(out *BuildAliasList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]BuildAlias, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildAliasList.
+func (in *BuildAliasList) DeepCopy() *BuildAliasList {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildAliasList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BuildAliasList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildAliasSpec) DeepCopyInto(out *BuildAliasSpec) {
+	*out = *in
+	if in.Builds != nil {
+		in, out := &in.Builds, &out.Builds
+		*out = make([]BuildAliasTarget, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildAliasSpec.
+func (in *BuildAliasSpec) DeepCopy() *BuildAliasSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildAliasSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildAliasTarget) DeepCopyInto(out *BuildAliasTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildAliasTarget.
+func (in *BuildAliasTarget) DeepCopy() *BuildAliasTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildAliasTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BuildMetadataItem) DeepCopyInto(out *BuildMetadataItem) {
 	*out = *in
@@ -39,6 +150,40 @@ func (in *BuildMetadataItem) DeepCopy() *BuildMetadataItem {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalScaling) DeepCopyInto(out *ExternalScaling) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalScaling.
+func (in *ExternalScaling) DeepCopy() *ExternalScaling {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalScaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalScalingStatus) DeepCopyInto(out *ExternalScalingStatus) {
+	*out = *in
+	if in.LastDecisionTime != nil {
+		in, out := &in.LastDecisionTime, &out.LastDecisionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalScalingStatus.
+func (in *ExternalScalingStatus) DeepCopy() *ExternalScalingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalScalingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GameServer) DeepCopyInto(out *GameServer) {
 	*out = *in
@@ -66,13 +211,118 @@ func (in *GameServer) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GameServerAllocation) DeepCopyInto(out *GameServerAllocation) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GameServerAllocation.
+func (in *GameServerAllocation) DeepCopy() *GameServerAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(GameServerAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *GameServerAllocation) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GameServerAllocationList) DeepCopyInto(out *GameServerAllocationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]GameServerAllocation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GameServerAllocationList.
+func (in *GameServerAllocationList) DeepCopy() *GameServerAllocationList {
+	if in == nil {
+		return nil
+	}
+	out := new(GameServerAllocationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *GameServerAllocationList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GameServerAllocationSpec) DeepCopyInto(out *GameServerAllocationSpec) {
+	*out = *in
+	if in.InitialPlayers != nil {
+		in, out := &in.InitialPlayers, &out.InitialPlayers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SessionMetadata != nil {
+		in, out := &in.SessionMetadata, &out.SessionMetadata
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GameServerAllocationSpec.
+func (in *GameServerAllocationSpec) DeepCopy() *GameServerAllocationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GameServerAllocationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GameServerAllocationStatus) DeepCopyInto(out *GameServerAllocationStatus) {
+	*out = *in
+	if in.AllocatedOn != nil {
+		in, out := &in.AllocatedOn, &out.AllocatedOn
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GameServerAllocationStatus.
+func (in *GameServerAllocationStatus) DeepCopy() *GameServerAllocationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(GameServerAllocationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GameServerBuild) DeepCopyInto(out *GameServerBuild) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GameServerBuild.
@@ -93,6 +343,26 @@ func (in *GameServerBuild) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GameServerBuildAutoscaling) DeepCopyInto(out *GameServerBuildAutoscaling) {
+	*out = *in
+	if in.Buffer != nil {
+		in, out := &in.Buffer, &out.Buffer
+		*out = new(BufferPolicy)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GameServerBuildAutoscaling.
+func (in *GameServerBuildAutoscaling) DeepCopy() *GameServerBuildAutoscaling {
+	if in == nil {
+		return nil
+	}
+	out := new(GameServerBuildAutoscaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GameServerBuildList) DeepCopyInto(out *GameServerBuildList) {
 	*out = *in
@@ -144,6 +414,33 @@ func (in *GameServerBuildSpec) DeepCopyInto(out *GameServerBuildSpec) {
 		*out = make([]BuildMetadataItem, len(*in))
 		copy(*out, *in)
 	}
+	if in.WeightedAllocation != nil {
+		in, out := &in.WeightedAllocation, &out.WeightedAllocation
+		*out = new(WeightedAllocation)
+		**out = **in
+	}
+	if in.RolloutStrategy != nil {
+		in, out := &in.RolloutStrategy, &out.RolloutStrategy
+		*out = new(RolloutStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(GameServerBuildAutoscaling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Schedules != nil {
+		in, out := &in.Schedules, &out.Schedules
+		*out = make([]ScalingSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ExternalScaling != nil {
+		in, out := &in.ExternalScaling, &out.ExternalScaling
+		*out = new(ExternalScaling)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GameServerBuildSpec.
@@ -159,6 +456,37 @@ func (in *GameServerBuildSpec) DeepCopy() *GameServerBuildSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GameServerBuildStatus) DeepCopyInto(out *GameServerBuildStatus) {
 	*out = *in
+	if in.RecentCrashes != nil {
+		in, out := &in.RecentCrashes, &out.RecentCrashes
+		*out = make([]metav1.Time, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RecentProcessCrashes != nil {
+		in, out := &in.RecentProcessCrashes, &out.RecentProcessCrashes
+		*out = make([]metav1.Time, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CrashBackoffEndTime != nil {
+		in, out := &in.CrashBackoffEndTime, &out.CrashBackoffEndTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastScaleDownTime != nil {
+		in, out := &in.LastScaleDownTime, &out.LastScaleDownTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ActiveScheduleEndTime != nil {
+		in, out := &in.ActiveScheduleEndTime, &out.ActiveScheduleEndTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ExternalScaling != nil {
+		in, out := &in.ExternalScaling, &out.ExternalScaling
+		*out = new(ExternalScalingStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GameServerBuildStatus.
@@ -331,6 +659,13 @@ func (in *GameServerStatus) DeepCopyInto(out *GameServerStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.SessionMetadata != nil {
+		in, out := &in.SessionMetadata, &out.SessionMetadata
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.ReachedInitializingOn != nil {
 		in, out := &in.ReachedInitializingOn, &out.ReachedInitializingOn
 		*out = (*in).DeepCopy()
@@ -343,6 +678,18 @@ func (in *GameServerStatus) DeepCopyInto(out *GameServerStatus) {
 		in, out := &in.ReachedActiveOn, &out.ReachedActiveOn
 		*out = (*in).DeepCopy()
 	}
+	if in.ReservedUntil != nil {
+		in, out := &in.ReservedUntil, &out.ReservedUntil
+		*out = (*in).DeepCopy()
+	}
+	if in.ReleaseRequestedOn != nil {
+		in, out := &in.ReleaseRequestedOn, &out.ReleaseRequestedOn
+		*out = (*in).DeepCopy()
+	}
+	if in.TerminationRequestedOn != nil {
+		in, out := &in.TerminationRequestedOn, &out.TerminationRequestedOn
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GameServerStatus.
@@ -354,3 +701,68 @@ func (in *GameServerStatus) DeepCopy() *GameServerStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStrategy) DeepCopyInto(out *RolloutStrategy) {
+	*out = *in
+	if in.MaxSurge != nil {
+		in, out := &in.MaxSurge, &out.MaxSurge
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStrategy.
+func (in *RolloutStrategy) DeepCopy() *RolloutStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingSchedule) DeepCopyInto(out *ScalingSchedule) {
+	*out = *in
+	if in.StandingBy != nil {
+		in, out := &in.StandingBy, &out.StandingBy
+		*out = new(int)
+		**out = **in
+	}
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingSchedule.
+func (in *ScalingSchedule) DeepCopy() *ScalingSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WeightedAllocation) DeepCopyInto(out *WeightedAllocation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WeightedAllocation.
+func (in *WeightedAllocation) DeepCopy() *WeightedAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(WeightedAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
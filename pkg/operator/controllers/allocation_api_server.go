@@ -6,19 +6,27 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/go-logr/logr"
@@ -27,12 +35,24 @@ import (
 
 const (
 	allocationTries = 3
+	// maxBatchAllocationSize is the maximum number of allocations that can be requested in a single batch call
+	maxBatchAllocationSize = 100
+	// maxAllocationWaitTimeout is the maximum time an allocation request can wait for a StandingBy server
+	maxAllocationWaitTimeout = 30 * time.Second
+	// allocationWriteTimeout is the write timeout of the allocation API service, it is extended for the requests that wait for a StandingBy server
+	allocationWriteTimeout = 5 * time.Second
 	// statusSessionId is the field name used to index GameServer objects by their session ID
 	statusSessionId string = "status.sessionID"
 	// specBuildId is the field name used to index GameServerBuild objects by their build ID
 	specBuildId string = "spec.buildID"
+	// specAliasId is the field name used to index BuildAlias objects by their alias ID
+	specAliasId string = "spec.aliasID"
+	// specTitleId is the field name used to index GameServer objects by their title ID
+	specTitleId string = "spec.titleID"
 )
 
+//+kubebuilder:rbac:groups=mps.playfab.com,resources=buildaliases,verbs=get;list;watch
+
 // AllocationApiServer is a helper struct that implements manager.Runnable interface
 // so it can be added to our Manager
 type AllocationApiServer struct {
@@ -40,22 +60,38 @@ type AllocationApiServer struct {
 	// certWatcher watches and reloads TLS certificates from disk for dynamic cert rotation.
 	// If nil, the server runs without TLS.
 	certWatcher *CertificateWatcher
-	// gameServerQueue is a map of priority queues for game servers
+	// gameServerQueue is a map of priority queues for game servers, it is shared with the gRPC allocation service
 	gameServerQueue *GameServersQueue
 	// events is a buffered channel of GenericEvent
 	// it is used to re-enqueue GameServer objects that their allocation failed for whatever reason
 	events        chan event.GenericEvent
 	logger        logr.Logger
 	listeningPort int32
+	// federationAllocator forwards allocations to peer clusters, if nil the federation route is not served
+	federationAllocator *FederationAllocator
+	// tokenAuthenticator authenticates calls with API keys or JWTs, if nil calls are not authenticated with a token
+	tokenAuthenticator *TokenAuthenticator
+	// rateLimiter limits the allocations per caller, build and title, if nil allocations are not limited
+	rateLimiter *AllocationRateLimiter
+	// eventSink sends the GameServer lifecycle events, if nil lifecycle events are disabled
+	eventSink *EventSink
+	// auditSink stores the allocation audit records, if nil allocations are not audited
+	auditSink AuditSink
+	// allocationStrategies caches the AllocationStrategy of every GameServerBuild, keyed by its namespaced name
+	// it is kept up to date by the GameServerBuild watch, so reconciling a GameServer does not fetch its GameServerBuild
+	allocationStrategies sync.Map
+	// nodeZones caches the zone of every Node, keyed by its name, it is kept up to date by the Node watch
+	nodeZones sync.Map
 }
 
 func NewAllocationApiServer(certWatcher *CertificateWatcher, cl client.Client, port int32) *AllocationApiServer {
 	return &AllocationApiServer{
-		certWatcher:   certWatcher,
-		Client:        cl,
-		events:        make(chan event.GenericEvent, 100),
-		logger:        log.Log.WithName("allocation-api"),
-		listeningPort: port,
+		certWatcher:     certWatcher,
+		Client:          cl,
+		gameServerQueue: NewGameServersQueue(),
+		events:          make(chan event.GenericEvent, 100),
+		logger:          log.Log.WithName("allocation-api"),
+		listeningPort:   port,
 	}
 }
 
@@ -68,19 +104,40 @@ func (s *AllocationApiServer) Start(ctx context.Context) error {
 		addr = fmt.Sprintf(":%d", s.listeningPort)
 	}
 
-	// create the queue for game servers
-	s.gameServerQueue = NewGameServersQueue()
-
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/v1/allocate", s.handleAllocationRequest)
+	mux.HandleFunc("/api/v1/allocate/batch", s.handleBatchAllocationRequest)
+	mux.HandleFunc("/api/v2/allocate", s.handleAllocationRequestV2)
+	mux.HandleFunc("/api/v1/reserve", s.handleReserveRequest)
+	mux.HandleFunc("/api/v1/reserve/confirm", s.handleConfirmReservationRequest)
+	mux.HandleFunc("/api/v1/reserve/cancel", s.handleCancelReservationRequest)
+	mux.HandleFunc("/api/v1/release", s.handleReleaseRequest)
+	mux.HandleFunc("/api/v1/terminate", s.handleTerminateRequest)
+	mux.HandleFunc("/api/v1/sessions", s.handleListSessionsRequest)
+	mux.HandleFunc("/api/v1/sessions/{sessionID}", s.handleGetSessionRequest)
+	if s.auditSink != nil {
+		mux.HandleFunc("/api/v1/audit/allocations", s.handleAuditQueryRequest)
+	}
+	if s.federationAllocator != nil {
+		mux.HandleFunc("/api/v1/federation/allocate", s.handleFederatedAllocationRequest)
+	}
+
+	var handler http.Handler = mux
+	if s.certWatcher != nil {
+		handler = clientCertificateMiddleware(handler)
+	}
+	if s.tokenAuthenticator != nil {
+		s.logger.Info("requiring token authentication for the allocation API service")
+		handler = s.tokenAuthenticator.Middleware(handler)
+	}
 
 	s.logger.Info("serving allocation API service", "addr", addr, "port", s.listeningPort)
 
 	srv := &http.Server{
 		Addr:              addr,
-		Handler:           mux,
+		Handler:           handler,
 		ReadTimeout:       5 * time.Second,
-		WriteTimeout:      5 * time.Second,
+		WriteTimeout:      allocationWriteTimeout,
 		IdleTimeout:       30 * time.Second,
 		ReadHeaderTimeout: 2 * time.Second,
 		MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
@@ -127,6 +184,152 @@ func (s *AllocationApiServer) Start(ctx context.Context) error {
 	return nil
 }
 
+// getBuildIDsForAllocation returns the BuildIDs that can be used to allocate a GameServer for the provided ID, in the order they should be tried
+// the ID can either be the BuildID of a GameServerBuild or the AliasID of a BuildAlias
+func (s *AllocationApiServer) getBuildIDsForAllocation(ctx context.Context, id string) ([]string, error) {
+	// check if this build exists
+	var gameServerBuilds mpsv1alpha1.GameServerBuildList
+	if err := s.Client.List(ctx, &gameServerBuilds, client.MatchingFields{specBuildId: id}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, newAllocationError(http.StatusNotFound, err, "not found")
+		}
+		return nil, newAllocationError(http.StatusInternalServerError, err, "error listing")
+	}
+	if len(gameServerBuilds.Items) > 0 {
+		return []string{id}, nil
+	}
+
+	// check if there is a BuildAlias with this ID
+	var buildAliases mpsv1alpha1.BuildAliasList
+	if err := s.Client.List(ctx, &buildAliases, client.MatchingFields{specAliasId: id}); err != nil {
+		// the BuildAlias CRD might not be installed in the cluster
+		if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return nil, newAllocationError(http.StatusNotFound, err, "not found")
+		}
+		return nil, newAllocationError(http.StatusInternalServerError, err, "error listing")
+	}
+	if len(buildAliases.Items) == 0 {
+		return nil, newAllocationError(http.StatusNotFound, errors.New("GameServerBuild not found"), fmt.Sprintf("GameServerBuild or BuildAlias with ID %s not found", id))
+	}
+	return getBuildIDsFromAlias(&buildAliases.Items[0], rand.Intn), nil
+}
+
+// popFromQueue pops a GameServer from the queues of the provided builds, trying them in order
+// if wait is true and all queues are empty, it waits on the queues of all the builds until the context is done
+func (s *AllocationApiServer) popFromQueue(ctx context.Context, buildIDs []string, wait bool) *GameServerForQueue {
+	// PopFromQueueWithWait makes sure that requests that are already waiting are served first
+	if wait {
+		return s.gameServerQueue.PopFromQueueWithWait(ctx, buildIDs)
+	}
+	for _, buildID := range buildIDs {
+		if gs := s.gameServerQueue.PopFromQueue(buildID); gs != nil {
+			return gs
+		}
+	}
+	return nil
+}
+
+// getAllocationStrategy returns the AllocationStrategy of the GameServerBuild the provided GameServer belongs to
+// the GameServerBuild is fetched only if it is not cached yet, if it cannot be fetched the default NodeAge strategy is returned
+func (s *AllocationApiServer) getAllocationStrategy(ctx context.Context, gs *mpsv1alpha1.GameServer) AllocationStrategy {
+	key := getNamespacedName(gs.Namespace, gs.Labels[LabelBuildName])
+	if strategy, ok := s.allocationStrategies.Load(key); ok {
+		return strategy.(AllocationStrategy)
+	}
+	var gsb mpsv1alpha1.GameServerBuild
+	if err := s.Client.Get(ctx, types.NamespacedName{Namespace: gs.Namespace, Name: gs.Labels[LabelBuildName]}, &gsb); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.FromContext(ctx).Error(err, "unable to fetch GameServerBuild", "name", gs.Labels[LabelBuildName])
+		}
+		return nodeAgeStrategy{}
+	}
+	strategy := NewAllocationStrategy(&gsb.Spec)
+	s.allocationStrategies.Store(key, strategy)
+	return strategy
+}
+
+// getNodeZone returns the zone of the Node with the provided name, based on the well-known topology label
+// the Node is fetched only if it is not cached yet, returns an empty string if the Node cannot be fetched or does not have a zone
+func (s *AllocationApiServer) getNodeZone(ctx context.Context, nodeName string) string {
+	if nodeName == "" {
+		return ""
+	}
+	if zone, ok := s.nodeZones.Load(nodeName); ok {
+		return zone.(string)
+	}
+	var node corev1.Node
+	if err := s.Client.Get(ctx, types.NamespacedName{Name: nodeName}, &node); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.FromContext(ctx).Error(err, "unable to fetch Node", "name", nodeName)
+		}
+		return ""
+	}
+	zone := node.Labels[corev1.LabelTopologyZone]
+	s.nodeZones.Store(nodeName, zone)
+	return zone
+}
+
+// gameServerBuildCacheHandler keeps the cached AllocationStrategy of every GameServerBuild up to date
+// the queue of a GameServerBuild is sorted again as soon as its strategy changes
+func (s *AllocationApiServer) gameServerBuildCacheHandler() handler.EventHandler {
+	update := func(obj client.Object) {
+		gsb, ok := obj.(*mpsv1alpha1.GameServerBuild)
+		if !ok {
+			return
+		}
+		strategy := NewAllocationStrategy(&gsb.Spec)
+		s.allocationStrategies.Store(getNamespacedName(gsb.Namespace, gsb.Name), strategy)
+		s.gameServerQueue.SetAllocationStrategy(gsb.Spec.BuildID, strategy)
+	}
+	return handler.Funcs{
+		CreateFunc: func(_ context.Context, e event.CreateEvent, _ workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			update(e.Object)
+		},
+		UpdateFunc: func(_ context.Context, e event.UpdateEvent, _ workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			update(e.ObjectNew)
+		},
+		DeleteFunc: func(_ context.Context, e event.DeleteEvent, _ workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			s.allocationStrategies.Delete(getNamespacedName(e.Object.GetNamespace(), e.Object.GetName()))
+		},
+	}
+}
+
+// nodeCacheHandler keeps the cached zone of every Node up to date
+func (s *AllocationApiServer) nodeCacheHandler() handler.EventHandler {
+	return handler.Funcs{
+		CreateFunc: func(_ context.Context, e event.CreateEvent, _ workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			s.nodeZones.Store(e.Object.GetName(), e.Object.GetLabels()[corev1.LabelTopologyZone])
+		},
+		UpdateFunc: func(_ context.Context, e event.UpdateEvent, _ workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			s.nodeZones.Store(e.ObjectNew.GetName(), e.ObjectNew.GetLabels()[corev1.LabelTopologyZone])
+		},
+		DeleteFunc: func(_ context.Context, e event.DeleteEvent, _ workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			s.nodeZones.Delete(e.Object.GetName())
+		},
+	}
+}
+
+// getNodeFQDN returns the external DNS name of the Node with the provided name
+// returns an empty string if the Node cannot be fetched or does not have an external DNS name
+func (s *AllocationApiServer) getNodeFQDN(ctx context.Context, nodeName string) string {
+	if nodeName == "" {
+		return ""
+	}
+	var node corev1.Node
+	if err := s.Client.Get(ctx, types.NamespacedName{Name: nodeName}, &node); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.FromContext(ctx).Error(err, "unable to fetch Node", "name", nodeName)
+		}
+		return ""
+	}
+	for _, address := range node.Status.Addresses {
+		if address.Type == corev1.NodeExternalDNS {
+			return address.Address
+		}
+	}
+	return ""
+}
+
 // setupIndexers sets up the necessary indexers for the GameServer objects
 // specifically, these indexers will allow us to get gameservers by status.sessionID and by spec.BuildID
 func (s *AllocationApiServer) setupIndexers(mgr ctrl.Manager) error {
@@ -144,9 +347,61 @@ func (s *AllocationApiServer) setupIndexers(mgr ctrl.Manager) error {
 		return err
 	}
 
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &mpsv1alpha1.BuildAlias{}, specAliasId, func(rawObj client.Object) []string {
+		ba := rawObj.(*mpsv1alpha1.BuildAlias)
+		return []string{ba.Spec.AliasID}
+	}); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &mpsv1alpha1.GameServer{}, specTitleId, func(rawObj client.Object) []string {
+		gs := rawObj.(*mpsv1alpha1.GameServer)
+		return []string{gs.Spec.TitleID}
+	}); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// SetFederationAllocator enables the federated allocation route, which uses the provided FederationAllocator
+// it must be called before the AllocationApiServer is started
+func (s *AllocationApiServer) SetFederationAllocator(fa *FederationAllocator) {
+	s.federationAllocator = fa
+}
+
+// SetTokenAuthenticator requires all calls to the allocation API service to be authenticated with a token by the provided TokenAuthenticator
+// it must be called before the AllocationApiServer is started
+func (s *AllocationApiServer) SetTokenAuthenticator(ta *TokenAuthenticator) {
+	s.tokenAuthenticator = ta
+}
+
+// SetRateLimiter limits the allocations with the provided AllocationRateLimiter
+// it must be called before the AllocationApiServer is started
+func (s *AllocationApiServer) SetRateLimiter(rl *AllocationRateLimiter) {
+	s.rateLimiter = rl
+}
+
+// SetEventSink emits an allocated lifecycle event to the provided EventSink for every allocation
+// it must be called before the AllocationApiServer is started
+func (s *AllocationApiServer) SetEventSink(es *EventSink) {
+	s.eventSink = es
+}
+
+// SetAuditSink records every allocation attempt in the provided AuditSink and enables the audit query route
+// it must be called before the AllocationApiServer is started
+func (s *AllocationApiServer) SetAuditSink(as AuditSink) {
+	s.auditSink = as
+}
+
+// SetLivenessChecker skips StandingBy GameServers whose last heartbeat is stale according to the provided HeartbeatLivenessChecker
+// StandingBy GameServers that start heartbeating again are handed to the waiting allocation requests when the heartbeats are observed
+// it must be called before the AllocationApiServer and the HeartbeatLivenessChecker are started
+func (s *AllocationApiServer) SetLivenessChecker(lc *HeartbeatLivenessChecker) {
+	s.gameServerQueue.SetLivenessCheck(lc.isStale)
+	lc.onHeartbeats = s.gameServerQueue.UnparkFresh
+}
+
 // SetupWithManager sets up the allocation API controller with the manager
 func (s *AllocationApiServer) SetupWithManager(mgr ctrl.Manager) error {
 	err := s.setupIndexers(mgr)
@@ -155,9 +410,12 @@ func (s *AllocationApiServer) SetupWithManager(mgr ctrl.Manager) error {
 	}
 	// our controller is triggered by changes in any GameServer object
 	// as well as by manual insertions in the s.events channel
+	// GameServerBuilds and Nodes are watched only to keep the cached strategies and zones up to date, they do not trigger a reconciliation
 	err = ctrl.NewControllerManagedBy(mgr).
 		Named("allocation-api-server").
 		For(&mpsv1alpha1.GameServer{}).
+		Watches(&mpsv1alpha1.GameServerBuild{}, s.gameServerBuildCacheHandler()).
+		Watches(&corev1.Node{}, s.nodeCacheHandler()).
 		WatchesRawSource(source.Channel(s.events, &handler.EnqueueRequestForObject{})).
 		Complete(s)
 
@@ -175,22 +433,53 @@ func (s *AllocationApiServer) Reconcile(ctx context.Context, req ctrl.Request) (
 		if apierrors.IsNotFound(err) {
 			log.Info("Unable to fetch GameServer, it was deleted - deleting from queue", "namespace", req.Namespace, "name", req.Name)
 			s.gameServerQueue.RemoveFromQueue(req.Namespace, req.Name)
+			s.gameServerQueue.UpdateNodeUtilization(req.Namespace, req.Name, "", "", false)
 			return ctrl.Result{}, nil
 		}
 		log.Error(err, "unable to fetch GameServer", "namespace", req.Namespace, "name", req.Name)
 		return ctrl.Result{}, err
 	}
+	// GameServers that are marked for termination must not be allocated, released or returned to StandingBy
+	if gs.Status.TerminationRequestedOn != nil {
+		s.gameServerQueue.RemoveFromQueue(gs.Namespace, gs.Name)
+		return ctrl.Result{}, nil
+	}
+	// a StandingBy GameServer that still has a session was released by its game server process
+	// we clear the session details before it's put back on the queue, the patch will trigger another reconciliation
+	if gs.Status.State == mpsv1alpha1.GameServerStateStandingBy && gs.Status.SessionID != "" {
+		if err := s.releaseSession(ctx, &gs); err != nil {
+			// the GameServer was modified in the meantime, so we'll get notified again
+			if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+				return ctrl.Result{}, nil
+			}
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
 	// we only put a GameServer to the queue if it has reached the StandingBy state
 	// making sure to record the ResourceVersion, to ensure deterministic lock in when we try and PATCH the GameServer with the Active state during allocation
 	if gs.Status.State == mpsv1alpha1.GameServerStateStandingBy {
 		s.gameServerQueue.PushToQueue(&GameServerForQueue{
-			Name:            gs.Name,
-			Namespace:       gs.Namespace,
-			BuildID:         gs.Spec.BuildID,
-			NodeAge:         gs.Status.NodeAge,
-			ResourceVersion: gs.ObjectMeta.ResourceVersion,
+			Name:               gs.Name,
+			Namespace:          gs.Namespace,
+			BuildID:            gs.Spec.BuildID,
+			NodeAge:            gs.Status.NodeAge,
+			NodeName:           gs.Status.NodeName,
+			Zone:               s.getNodeZone(ctx, gs.Status.NodeName),
+			ResourceVersion:    gs.ObjectMeta.ResourceVersion,
+			AllocationStrategy: s.getAllocationStrategy(ctx, &gs),
 		})
 	}
+	// Active GameServers are tracked per Node and zone, so the allocation strategies can take them into account
+	if gs.Status.State == mpsv1alpha1.GameServerStateActive {
+		s.gameServerQueue.UpdateNodeUtilization(gs.Namespace, gs.Name, gs.Status.NodeName, s.getNodeZone(ctx, gs.Status.NodeName), true)
+	} else {
+		s.gameServerQueue.UpdateNodeUtilization(gs.Namespace, gs.Name, "", "", false)
+	}
+	// Reserved GameServers that were not confirmed in time are returned to StandingBy
+	if gs.Status.State == mpsv1alpha1.GameServerStateReserved {
+		return s.expireReservation(ctx, &gs)
+	}
 
 	return ctrl.Result{}, nil
 }
@@ -199,17 +488,76 @@ func (s *AllocationApiServer) Reconcile(ctx context.Context, req ctrl.Request) (
 func (s *AllocationApiServer) handleAllocationRequest(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	args, ok := s.parseAllocateArgs(w, r)
+	if !ok {
+		return
+	}
+
+	gs, err := s.allocate(ctx, args)
+	if err != nil {
+		writeAllocationError(w, s.logger, err)
+		return
+	}
+
+	rs := RequestMultiplayerServerResponse{
+		IPV4Address: gs.Status.PublicIP,
+		Ports:       gs.Status.Ports,
+		SessionID:   args.SessionID,
+	}
+	err = json.NewEncoder(w).Encode(rs)
+	if err != nil {
+		internalServerError(w, s.logger, err, "encode json response")
+		Allocations500ErrorsCounter.WithLabelValues(gs.Labels[LabelBuildName]).Inc()
+	}
+}
+
+// handleAllocationRequestV2 handles the v2 allocation request from the client
+// it accepts the same arguments as the v1 route, but returns structured port details and the identity of the GameServer
+func (s *AllocationApiServer) handleAllocationRequestV2(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	args, ok := s.parseAllocateArgs(w, r)
+	if !ok {
+		return
+	}
+
+	gs, err := s.allocate(ctx, args)
+	if err != nil {
+		writeAllocationError(w, s.logger, err)
+		return
+	}
+
+	rs := AllocateResponseV2{
+		SessionID:      args.SessionID,
+		IPV4Address:    gs.Status.PublicIP,
+		FQDN:           s.getNodeFQDN(ctx, gs.Status.NodeName),
+		Ports:          getAllocatedPorts(gs),
+		GameServerName: gs.Name,
+		Namespace:      gs.Namespace,
+		NodeName:       gs.Status.NodeName,
+		BuildName:      gs.Labels[LabelBuildName],
+	}
+	err = json.NewEncoder(w).Encode(rs)
+	if err != nil {
+		internalServerError(w, s.logger, err, "encode json response")
+		Allocations500ErrorsCounter.WithLabelValues(gs.Labels[LabelBuildName]).Inc()
+	}
+}
+
+// parseAllocateArgs sets the response headers, parses and validates the arguments of an allocation request
+// if the arguments are not valid, it writes the error to the response and returns false
+func (s *AllocationApiServer) parseAllocateArgs(w http.ResponseWriter, r *http.Request) (*AllocateArgs, bool) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, PATCH, OPTIONS")
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 	if r.Method == "OPTIONS" {
-		return
+		return nil, false
 	}
 
 	if r.Method != http.MethodPost && r.Method != http.MethodPatch {
 		badRequestError(w, s.logger, errors.New("invalid method"), "Only POST and PATCH are accepted")
-		return
+		return nil, false
 	}
 
 	// Parse args
@@ -217,75 +565,214 @@ func (s *AllocationApiServer) handleAllocationRequest(w http.ResponseWriter, r *
 	err := json.NewDecoder(r.Body).Decode(&args)
 	if err != nil {
 		badRequestError(w, s.logger, err, "cannot deserialize json")
-		return
+		return nil, false
 	}
 
 	// validate args
 	isValid := validateAllocateArgs(&args)
 	if !isValid {
-		badRequestError(w, s.logger, errors.New("invalid sessionID or buildID"), "invalid arguments")
+		badRequestError(w, s.logger, errors.New("invalid sessionID, buildID or waitTimeoutMs"), "invalid arguments")
+		return nil, false
+	}
+	extendWriteDeadline(w, args.WaitTimeoutMs)
+	return &args, true
+}
+
+// extendWriteDeadline extends the write deadline of the response by the time an allocation request may wait for a StandingBy server
+// the write timeout of the server is kept short for all the other requests
+func extendWriteDeadline(w http.ResponseWriter, waitTimeoutMs int) {
+	if waitTimeoutMs <= 0 {
 		return
 	}
+	// it fails only if the ResponseWriter does not support deadlines, in which case there is no deadline to extend
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(allocationWriteTimeout + time.Duration(waitTimeoutMs)*time.Millisecond))
+}
 
-	// check if this build exists
-	var gameServerBuilds mpsv1alpha1.GameServerBuildList
-	err = s.Client.List(ctx, &gameServerBuilds, client.MatchingFields{specBuildId: args.BuildID})
+// handleBatchAllocationRequest handles a request that contains multiple allocations
+// every allocation is processed independently and gets its own result, in the same order as the request
+func (s *AllocationApiServer) handleBatchAllocationRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		badRequestError(w, s.logger, errors.New("invalid method"), "Only POST is accepted")
+		return
+	}
+
+	var args BatchAllocateArgs
+	err := json.NewDecoder(r.Body).Decode(&args)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			notFoundError(w, s.logger, err, "not found")
-		} else {
-			internalServerError(w, s.logger, err, "error listing")
-		}
+		badRequestError(w, s.logger, err, "cannot deserialize json")
 		return
 	}
-	if len(gameServerBuilds.Items) == 0 {
-		notFoundError(w, s.logger, errors.New("GameServerBuild not found"), fmt.Sprintf("GameServerBuild with ID %s not found", args.BuildID))
+
+	if len(args.Allocations) == 0 || len(args.Allocations) > maxBatchAllocationSize {
+		badRequestError(w, s.logger, fmt.Errorf("number of allocations must be between 1 and %d", maxBatchAllocationSize), "invalid arguments")
 		return
 	}
+	// the allocations of the batch are processed concurrently, so the deadline is extended by the longest wait
+	maxWaitTimeoutMs := 0
+	for _, aa := range args.Allocations {
+		maxWaitTimeoutMs = max(maxWaitTimeoutMs, aa.WaitTimeoutMs)
+	}
+	extendWriteDeadline(w, maxWaitTimeoutMs)
+
+	results := s.batchAllocate(ctx, args.Allocations)
+
+	err = json.NewEncoder(w).Encode(BatchAllocateResponse{Results: results})
+	if err != nil {
+		internalServerError(w, s.logger, err, "encode json response")
+	}
+}
+
+// batchAllocate processes the provided allocations concurrently, every allocation gets its own result in the same order
+func (s *AllocationApiServer) batchAllocate(ctx context.Context, allocations []AllocateArgs) []BatchAllocateResult {
+	results := make([]BatchAllocateResult, len(allocations))
+	// sessionIDs that appear more than once in the same batch are rejected,
+	// since the sessionID index in the cache might not be updated in time to detect the duplicate allocation
+	sessionIDs := make(map[string]struct{}, len(allocations))
+	var wg sync.WaitGroup
+	for i := range allocations {
+		aa := &allocations[i]
+		results[i].SessionID = aa.SessionID
+		if !validateAllocateArgs(aa) {
+			results[i].StatusCode = http.StatusBadRequest
+			results[i].Error = "invalid sessionID, buildID or waitTimeoutMs"
+			continue
+		}
+		if _, exists := sessionIDs[aa.SessionID]; exists {
+			results[i].StatusCode = http.StatusConflict
+			results[i].Error = fmt.Sprintf("sessionID %s is included multiple times in the batch", aa.SessionID)
+			continue
+		}
+		sessionIDs[aa.SessionID] = struct{}{}
+		wg.Add(1)
+		go func(result *BatchAllocateResult) {
+			defer wg.Done()
+			gs, err := s.allocate(ctx, aa)
+			if err != nil {
+				result.StatusCode = getAllocationErrorStatusCode(err)
+				result.Error = err.Error()
+				return
+			}
+			result.StatusCode = http.StatusOK
+			result.Response = &RequestMultiplayerServerResponse{
+				IPV4Address: gs.Status.PublicIP,
+				Ports:       gs.Status.Ports,
+				SessionID:   aa.SessionID,
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// allocate allocates a StandingBy GameServer for the provided arguments, which should have already been validated
+// if a GameServer with the same sessionID already exists in the GameServerBuild, it is returned instead
+// returned errors are of type *allocationError, so callers can map them to the proper status code
+func (s *AllocationApiServer) allocate(ctx context.Context, args *AllocateArgs) (*mpsv1alpha1.GameServer, error) {
+	return s.allocateOrReserve(ctx, args, 0)
+}
+
+// allocateOrReserve allocates a StandingBy GameServer for the provided arguments, which should have already been validated
+// if reservationTTL is larger than zero, the GameServer is marked as Reserved until it is confirmed or the TTL expires
+// every attempt is recorded in the audit log, if it is enabled
+func (s *AllocationApiServer) allocateOrReserve(ctx context.Context, args *AllocateArgs, reservationTTL time.Duration) (*mpsv1alpha1.GameServer, error) {
+	startTime := time.Now()
+	retries := 0
+	gs, err := s.tryAllocateOrReserve(ctx, args, reservationTTL, &retries)
+	s.recordAllocation(ctx, args, reservationTTL > 0, gs, err, retries, time.Since(startTime))
+	return gs, err
+}
+
+// tryAllocateOrReserve implements allocateOrReserve, it sets retries to the number of times the GameServer patch was retried
+func (s *AllocationApiServer) tryAllocateOrReserve(ctx context.Context, args *AllocateArgs, reservationTTL time.Duration, retries *int) (*mpsv1alpha1.GameServer, error) {
+	// get the builds we can allocate from, args.BuildID can be either a BuildID or the ID of a BuildAlias
+	buildIDs, err := s.getBuildIDsForAllocation(ctx, args.BuildID)
+	if err != nil {
+		return nil, err
+	}
+	// keep only the builds that the caller is allowed to use, if it was authenticated with a token
+	buildIDs, err = s.authorizeBuilds(ctx, buildIDs)
+	if err != nil {
+		return nil, err
+	}
 
 	// check if this server is already allocated
+	buildIDRequirement, err := labels.NewRequirement(LabelBuildID, selection.In, buildIDs)
+	if err != nil {
+		return nil, newAllocationError(http.StatusInternalServerError, err, "error creating label selector")
+	}
 	var gameserversForSessionID mpsv1alpha1.GameServerList
 	err = s.Client.List(ctx, &gameserversForSessionID, &client.ListOptions{
 		FieldSelector: fields.SelectorFromSet(fields.Set{statusSessionId: args.SessionID}),
-		LabelSelector: labels.SelectorFromSet(labels.Set{LabelBuildID: args.BuildID}),
+		LabelSelector: labels.NewSelector().Add(*buildIDRequirement),
 	})
 	if err != nil {
-		internalServerError(w, s.logger, err, "error listing")
-		return
+		return nil, newAllocationError(http.StatusInternalServerError, err, "error listing")
 	}
 
 	// this should never happen, but just in case
 	if len(gameserversForSessionID.Items) > 1 {
-		internalServerError(w, s.logger, errors.New("multiple servers found"), fmt.Sprintf("Multiple servers found for sessionID %s", args.SessionID))
-		return
+		return nil, newAllocationError(http.StatusInternalServerError, errors.New("multiple servers found"), fmt.Sprintf("Multiple servers found for sessionID %s", args.SessionID))
 	}
 
 	// found a GameServer in this GameServerBuild with the same sessionID
 	if len(gameserversForSessionID.Items) == 1 {
+		// allocating a Reserved session confirms the reservation
+		if reservationTTL == 0 && gameserversForSessionID.Items[0].Status.State == mpsv1alpha1.GameServerStateReserved {
+			return s.confirmReservation(ctx, &gameserversForSessionID.Items[0])
+		}
 		// return it
-		gs := gameserversForSessionID.Items[0]
-		rs := RequestMultiplayerServerResponse{
-			IPV4Address: gs.Status.PublicIP,
-			Ports:       gs.Status.Ports,
-			SessionID:   args.SessionID,
+		return &gameserversForSessionID.Items[0], nil
+	}
+
+	// skip the builds that are Draining, so that they take no new sessions
+	if buildIDs, err = s.skipDrainingBuilds(ctx, buildIDs, args.BuildID); err != nil {
+		return nil, err
+	}
+
+	// reject the allocation if the caller has exceeded its rate limit, retries of existing sessions are returned above
+	// then skip the builds that have exceeded their rate limits or whose titles have reached their cap of concurrent Active sessions
+	if s.rateLimiter != nil {
+		if err := s.rateLimiter.allowCaller(ctx, buildIDs); err != nil {
+			return nil, err
+		}
+		if buildIDs, err = s.rateLimiter.availableBuilds(buildIDs); err != nil {
+			return nil, err
+		}
+		if buildIDs, err = s.applyTitleQuotas(ctx, buildIDs); err != nil {
+			return nil, err
 		}
-		json.NewEncoder(w).Encode(rs)
-		return
 	}
 
 	timeToAllocateStartTime := time.Now()
 
+	// if the client has requested to wait for a StandingBy server, all the tries share the same deadline
+	// we're using a separate context so that the deadline does not affect the calls to the Kubernetes API server
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(args.WaitTimeoutMs)*time.Millisecond)
+	defer cancel()
+
 	// allocation using the heap
 	for i := 0; i < allocationTries; i++ {
+		*retries = i
 		if i > 0 {
 			s.logger.Info("retrying allocation", "buildID", args.BuildID, "retry count", i, "sessionID", args.SessionID)
 		}
-		gs := s.gameServerQueue.PopFromQueue(args.BuildID)
+		gs := s.popFromQueue(waitCtx, buildIDs, args.WaitTimeoutMs > 0)
 		if gs == nil {
-			// pop from queue returned nil, this means no more game servers in this build
-			tooManyRequestsError(w, s.logger, fmt.Errorf("not enough standingBy"), "there are not enough standingBy servers")
-			Allocations429ErrorsCounter.WithLabelValues(args.BuildID).Inc()
-			return
+			// pop from queue returned nil, this means no more game servers in these builds
+			for _, buildID := range buildIDs {
+				Allocations429ErrorsCounter.WithLabelValues(buildID).Inc()
+			}
+			return nil, newAllocationError(http.StatusTooManyRequests, fmt.Errorf("not enough standingBy"), "there are not enough standingBy servers")
 		}
 
 		// we got a standingBy server, so let's prepare for the Patch
@@ -301,12 +788,20 @@ func (s *AllocationApiServer) handleAllocationRequest(w http.ResponseWriter, r *
 		patch := client.MergeFromWithOptions(gs2.DeepCopy(), m)
 
 		// set the relevant status fields for the GameServer
-		gs2.Status.State = mpsv1alpha1.GameServerStateActive
 		gs2.Status.SessionID = args.SessionID
 		gs2.Status.SessionCookie = args.SessionCookie
 		gs2.Status.InitialPlayers = args.InitialPlayers
-		now := metav1.Now()
-		gs2.Status.ReachedActiveOn = &now
+		gs2.Status.SessionMetadata = args.SessionMetadata
+		if reservationTTL > 0 {
+			// the GameServer stays out of the queue until the reservation is confirmed, canceled or expires
+			gs2.Status.State = mpsv1alpha1.GameServerStateReserved
+			reservedUntil := metav1.NewTime(time.Now().Add(reservationTTL))
+			gs2.Status.ReservedUntil = &reservedUntil
+		} else {
+			gs2.Status.State = mpsv1alpha1.GameServerStateActive
+			now := metav1.Now()
+			gs2.Status.ReachedActiveOn = &now
+		}
 
 		err = s.Client.Status().Patch(ctx, &gs2, patch)
 		if err != nil {
@@ -322,32 +817,34 @@ func (s *AllocationApiServer) handleAllocationRequest(w http.ResponseWriter, r *
 			}
 			// in case of any error, trigger a reconciliation for this GameServer object
 			// so it's re-added to the queue
+			s.gameServerQueue.ForgetHandedOut(gs.Namespace, gs.Name)
 			s.events <- event.GenericEvent{
 				Object: &gs2,
 			}
 			// retry if possible
 			continue
 		}
-
-		// once we reach this point, the GameServer has been successfully allocated
-		rs := RequestMultiplayerServerResponse{
-			IPV4Address: gs2.Status.PublicIP,
-			Ports:       gs2.Status.Ports,
-			SessionID:   args.SessionID,
+		if s.rateLimiter != nil {
+			s.rateLimiter.takeBuildToken(gs.BuildID)
 		}
-		err = json.NewEncoder(w).Encode(rs)
-		if err != nil {
-			internalServerError(w, s.logger, err, "encode json response")
-			Allocations500ErrorsCounter.WithLabelValues(gs2.Labels[LabelBuildName]).Inc()
-			return
+
+		if reservationTTL > 0 {
+			s.logger.Info("Reserved GameServer", "name", gs2.Name, "sessionID", args.SessionID, "buildID", args.BuildID, "reservedUntil", gs2.Status.ReservedUntil)
+			ReservationsCounter.WithLabelValues(gs2.Labels[LabelBuildName]).Inc()
+			return &gs2, nil
 		}
+
+		// once we reach this point, the GameServer has been successfully allocated
+		// we record it as Active right away, so that subsequent allocations take it into account
+		s.gameServerQueue.UpdateNodeUtilization(gs.Namespace, gs.Name, gs.NodeName, gs.Zone, true)
 		s.logger.Info("Allocated GameServer", "name", gs2.Name, "sessionID", args.SessionID, "buildID", args.BuildID, "ip", gs2.Status.PublicIP, "ports", gs2.Status.Ports)
 		AllocationsCounter.WithLabelValues(gs2.Labels[LabelBuildName]).Inc()
+		s.eventSink.Emit(LifecycleEventAllocated, &gs2)
 		if i > 0 {
 			AllocationsRetriesCounter.WithLabelValues(gs2.Labels[LabelBuildName]).Inc()
 		}
 		AllocationsTimeTakenDuration.WithLabelValues(gs2.Labels[LabelBuildName]).Set(float64(time.Since(timeToAllocateStartTime).Milliseconds()))
-		return
+		return &gs2, nil
 	}
 
 	// if we reach this point, it means that we have tried multiple times and failed
@@ -356,5 +853,5 @@ func (s *AllocationApiServer) handleAllocationRequest(w http.ResponseWriter, r *
 		err = errors.New("unknown error, exceeded the maximum number of retries")
 	}
 	s.logger.Info("Error allocating", "sessionID", args.SessionID, "buildID", args.BuildID, "error", err)
-	internalServerError(w, s.logger, err, "error allocating")
+	return nil, newAllocationError(http.StatusInternalServerError, err, "error allocating")
 }
@@ -8,11 +8,16 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var _ = Describe("allocation API service input validation tests", func() {
@@ -147,6 +152,292 @@ var _ = Describe("allocation API service input validation tests", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(rm.SessionID).To(Equal(sessionID1))
 	})
+	It("should store the session metadata on the allocated game server", func() {
+		client := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"sessionMetadata\":{\"map\":\"dust\",\"mode\":\"ctf\"}}", sessionID1, buildID1)))
+		w := httptest.NewRecorder()
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            gsName,
+			Namespace:       "default",
+			BuildID:         buildID1,
+			ResourceVersion: gs.ObjectMeta.ResourceVersion,
+		})
+		h.handleAllocationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var gs2 mpsv1alpha1.GameServer
+		Expect(client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsName}, &gs2)).To(Succeed())
+		Expect(gs2.Status.State).To(Equal(mpsv1alpha1.GameServerStateActive))
+		Expect(gs2.Status.SessionMetadata).To(Equal(map[string]string{"map": "dust", "mode": "ctf"}))
+	})
+	It("should return structured port details and the identity of the game server on the v2 route", func() {
+		cl := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(cl, gsName, buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		gs.Spec.Template.Spec.Containers = []corev1.Container{
+			{
+				Name: "gameserver",
+				Ports: []corev1.ContainerPort{
+					{Name: "gameport", ContainerPort: 7777, HostPort: 10000, Protocol: corev1.ProtocolUDP},
+					{Name: "metrics", ContainerPort: 8080},
+				},
+			},
+		}
+		Expect(cl.Update(context.Background(), gs)).To(Succeed())
+		patch := client.MergeFrom(gs.DeepCopy())
+		gs.Status.NodeName = "node1"
+		gs.Status.PublicIP = "1.2.3.4"
+		Expect(cl.Status().Patch(context.Background(), gs, patch)).To(Succeed())
+		Expect(cl.Create(context.Background(), &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Status: corev1.NodeStatus{
+				Addresses: []corev1.NodeAddress{{Type: corev1.NodeExternalDNS, Address: "node1.example.com"}},
+			},
+		})).To(Succeed())
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/allocate", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\"}", sessionID1, buildID1)))
+		w := httptest.NewRecorder()
+		h := NewAllocationApiServer(nil, cl, allocationApiSvcPort)
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            gsName,
+			Namespace:       "default",
+			BuildID:         buildID1,
+			ResourceVersion: gs.ObjectMeta.ResourceVersion,
+		})
+		h.handleAllocationRequestV2(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var rs AllocateResponseV2
+		Expect(json.NewDecoder(res.Body).Decode(&rs)).To(Succeed())
+		Expect(rs.SessionID).To(Equal(sessionID1))
+		Expect(rs.IPV4Address).To(Equal("1.2.3.4"))
+		Expect(rs.FQDN).To(Equal("node1.example.com"))
+		Expect(rs.GameServerName).To(Equal(gsName))
+		Expect(rs.NodeName).To(Equal("node1"))
+		Expect(rs.BuildName).To(Equal(buildName1))
+		// only the ports that have a host port are returned
+		Expect(rs.Ports).To(Equal([]AllocatedPort{{Name: "gameport", Protocol: corev1.ProtocolUDP, ClientPort: 10000, ServerPort: 7777}}))
+	})
+	It("waitTimeoutMs larger than the maximum should return error", func() {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"waitTimeoutMs\":%d}", sessionID1, buildID1, (maxAllocationWaitTimeout+time.Second).Milliseconds())))
+		w := httptest.NewRecorder()
+		h := NewAllocationApiServer(nil, nil, allocationApiSvcPort)
+		h.handleAllocationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+	It("should return 429 after waiting if there is no standingBy game server", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, "", mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"waitTimeoutMs\":100}", sessionID1, buildID1)))
+		w := httptest.NewRecorder()
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		start := time.Now()
+		h.handleAllocationRequest(w, req)
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusTooManyRequests))
+	})
+	It("should allocate a game server that becomes standingBy while waiting", func() {
+		client := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"waitTimeoutMs\":5000}", sessionID1, buildID1)))
+		w := httptest.NewRecorder()
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		go func() {
+			defer GinkgoRecover()
+			// simulate the reconciliation that pushes the game server to the queue
+			time.Sleep(100 * time.Millisecond)
+			h.gameServerQueue.PushToQueue(&GameServerForQueue{
+				Name:            gsName,
+				Namespace:       "default",
+				BuildID:         buildID1,
+				ResourceVersion: gs.ObjectMeta.ResourceVersion,
+			})
+		}()
+		h.handleAllocationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var rm RequestMultiplayerServerResponse
+		err = json.NewDecoder(res.Body).Decode(&rm)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rm.SessionID).To(Equal(sessionID1))
+	})
+})
+
+var _ = Describe("allocation API service batch allocation tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		sessionID2 string = "9bb3bbb2-5031-42fd-8982-5a3f76ef2c8a"
+		gsName     string = "testgs"
+	)
+
+	It("GET method should return error", func() {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/allocate/batch", nil)
+		w := httptest.NewRecorder()
+		h := NewAllocationApiServer(nil, nil, allocationApiSvcPort)
+		h.handleBatchAllocationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+	It("empty batch should return error", func() {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate/batch", bytes.NewBufferString("{\"allocations\":[]}"))
+		w := httptest.NewRecorder()
+		h := NewAllocationApiServer(nil, nil, allocationApiSvcPort)
+		h.handleBatchAllocationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+	It("should return a result per allocation", func() {
+		client := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            gsName,
+			Namespace:       "default",
+			BuildID:         buildID1,
+			ResourceVersion: gs.ObjectMeta.ResourceVersion,
+		})
+		body := fmt.Sprintf("{\"allocations\":[{\"sessionID\":\"%s\",\"buildID\":\"%s\"},{\"sessionID\":\"%s\",\"buildID\":\"%s\"},{\"sessionID\":\"%s\",\"buildID\":\"NOT_A_GUID\"},{\"sessionID\":\"%s\",\"buildID\":\"%s\"}]}",
+			sessionID1, buildID1, sessionID2, buildID1, sessionID1, sessionID1, buildID1)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate/batch", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		h.handleBatchAllocationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var br BatchAllocateResponse
+		err = json.NewDecoder(res.Body).Decode(&br)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(br.Results).To(HaveLen(4))
+		// there is only one StandingBy server, so one of the first two allocations gets it and the other one gets a 429
+		Expect([]int{br.Results[0].StatusCode, br.Results[1].StatusCode}).To(ConsistOf(http.StatusOK, http.StatusTooManyRequests))
+		for i := 0; i < 2; i++ {
+			if br.Results[i].StatusCode == http.StatusOK {
+				Expect(br.Results[i].Response).ToNot(BeNil())
+				Expect(br.Results[i].Response.SessionID).To(Equal(br.Results[i].SessionID))
+			} else {
+				Expect(br.Results[i].Response).To(BeNil())
+				Expect(br.Results[i].Error).ToNot(BeEmpty())
+			}
+		}
+		Expect(br.Results[2].StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(br.Results[3].StatusCode).To(Equal(http.StatusConflict))
+	})
+	It("should return existing game servers for existing sessionIDs", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate/batch", bytes.NewBufferString(fmt.Sprintf("{\"allocations\":[{\"sessionID\":\"%s\",\"buildID\":\"%s\"}]}", sessionID1, buildID1)))
+		w := httptest.NewRecorder()
+		h.handleBatchAllocationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var br BatchAllocateResponse
+		err = json.NewDecoder(res.Body).Decode(&br)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(br.Results).To(HaveLen(1))
+		Expect(br.Results[0].StatusCode).To(Equal(http.StatusOK))
+		Expect(br.Results[0].Response.SessionID).To(Equal(sessionID1))
+	})
+})
+
+var _ = Describe("allocation API service build alias tests", func() {
+	const (
+		buildName1 string = "testbuild1"
+		buildName2 string = "testbuild2"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		buildID2   string = "1a9c6ae4-2a1b-4b3a-9b2f-6c1b4e0d8f7a"
+		aliasID    string = "5d1e8c3a-9f0b-4c6e-8a2d-7b3f1e4c9a60"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+	)
+
+	testCreateBuildAlias := func(client client.Client) {
+		ba := mpsv1alpha1.BuildAlias{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "testalias",
+				Namespace: "default",
+			},
+			Spec: mpsv1alpha1.BuildAliasSpec{
+				AliasID: aliasID,
+				Builds: []mpsv1alpha1.BuildAliasTarget{
+					{BuildID: buildID1, Weight: 1},
+					{BuildID: buildID2, Priority: 1},
+				},
+			},
+		}
+		Expect(client.Create(context.Background(), &ba)).To(Succeed())
+	}
+
+	It("should fall back to the next build if the first one has no standingBy servers", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, "gs-1", buildName1, buildID1, "", mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		gs, err := testCreateGameServerAndBuild(client, "gs-2", buildName2, buildID2, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		testCreateBuildAlias(client)
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            gs.Name,
+			Namespace:       gs.Namespace,
+			BuildID:         buildID2,
+			ResourceVersion: gs.ResourceVersion,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\"}", sessionID1, aliasID)))
+		w := httptest.NewRecorder()
+		h.handleAllocationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var gs2 mpsv1alpha1.GameServer
+		Expect(client.Get(context.Background(), types.NamespacedName{Namespace: gs.Namespace, Name: gs.Name}, &gs2)).To(Succeed())
+		Expect(gs2.Status.SessionID).To(Equal(sessionID1))
+
+		// allocating again with the same sessionID should return the existing game server
+		req = httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\"}", sessionID1, aliasID)))
+		w = httptest.NewRecorder()
+		h.handleAllocationRequest(w, req)
+		res2 := w.Result()
+		defer res2.Body.Close()
+		Expect(res2.StatusCode).To(Equal(http.StatusOK))
+	})
+	It("should return 429 if none of the builds have standingBy servers", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, "gs-1", buildName1, buildID1, "", mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		testCreateBuildAlias(client)
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\"}", sessionID1, aliasID)))
+		w := httptest.NewRecorder()
+		h.handleAllocationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusTooManyRequests))
+	})
 })
 
 var _ = Describe("allocation API service queue tests", func() {
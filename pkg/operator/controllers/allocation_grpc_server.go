@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	allocationv1 "github.com/playfab/thundernetes/pkg/operator/api/allocation/v1"
+)
+
+// AllocationGrpcServer is a helper struct that implements manager.Runnable interface
+// it serves the gRPC allocation API service, using the same queue and allocation logic as the HTTP allocation API service
+type AllocationGrpcServer struct {
+	allocationv1.UnimplementedAllocationServiceServer
+	// allocationApiServer is the HTTP allocation API service, whose queue and allocation logic are used
+	allocationApiServer *AllocationApiServer
+	// certWatcher provides the TLS certificates for mTLS, if nil the server runs without TLS
+	certWatcher   *CertificateWatcher
+	logger        logr.Logger
+	listeningPort int32
+}
+
+// NewAllocationGrpcServer returns a pointer to a new AllocationGrpcServer that allocates through the provided AllocationApiServer
+func NewAllocationGrpcServer(aas *AllocationApiServer, certWatcher *CertificateWatcher, port int32) *AllocationGrpcServer {
+	return &AllocationGrpcServer{
+		allocationApiServer: aas,
+		certWatcher:         certWatcher,
+		logger:              log.Log.WithName("allocation-grpc"),
+		listeningPort:       port,
+	}
+}
+
+// Start starts the gRPC allocation API service
+// if user has provided public/private cert details, it will require mTLS, the same way the HTTP allocation API service does
+func (g *AllocationGrpcServer) Start(ctx context.Context) error {
+	var opts []grpc.ServerOption
+	if g.certWatcher != nil {
+		g.logger.Info("starting TLS enabled gRPC allocation API service with dynamic certificate rotation")
+		opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{
+			GetCertificate:     g.certWatcher.GetCertificate,
+			GetConfigForClient: g.certWatcher.GetConfigForClient,
+			ClientAuth:         tls.RequireAndVerifyClientCert,
+		})))
+	} else {
+		g.logger.Info("starting insecure gRPC allocation API service")
+	}
+	var interceptors []grpc.UnaryServerInterceptor
+	if g.certWatcher != nil {
+		interceptors = append(interceptors, clientCertificateUnaryInterceptor)
+	}
+	if g.allocationApiServer.tokenAuthenticator != nil {
+		g.logger.Info("requiring token authentication for the gRPC allocation API service")
+		interceptors = append(interceptors, g.authUnaryInterceptor)
+	}
+	opts = append(opts, grpc.ChainUnaryInterceptor(interceptors...))
+	srv := grpc.NewServer(opts...)
+	allocationv1.RegisterAllocationServiceServer(srv, g)
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", g.listeningPort))
+	if err != nil {
+		return err
+	}
+	g.logger.Info("serving gRPC allocation API service", "port", g.listeningPort)
+
+	done := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		g.logger.Info("shutting down gRPC allocation API service")
+		srv.GracefulStop()
+		close(done)
+	}()
+
+	if err := srv.Serve(lis); err != nil {
+		return err
+	}
+	<-done
+	return nil
+}
+
+// authUnaryInterceptor authenticates calls with the bearer token of their authorization metadata
+// the CallerClaims are added to the context, so that the allocation logic can authorize the builds the same way it does for the HTTP service
+func (g *AllocationGrpcServer) authUnaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var header string
+	if values := md.Get("authorization"); len(values) > 0 {
+		header = values[0]
+	}
+	claims, err := g.allocationApiServer.tokenAuthenticator.authenticateAuthorizationHeader(header)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return handler(withCallerClaims(ctx, claims), req)
+}
+
+// Allocate allocates a StandingBy GameServer for a new game session
+func (g *AllocationGrpcServer) Allocate(ctx context.Context, req *allocationv1.AllocateRequest) (*allocationv1.AllocateResponse, error) {
+	args := allocateArgsFromRequest(req)
+	if !validateAllocateArgs(args) {
+		return nil, status.Error(codes.InvalidArgument, "invalid sessionID, buildID or waitTimeoutMs")
+	}
+	gs, err := g.allocationApiServer.allocate(ctx, args)
+	if err != nil {
+		return nil, allocationErrorToStatus(err)
+	}
+	return &allocationv1.AllocateResponse{
+		Ipv4Address: gs.Status.PublicIP,
+		Ports:       gs.Status.Ports,
+		SessionId:   args.SessionID,
+	}, nil
+}
+
+// BatchAllocate allocates multiple GameServers, every allocation is processed independently and gets its own result
+func (g *AllocationGrpcServer) BatchAllocate(ctx context.Context, req *allocationv1.BatchAllocateRequest) (*allocationv1.BatchAllocateResponse, error) {
+	if len(req.Allocations) == 0 || len(req.Allocations) > maxBatchAllocationSize {
+		return nil, status.Errorf(codes.InvalidArgument, "number of allocations must be between 1 and %d", maxBatchAllocationSize)
+	}
+	allocations := make([]AllocateArgs, len(req.Allocations))
+	for i, a := range req.Allocations {
+		allocations[i] = *allocateArgsFromRequest(a)
+	}
+	results := g.allocationApiServer.batchAllocate(ctx, allocations)
+
+	rs := &allocationv1.BatchAllocateResponse{Results: make([]*allocationv1.BatchAllocateResult, len(results))}
+	for i, r := range results {
+		rs.Results[i] = &allocationv1.BatchAllocateResult{
+			Code:      int32(httpStatusCodeToGrpcCode(r.StatusCode)),
+			SessionId: r.SessionID,
+			Error:     r.Error,
+		}
+		if r.Response != nil {
+			rs.Results[i].Response = &allocationv1.AllocateResponse{
+				Ipv4Address: r.Response.IPV4Address,
+				Ports:       r.Response.Ports,
+				SessionId:   r.Response.SessionID,
+			}
+		}
+	}
+	return rs, nil
+}
+
+// GetSession returns the details of the GameServer that hosts a game session
+func (g *AllocationGrpcServer) GetSession(ctx context.Context, req *allocationv1.GetSessionRequest) (*allocationv1.GetSessionResponse, error) {
+	if !isValidUUID(req.SessionId) {
+		return nil, status.Error(codes.InvalidArgument, "invalid sessionID")
+	}
+	gs, err := g.allocationApiServer.getGameServerForSession(ctx, req.SessionId)
+	if err != nil {
+		return nil, allocationErrorToStatus(err)
+	}
+	return &allocationv1.GetSessionResponse{
+		SessionId:      gs.Status.SessionID,
+		BuildId:        gs.Spec.BuildID,
+		GameServerName: gs.Name,
+		Namespace:      gs.Namespace,
+		State:          string(gs.Status.State),
+		Ipv4Address:    gs.Status.PublicIP,
+		Ports:          gs.Status.Ports,
+		NodeName:       gs.Status.NodeName,
+	}, nil
+}
+
+// allocateArgsFromRequest converts a gRPC AllocateRequest to AllocateArgs
+func allocateArgsFromRequest(req *allocationv1.AllocateRequest) *AllocateArgs {
+	return &AllocateArgs{
+		SessionID:       req.SessionId,
+		BuildID:         req.BuildId,
+		SessionCookie:   req.SessionCookie,
+		InitialPlayers:  req.InitialPlayers,
+		SessionMetadata: req.SessionMetadata,
+		WaitTimeoutMs:   int(req.WaitTimeoutMs),
+	}
+}
+
+// allocationErrorToStatus converts an error returned by the allocation logic to a gRPC status error
+func allocationErrorToStatus(err error) error {
+	return status.Error(httpStatusCodeToGrpcCode(getAllocationErrorStatusCode(err)), err.Error())
+}
+
+// httpStatusCodeToGrpcCode maps the HTTP status codes used by the allocation API service to gRPC codes
+func httpStatusCodeToGrpcCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	allocationv1 "github.com/playfab/thundernetes/pkg/operator/api/allocation/v1"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("gRPC allocation API service tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		sessionID2 string = "7b8e4f2a-3c1d-4e5f-9a6b-0c1d2e3f4a5b"
+		gsName     string = "testgs"
+	)
+
+	// testNewGrpcServer creates a StandingBy game server, pushes it to the queue and returns a gRPC server that allocates from it
+	testNewGrpcServer := func() *AllocationGrpcServer {
+		client := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            gs.Name,
+			Namespace:       gs.Namespace,
+			BuildID:         buildID1,
+			ResourceVersion: gs.ResourceVersion,
+		})
+		return NewAllocationGrpcServer(h, nil, 0)
+	}
+
+	It("should return InvalidArgument for invalid arguments", func() {
+		g := NewAllocationGrpcServer(NewAllocationApiServer(nil, nil, allocationApiSvcPort), nil, 0)
+		_, err := g.Allocate(context.Background(), &allocationv1.AllocateRequest{BuildId: buildID1, SessionId: "notAGuid"})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		_, err = g.GetSession(context.Background(), &allocationv1.GetSessionRequest{SessionId: "notAGuid"})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		_, err = g.BatchAllocate(context.Background(), &allocationv1.BatchAllocateRequest{})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+	It("should allocate a game server and return its session", func() {
+		g := testNewGrpcServer()
+		rs, err := g.Allocate(context.Background(), &allocationv1.AllocateRequest{BuildId: buildID1, SessionId: sessionID1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rs.SessionId).To(Equal(sessionID1))
+
+		session, err := g.GetSession(context.Background(), &allocationv1.GetSessionRequest{SessionId: sessionID1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(session.GameServerName).To(Equal(gsName))
+		Expect(session.State).To(Equal(string(mpsv1alpha1.GameServerStateActive)))
+
+		// there are no more StandingBy servers
+		_, err = g.Allocate(context.Background(), &allocationv1.AllocateRequest{BuildId: buildID1, SessionId: sessionID2})
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+	})
+	It("should return NotFound for a session that does not exist", func() {
+		g := testNewGrpcServer()
+		_, err := g.GetSession(context.Background(), &allocationv1.GetSessionRequest{SessionId: sessionID1})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+	It("should return a result for each allocation of a batch", func() {
+		g := testNewGrpcServer()
+		rs, err := g.BatchAllocate(context.Background(), &allocationv1.BatchAllocateRequest{
+			Allocations: []*allocationv1.AllocateRequest{
+				{BuildId: buildID1, SessionId: sessionID1},
+				{BuildId: buildID1, SessionId: sessionID1},
+				{BuildId: buildID1, SessionId: "notAGuid"},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rs.Results).To(HaveLen(3))
+		Expect(codes.Code(rs.Results[0].Code)).To(Equal(codes.OK))
+		Expect(rs.Results[0].Response.SessionId).To(Equal(sessionID1))
+		Expect(codes.Code(rs.Results[1].Code)).To(Equal(codes.Aborted))
+		Expect(codes.Code(rs.Results[2].Code)).To(Equal(codes.InvalidArgument))
+	})
+})
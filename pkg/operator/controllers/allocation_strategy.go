@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+// AllocationStrategy decides the order in which the StandingBy GameServers of a GameServerBuild are allocated
+type AllocationStrategy interface {
+	// Less returns true if gs1 should be allocated before gs2
+	Less(gs1, gs2 *GameServerForQueue, nu *NodeUtilization) bool
+	// usesNodeUtilization returns true if the order depends on the Active GameServers per Node or zone
+	// the queues that use such a strategy are sorted again every time the utilization changes
+	usesNodeUtilization() bool
+}
+
+// NewAllocationStrategy returns the AllocationStrategy configured in the provided GameServerBuildSpec
+func NewAllocationStrategy(spec *mpsv1alpha1.GameServerBuildSpec) AllocationStrategy {
+	switch spec.AllocationStrategy {
+	case mpsv1alpha1.AllocationStrategyPacked:
+		return packedStrategy{}
+	case mpsv1alpha1.AllocationStrategyDistributed:
+		return distributedStrategy{}
+	case mpsv1alpha1.AllocationStrategyWeighted:
+		if spec.WeightedAllocation == nil {
+			return weightedStrategy{nodeAgeWeight: 1, nodeUtilizationWeight: 1, zoneWeight: 1}
+		}
+		return weightedStrategy{
+			nodeAgeWeight:         spec.WeightedAllocation.NodeAgeWeight,
+			nodeUtilizationWeight: spec.WeightedAllocation.NodeUtilizationWeight,
+			zoneWeight:            spec.WeightedAllocation.ZoneWeight,
+		}
+	default:
+		return nodeAgeStrategy{}
+	}
+}
+
+// nodeAgeStrategy prefers GameServers on newer Nodes (smaller NodeAge)
+// so that older Nodes are more likely to become empty and get scaled down
+type nodeAgeStrategy struct{}
+
+// Less returns true if gs1 is on a newer Node than gs2
+func (nodeAgeStrategy) Less(gs1, gs2 *GameServerForQueue, _ *NodeUtilization) bool {
+	return gs1.NodeAge < gs2.NodeAge
+}
+
+func (nodeAgeStrategy) usesNodeUtilization() bool {
+	return false
+}
+
+// packedStrategy prefers GameServers on the Nodes with the most Active GameServers
+// so that the rest of the Nodes are more likely to become empty and get scaled down
+type packedStrategy struct{}
+
+// Less returns true if gs1 is on a busier Node than gs2, using NodeAge as a tie breaker
+func (packedStrategy) Less(gs1, gs2 *GameServerForQueue, nu *NodeUtilization) bool {
+	a1, a2 := nu.activeOnNode(gs1.NodeName), nu.activeOnNode(gs2.NodeName)
+	if a1 != a2 {
+		return a1 > a2
+	}
+	return gs1.NodeAge < gs2.NodeAge
+}
+
+func (packedStrategy) usesNodeUtilization() bool {
+	return true
+}
+
+// distributedStrategy prefers GameServers on the zones and Nodes with the fewest Active GameServers
+// so that Active GameServers are spread across failure domains
+type distributedStrategy struct{}
+
+// Less returns true if gs1 is on a less busy zone than gs2, then on a less busy Node, using NodeAge as a tie breaker
+func (distributedStrategy) Less(gs1, gs2 *GameServerForQueue, nu *NodeUtilization) bool {
+	z1, z2 := nu.activeInZone(gs1.Zone), nu.activeInZone(gs2.Zone)
+	if z1 != z2 {
+		return z1 < z2
+	}
+	a1, a2 := nu.activeOnNode(gs1.NodeName), nu.activeOnNode(gs2.NodeName)
+	if a1 != a2 {
+		return a1 < a2
+	}
+	return gs1.NodeAge < gs2.NodeAge
+}
+
+func (distributedStrategy) usesNodeUtilization() bool {
+	return true
+}
+
+// weightedStrategy gives each GameServer a score based on the Node age, the Node utilization and the zone utilization
+// GameServers with a lower score are allocated first
+type weightedStrategy struct {
+	nodeAgeWeight         int
+	nodeUtilizationWeight int
+	zoneWeight            int
+}
+
+// Less returns true if gs1 has a lower score than gs2
+func (s weightedStrategy) Less(gs1, gs2 *GameServerForQueue, nu *NodeUtilization) bool {
+	return s.score(gs1, nu) < s.score(gs2, nu)
+}
+
+// usesNodeUtilization returns false if only the Node age is weighted
+func (s weightedStrategy) usesNodeUtilization() bool {
+	return s.nodeUtilizationWeight != 0 || s.zoneWeight != 0
+}
+
+// score returns the score of the provided GameServer
+func (s weightedStrategy) score(gs *GameServerForQueue, nu *NodeUtilization) int {
+	return s.nodeAgeWeight*gs.NodeAge -
+		s.nodeUtilizationWeight*nu.activeOnNode(gs.NodeName) +
+		s.zoneWeight*nu.activeInZone(gs.Zone)
+}
+
+// NodeUtilization keeps track of the number of Active GameServers on each Node and zone
+// it is not safe for concurrent use, GameServersQueue protects it with its mutex
+type NodeUtilization struct {
+	// activeGameServers is a map of the namespaced name of each Active GameServer to its Node and zone
+	activeGameServers map[string]nodeAndZone
+	activePerNode     map[string]int
+	activePerZone     map[string]int
+	// version is incremented every time the utilization changes
+	// it is used by the queues to know when they need to re-sort their GameServers
+	version uint64
+}
+
+// nodeAndZone contains the Node name and the zone a GameServer is running on
+type nodeAndZone struct {
+	nodeName string
+	zone     string
+}
+
+// NewNodeUtilization returns a new NodeUtilization
+func NewNodeUtilization() *NodeUtilization {
+	return &NodeUtilization{
+		activeGameServers: make(map[string]nodeAndZone),
+		activePerNode:     make(map[string]int),
+		activePerZone:     make(map[string]int),
+	}
+}
+
+// setActive records that the GameServer with the provided namespaced name is Active on the provided Node and zone
+func (nu *NodeUtilization) setActive(namespacedName, nodeName, zone string) {
+	if _, exists := nu.activeGameServers[namespacedName]; exists {
+		return
+	}
+	nu.activeGameServers[namespacedName] = nodeAndZone{nodeName: nodeName, zone: zone}
+	nu.activePerNode[nodeName]++
+	if zone != "" {
+		nu.activePerZone[zone]++
+	}
+	nu.version++
+}
+
+// remove records that the GameServer with the provided namespaced name is no longer Active
+func (nu *NodeUtilization) remove(namespacedName string) {
+	nz, exists := nu.activeGameServers[namespacedName]
+	if !exists {
+		return
+	}
+	delete(nu.activeGameServers, namespacedName)
+	if nu.activePerNode[nz.nodeName]--; nu.activePerNode[nz.nodeName] == 0 {
+		delete(nu.activePerNode, nz.nodeName)
+	}
+	if nz.zone != "" {
+		if nu.activePerZone[nz.zone]--; nu.activePerZone[nz.zone] == 0 {
+			delete(nu.activePerZone, nz.zone)
+		}
+	}
+	nu.version++
+}
+
+// activeOnNode returns the number of Active GameServers on the provided Node
+func (nu *NodeUtilization) activeOnNode(nodeName string) int {
+	if nu == nil {
+		return 0
+	}
+	return nu.activePerNode[nodeName]
+}
+
+// activeInZone returns the number of Active GameServers in the provided zone
+func (nu *NodeUtilization) activeInZone(zone string) int {
+	if nu == nil || zone == "" {
+		return 0
+	}
+	return nu.activePerZone[zone]
+}
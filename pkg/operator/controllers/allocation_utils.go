@@ -1,11 +1,16 @@
 package controllers
 
 import (
+	"errors"
 	"html"
 	"net/http"
 	"regexp"
+	"sort"
+	"time"
 
 	"github.com/go-logr/logr"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 )
 
 // AllocateArgs contains information necessary to allocate a GameServer
@@ -14,6 +19,11 @@ type AllocateArgs struct {
 	BuildID        string   `json:"buildID"`
 	SessionCookie  string   `json:"sessionCookie"`
 	InitialPlayers []string `json:"initialPlayers"`
+	// SessionMetadata is an optional set of key/value pairs that is passed to the game server process
+	SessionMetadata map[string]string `json:"sessionMetadata"`
+	// WaitTimeoutMs is an optional number of milliseconds to wait for a StandingBy server to become available
+	// if there is none at the time of the request. If it is zero, a 429 is returned immediately
+	WaitTimeoutMs int `json:"waitTimeoutMs"`
 }
 
 // isValidUUID returns true if the string is a valid UUID
@@ -27,9 +37,61 @@ func validateAllocateArgs(aa *AllocateArgs) bool {
 	if !isValidUUID(aa.SessionID) || !isValidUUID(aa.BuildID) {
 		return false
 	}
+	if aa.WaitTimeoutMs < 0 || time.Duration(aa.WaitTimeoutMs)*time.Millisecond > maxAllocationWaitTimeout {
+		return false
+	}
 	return true
 }
 
+// getBuildIDsFromAlias returns the BuildIDs of the provided BuildAlias in the order they should be tried during allocation
+// builds are grouped by priority, lower priority first. Within each group, builds are ordered by a weighted random pick
+// and builds with zero weight are placed last, in the order they are declared
+// intn is used to pick random numbers, it should behave like rand.Intn
+func getBuildIDsFromAlias(ba *mpsv1alpha1.BuildAlias, intn func(int) int) []string {
+	targets := make([]mpsv1alpha1.BuildAliasTarget, len(ba.Spec.Builds))
+	copy(targets, ba.Spec.Builds)
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].Priority < targets[j].Priority
+	})
+
+	buildIDs := make([]string, 0, len(targets))
+	for start := 0; start < len(targets); {
+		// find all builds with the same priority
+		end := start
+		for end < len(targets) && targets[end].Priority == targets[start].Priority {
+			end++
+		}
+		var weighted, fallback []mpsv1alpha1.BuildAliasTarget
+		totalWeight := 0
+		for _, t := range targets[start:end] {
+			if t.Weight > 0 {
+				weighted = append(weighted, t)
+				totalWeight += t.Weight
+			} else {
+				fallback = append(fallback, t)
+			}
+		}
+		// pick builds one by one using their weights, removing each one after it is picked
+		for len(weighted) > 0 {
+			r := intn(totalWeight)
+			for i, t := range weighted {
+				if r < t.Weight {
+					buildIDs = append(buildIDs, t.BuildID)
+					totalWeight -= t.Weight
+					weighted = append(weighted[:i], weighted[i+1:]...)
+					break
+				}
+				r -= t.Weight
+			}
+		}
+		for _, t := range fallback {
+			buildIDs = append(buildIDs, t.BuildID)
+		}
+		start = end
+	}
+	return buildIDs
+}
+
 // RequestMultiplayerServerResponse contains details that are returned on a successful GameServer allocation call
 type RequestMultiplayerServerResponse struct {
 	IPV4Address string
@@ -37,6 +99,132 @@ type RequestMultiplayerServerResponse struct {
 	SessionID   string
 }
 
+// AllocateResponseV2 contains details that are returned on a successful GameServer allocation call on the v2 route
+type AllocateResponseV2 struct {
+	SessionID   string
+	IPV4Address string
+	// FQDN is the external DNS name of the Node the GameServer runs on, if it has one
+	FQDN           string `json:",omitempty"`
+	Ports          []AllocatedPort
+	GameServerName string
+	Namespace      string
+	NodeName       string
+	BuildName      string
+}
+
+// AllocatedPort contains the details of a port that is exposed by an allocated GameServer
+type AllocatedPort struct {
+	Name     string
+	Protocol corev1.Protocol
+	// ClientPort is the port that clients should connect to
+	ClientPort int32
+	// ServerPort is the port the game server process listens to
+	ServerPort int32
+}
+
+// getAllocatedPorts returns the details of the ports that are exposed by the provided GameServer
+// only the ports that have been assigned a host port are returned
+func getAllocatedPorts(gs *mpsv1alpha1.GameServer) []AllocatedPort {
+	ports := make([]AllocatedPort, 0, len(gs.Spec.PortsToExpose))
+	for _, container := range gs.Spec.Template.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.HostPort == 0 {
+				continue
+			}
+			protocol := port.Protocol
+			if protocol == "" {
+				protocol = corev1.ProtocolTCP
+			}
+			ports = append(ports, AllocatedPort{
+				Name:       port.Name,
+				Protocol:   protocol,
+				ClientPort: port.HostPort,
+				ServerPort: port.ContainerPort,
+			})
+		}
+	}
+	return ports
+}
+
+// BatchAllocateArgs contains a list of allocations that are requested in a single call
+type BatchAllocateArgs struct {
+	Allocations []AllocateArgs `json:"allocations"`
+}
+
+// BatchAllocateResult contains the result of a single allocation in a batch allocation call
+type BatchAllocateResult struct {
+	StatusCode int
+	SessionID  string
+	Response   *RequestMultiplayerServerResponse `json:",omitempty"`
+	Error      string                            `json:",omitempty"`
+}
+
+// BatchAllocateResponse contains the results of a batch allocation call, in the same order as the requested allocations
+type BatchAllocateResponse struct {
+	Results []BatchAllocateResult
+}
+
+// allocationError is an error that happened during allocation, along with the HTTP status code that should be returned to the client
+type allocationError struct {
+	statusCode int
+	msg        string
+	err        error
+}
+
+// newAllocationError returns a new allocationError
+func newAllocationError(statusCode int, err error, msg string) *allocationError {
+	return &allocationError{
+		statusCode: statusCode,
+		msg:        msg,
+		err:        err,
+	}
+}
+
+// Error returns the message along with the underlying error
+func (e *allocationError) Error() string {
+	return e.msg + " " + e.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *allocationError) Unwrap() error {
+	return e.err
+}
+
+// getAllocationErrorStatusCode returns the HTTP status code for the provided error
+// errors that are not of type *allocationError are considered internal server errors
+func getAllocationErrorStatusCode(err error) int {
+	var ae *allocationError
+	if errors.As(err, &ae) {
+		return ae.statusCode
+	}
+	return http.StatusInternalServerError
+}
+
+// writeAllocationError writes the provided error to the response using the helper for its status code
+func writeAllocationError(w http.ResponseWriter, l logr.Logger, err error) {
+	var ae *allocationError
+	if !errors.As(err, &ae) {
+		internalServerError(w, l, err, "error allocating")
+		return
+	}
+	switch ae.statusCode {
+	case http.StatusBadRequest:
+		badRequestError(w, l, ae.err, ae.msg)
+	case http.StatusForbidden:
+		forbiddenError(w, l, ae.err, ae.msg)
+	case http.StatusNotFound:
+		notFoundError(w, l, ae.err, ae.msg)
+	case http.StatusConflict:
+		conflictError(w, l, ae.err, ae.msg)
+	case http.StatusTooManyRequests:
+		tooManyRequestsError(w, l, ae.err, ae.msg)
+	case http.StatusGatewayTimeout:
+		gatewayTimeoutError(w, l, ae.err, ae.msg)
+	default:
+		internalServerError(w, l, ae.err, ae.msg)
+	}
+}
+
 // internalServerError is a helper function for returning an internal server error
 func internalServerError(w http.ResponseWriter, l logr.Logger, err error, msg string) {
 	l.Error(err, msg)
@@ -58,9 +246,37 @@ func tooManyRequestsError(w http.ResponseWriter, l logr.Logger, err error, msg s
 	w.Write([]byte("429 - " + html.EscapeString(msg) + " " + html.EscapeString(err.Error())))
 }
 
+// gatewayTimeoutError is a helper function for returning a gateway timeout error
+func gatewayTimeoutError(w http.ResponseWriter, l logr.Logger, err error, msg string) {
+	l.Error(err, msg)
+	w.WriteHeader(http.StatusGatewayTimeout)
+	w.Write([]byte("504 - " + html.EscapeString(msg) + " " + html.EscapeString(err.Error())))
+}
+
+// conflictError is a helper function for returning a conflict error
+func conflictError(w http.ResponseWriter, l logr.Logger, err error, msg string) {
+	l.Info(msg)
+	w.WriteHeader(http.StatusConflict)
+	w.Write([]byte("409 - " + html.EscapeString(msg) + " " + html.EscapeString(err.Error())))
+}
+
 // notFoundError is a helper function for returning a not found error
 func notFoundError(w http.ResponseWriter, l logr.Logger, err error, msg string) {
 	l.Info(msg)
 	w.WriteHeader(http.StatusNotFound)
 	w.Write([]byte("404 - " + html.EscapeString(msg) + " " + html.EscapeString(err.Error())))
 }
+
+// unauthorizedError is a helper function for returning an unauthorized error
+func unauthorizedError(w http.ResponseWriter, l logr.Logger, err error, msg string) {
+	l.Info(msg)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte("401 - " + html.EscapeString(msg) + " " + html.EscapeString(err.Error())))
+}
+
+// forbiddenError is a helper function for returning a forbidden error
+func forbiddenError(w http.ResponseWriter, l logr.Logger, err error, msg string) {
+	l.Info(msg)
+	w.WriteHeader(http.StatusForbidden)
+	w.Write([]byte("403 - " + html.EscapeString(msg) + " " + html.EscapeString(err.Error())))
+}
@@ -1,8 +1,12 @@
 package controllers
 
 import (
+	"errors"
+	"net/http"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
 )
 
 var _ = Describe("types tests", func() {
@@ -24,4 +28,33 @@ var _ = Describe("types tests", func() {
 			BuildID:   "WRONG",
 		})).To(BeFalse())
 	})
+	It("should return false on a negative waitTimeoutMs", func() {
+		Expect(validateAllocateArgs(&AllocateArgs{
+			SessionID:     "396022c2-caed-4bdf-98bb-521f2dc4f2f3",
+			BuildID:       "b1b2d3e4-567f-4e4b-8f8b-f3a4b4a5b8e5",
+			WaitTimeoutMs: -1,
+		})).To(BeFalse())
+	})
+	It("should order the builds of a BuildAlias by priority and weight", func() {
+		ba := &mpsv1alpha1.BuildAlias{
+			Spec: mpsv1alpha1.BuildAliasSpec{
+				Builds: []mpsv1alpha1.BuildAliasTarget{
+					{BuildID: "fallback", Priority: 1},
+					{BuildID: "canary", Weight: 10},
+					{BuildID: "stable", Weight: 90},
+					{BuildID: "disabled"},
+				},
+			},
+		}
+		// picking the lowest number selects the first weighted build
+		Expect(getBuildIDsFromAlias(ba, func(int) int { return 0 })).To(Equal([]string{"canary", "stable", "disabled", "fallback"}))
+		// picking the highest number selects the last weighted build
+		Expect(getBuildIDsFromAlias(ba, func(n int) int { return n - 1 })).To(Equal([]string{"stable", "canary", "disabled", "fallback"}))
+		// the BuildAlias should not be modified
+		Expect(ba.Spec.Builds[0].BuildID).To(Equal("fallback"))
+	})
+	It("should return the status code of an allocation error", func() {
+		Expect(getAllocationErrorStatusCode(newAllocationError(http.StatusTooManyRequests, errors.New("test"), "test"))).To(Equal(http.StatusTooManyRequests))
+		Expect(getAllocationErrorStatusCode(errors.New("test"))).To(Equal(http.StatusInternalServerError))
+	})
 })
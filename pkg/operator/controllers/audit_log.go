@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+// kinds of audit sinks, used by the ALLOCATION_AUDIT_SINK environment variable
+const (
+	AuditSinkFile   = "file"
+	AuditSinkMemory = "memory"
+)
+
+// operations of the allocation audit records
+const (
+	auditOperationAllocate = "Allocate"
+	auditOperationReserve  = "Reserve"
+)
+
+const (
+	// defaultAuditQueryLimit is the number of records returned by an audit query that does not specify a limit
+	defaultAuditQueryLimit = 100
+	// maxAuditQueryLimit is the maximum number of records returned by an audit query
+	maxAuditQueryLimit = 1000
+)
+
+// AllocationAuditRecord is the record of an allocation attempt
+type AllocationAuditRecord struct {
+	Time time.Time `json:"time"`
+	// Operation is either Allocate or Reserve
+	Operation string `json:"operation"`
+	// Caller is the identity of the caller, if it was authenticated with a client certificate or a token
+	Caller string `json:"caller,omitempty"`
+	// BuildID is the requested BuildID or AliasID
+	BuildID   string `json:"buildID"`
+	SessionID string `json:"sessionID"`
+	// GameServerName and Namespace identify the GameServer that was allocated, if the attempt succeeded
+	GameServerName string `json:"gameServerName,omitempty"`
+	Namespace      string `json:"namespace,omitempty"`
+	// Retries is the number of times the allocation was retried because the GameServer could not be patched
+	Retries   int   `json:"retries"`
+	LatencyMs int64 `json:"latencyMs"`
+	// StatusCode is the HTTP status code of the result, 200 if the attempt succeeded
+	StatusCode int    `json:"statusCode"`
+	Error      string `json:"error,omitempty"`
+}
+
+// AuditQuery contains the filters of a query for allocation audit records, empty filters match all records
+type AuditQuery struct {
+	From      time.Time
+	To        time.Time
+	BuildID   string
+	SessionID string
+	Caller    string
+	// Limit is the maximum number of records to return, the most recent ones are returned
+	Limit int
+}
+
+// matches returns true if the provided record matches all the filters of the query
+func (q *AuditQuery) matches(r *AllocationAuditRecord) bool {
+	return (q.From.IsZero() || !r.Time.Before(q.From)) &&
+		(q.To.IsZero() || r.Time.Before(q.To)) &&
+		(q.BuildID == "" || r.BuildID == q.BuildID) &&
+		(q.SessionID == "" || r.SessionID == q.SessionID) &&
+		(q.Caller == "" || r.Caller == q.Caller)
+}
+
+// AuditSink stores allocation audit records and queries them
+type AuditSink interface {
+	// Write stores the provided record
+	Write(record *AllocationAuditRecord) error
+	// Query returns the records that match the provided query, most recent first
+	Query(q *AuditQuery) ([]AllocationAuditRecord, error)
+}
+
+// NewAuditSink returns a new AuditSink of the provided kind
+// path, maxFileSizeMB and maxFiles configure the file sink, maxRecords configures the memory sink
+func NewAuditSink(kind, path string, maxFileSizeMB, maxFiles, maxRecords int) (AuditSink, error) {
+	switch kind {
+	case AuditSinkFile:
+		return NewFileAuditSink(path, int64(maxFileSizeMB)*1024*1024, maxFiles)
+	case AuditSinkMemory:
+		return NewMemoryAuditSink(maxRecords)
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q, expected %s or %s", kind, AuditSinkFile, AuditSinkMemory)
+	}
+}
+
+// FileAuditSink writes allocation audit records to a JSON Lines file, which is rotated when it reaches its maximum size
+// rotated files are named after the file with a numeric suffix, e.g. allocations.jsonl.1 is the most recent one
+type FileAuditSink struct {
+	mu           sync.Mutex
+	path         string
+	maxSizeBytes int64
+	// maxFiles is the number of rotated files that are kept, in addition to the current one
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+// NewFileAuditSink returns a new FileAuditSink that appends records to the file with the provided path, creating it if needed
+func NewFileAuditSink(path string, maxSizeBytes int64, maxFiles int) (*FileAuditSink, error) {
+	if path == "" {
+		return nil, errors.New("audit file path is required")
+	}
+	if maxSizeBytes <= 0 || maxFiles < 0 {
+		return nil, errors.New("invalid audit file configuration, maximum size must be positive and maximum files non-negative")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	fs := &FileAuditSink{
+		path:         path,
+		maxSizeBytes: maxSizeBytes,
+		maxFiles:     maxFiles,
+	}
+	if err := fs.open(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// open opens the current file for appending, caller should hold the mutex
+func (fs *FileAuditSink) open() error {
+	f, err := os.OpenFile(fs.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	fs.file = f
+	fs.size = fi.Size()
+	return nil
+}
+
+// Write appends the record to the current file, rotating it first if it would exceed the maximum size
+func (fs *FileAuditSink) Write(record *AllocationAuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.size > 0 && fs.size+int64(len(line)) > fs.maxSizeBytes {
+		if err := fs.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := fs.file.Write(line)
+	fs.size += int64(n)
+	return err
+}
+
+// rotate renames the current file and the rotated ones, deleting the oldest one, and opens a new current file
+// caller should hold the mutex
+func (fs *FileAuditSink) rotate() error {
+	if err := fs.file.Close(); err != nil {
+		return err
+	}
+	if fs.maxFiles == 0 {
+		if err := os.Remove(fs.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return fs.open()
+	}
+	if err := os.Remove(fs.rotatedPath(fs.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := fs.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(fs.rotatedPath(i), fs.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(fs.path, fs.rotatedPath(1)); err != nil {
+		return err
+	}
+	return fs.open()
+}
+
+// rotatedPath returns the path of the rotated file with the provided index
+func (fs *FileAuditSink) rotatedPath(i int) string {
+	return fs.path + "." + strconv.Itoa(i)
+}
+
+// Query reads the current and the rotated files and returns the records that match the query, most recent first
+// the files are only opened while holding the mutex, since rotating renames them they can be read while records are written
+func (fs *FileAuditSink) Query(q *AuditQuery) ([]AllocationAuditRecord, error) {
+	files, err := fs.openFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	c := newAuditRecordCollector(q)
+	for _, f := range files {
+		if err := readAuditFile(f, c); err != nil {
+			return nil, err
+		}
+	}
+	return c.mostRecent(), nil
+}
+
+// openFiles opens the rotated and the current files for reading, oldest first, so the records are read in the order they were written
+// missing files are skipped
+func (fs *FileAuditSink) openFiles() ([]*os.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	paths := []string{fs.path}
+	for i := 1; i <= fs.maxFiles; i++ {
+		paths = append([]string{fs.rotatedPath(i)}, paths...)
+	}
+	files := make([]*os.File, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// readAuditFile adds the records of the provided file to the collector, lines that cannot be parsed are skipped
+func readAuditFile(f *os.File, c *auditRecordCollector) error {
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r AllocationAuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		c.add(&r)
+	}
+	return scanner.Err()
+}
+
+// MemoryAuditSink keeps the most recent allocation audit records in memory
+// records are lost when the controller restarts
+type MemoryAuditSink struct {
+	mu      sync.Mutex
+	records []AllocationAuditRecord
+	// next is the index of records the next record is written to, once the buffer is full
+	next       int
+	maxRecords int
+}
+
+// NewMemoryAuditSink returns a new MemoryAuditSink that keeps up to maxRecords records
+func NewMemoryAuditSink(maxRecords int) (*MemoryAuditSink, error) {
+	if maxRecords < 1 {
+		return nil, errors.New("maximum audit records must be positive")
+	}
+	return &MemoryAuditSink{
+		records:    make([]AllocationAuditRecord, 0, maxRecords),
+		maxRecords: maxRecords,
+	}, nil
+}
+
+// Write stores the record, replacing the oldest one if the buffer is full
+func (ms *MemoryAuditSink) Write(record *AllocationAuditRecord) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if len(ms.records) < ms.maxRecords {
+		ms.records = append(ms.records, *record)
+		return nil
+	}
+	ms.records[ms.next] = *record
+	ms.next = (ms.next + 1) % ms.maxRecords
+	return nil
+}
+
+// Query returns the stored records that match the query, most recent first
+func (ms *MemoryAuditSink) Query(q *AuditQuery) ([]AllocationAuditRecord, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	c := newAuditRecordCollector(q)
+	// the oldest record is at next once the buffer is full
+	for i := 0; i < len(ms.records); i++ {
+		c.add(&ms.records[(ms.next+i)%len(ms.records)])
+	}
+	return c.mostRecent(), nil
+}
+
+// auditRecordCollector keeps the most recent records that match a query, up to the limit of the query
+// records should be added in the order they were written, so that only limit records are kept in memory
+type auditRecordCollector struct {
+	q       *AuditQuery
+	records []AllocationAuditRecord
+	// next is the index of records the next record is written to, once the limit is reached
+	next int
+}
+
+// newAuditRecordCollector returns a new auditRecordCollector for the provided query
+func newAuditRecordCollector(q *AuditQuery) *auditRecordCollector {
+	return &auditRecordCollector{q: q}
+}
+
+// add keeps the provided record if it matches the query, replacing the oldest one if the limit is reached
+func (c *auditRecordCollector) add(r *AllocationAuditRecord) {
+	if !c.q.matches(r) {
+		return
+	}
+	if c.q.Limit <= 0 || len(c.records) < c.q.Limit {
+		c.records = append(c.records, *r)
+		return
+	}
+	c.records[c.next] = *r
+	c.next = (c.next + 1) % len(c.records)
+}
+
+// mostRecent returns the kept records, most recent first
+func (c *auditRecordCollector) mostRecent() []AllocationAuditRecord {
+	result := make([]AllocationAuditRecord, len(c.records))
+	for i := range c.records {
+		result[i] = c.records[(c.next+len(c.records)-1-i)%len(c.records)]
+	}
+	return result
+}
+
+// recordAllocation writes an audit record for an allocation attempt, if the audit log is enabled
+// errors are only logged, so that the audit log never fails an allocation
+func (s *AllocationApiServer) recordAllocation(ctx context.Context, args *AllocateArgs, reservation bool, gs *mpsv1alpha1.GameServer, err error, retries int, latency time.Duration) {
+	if s.auditSink == nil {
+		return
+	}
+	record := &AllocationAuditRecord{
+		Time:       time.Now().UTC(),
+		Operation:  auditOperationAllocate,
+		Caller:     callerIdentityFromContext(ctx),
+		BuildID:    args.BuildID,
+		SessionID:  args.SessionID,
+		Retries:    retries,
+		LatencyMs:  latency.Milliseconds(),
+		StatusCode: http.StatusOK,
+	}
+	if reservation {
+		record.Operation = auditOperationReserve
+	}
+	if err != nil {
+		record.StatusCode = getAllocationErrorStatusCode(err)
+		record.Error = err.Error()
+	} else {
+		record.GameServerName = gs.Name
+		record.Namespace = gs.Namespace
+	}
+	if err := s.auditSink.Write(record); err != nil {
+		s.logger.Error(err, "error writing allocation audit record", "sessionID", args.SessionID, "buildID", args.BuildID)
+	}
+}
+
+// AuditQueryResponse contains the records that match the filters of an audit query
+type AuditQueryResponse struct {
+	Records []AllocationAuditRecord
+}
+
+// handleAuditQueryRequest returns the allocation audit records, optionally filtered by the from and to (RFC 3339 times), buildID and sessionID query parameters
+// callers that were authenticated with a token only see their own records
+func (s *AllocationApiServer) handleAuditQueryRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		badRequestError(w, s.logger, errors.New("invalid method"), "Only GET is accepted")
+		return
+	}
+
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		badRequestError(w, s.logger, err, "invalid arguments")
+		return
+	}
+	if claims := callerClaimsFromContext(r.Context()); claims != nil {
+		q.Caller = claims.Subject
+	}
+
+	records, err := s.auditSink.Query(q)
+	if err != nil {
+		internalServerError(w, s.logger, err, "error querying audit records")
+		return
+	}
+	if records == nil {
+		records = make([]AllocationAuditRecord, 0)
+	}
+	if err := json.NewEncoder(w).Encode(AuditQueryResponse{Records: records}); err != nil {
+		internalServerError(w, s.logger, err, "encode json response")
+	}
+}
+
+// parseAuditQuery parses the query parameters of an audit query request
+func parseAuditQuery(r *http.Request) (*AuditQuery, error) {
+	query := r.URL.Query()
+	q := &AuditQuery{
+		BuildID:   query.Get("buildID"),
+		SessionID: query.Get("sessionID"),
+		Limit:     defaultAuditQueryLimit,
+	}
+	if q.BuildID != "" && !isValidUUID(q.BuildID) {
+		return nil, errors.New("invalid buildID")
+	}
+	if q.SessionID != "" && !isValidUUID(q.SessionID) {
+		return nil, errors.New("invalid sessionID")
+	}
+	var err error
+	if from := query.Get("from"); from != "" {
+		if q.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if q.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit < 1 || q.Limit > maxAuditQueryLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxAuditQueryLimit)
+		}
+	}
+	return q, nil
+}
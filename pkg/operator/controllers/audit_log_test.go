@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+var _ = Describe("allocation audit log tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		buildID2   string = "5a4f5c3e-8d8b-4c39-9d1e-2a1f0b6c7d8e"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		sessionID2 string = "7b8e4f2a-3c1d-4e5f-9a6b-0c1d2e3f4a5b"
+		gsName     string = "testgs"
+	)
+
+	baseTime := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	newRecord := func(minutes int, buildID, sessionID string) *AllocationAuditRecord {
+		return &AllocationAuditRecord{
+			Time:       baseTime.Add(time.Duration(minutes) * time.Minute),
+			Operation:  auditOperationAllocate,
+			BuildID:    buildID,
+			SessionID:  sessionID,
+			StatusCode: http.StatusOK,
+		}
+	}
+	sessionIDs := func(records []AllocationAuditRecord) []string {
+		var ids []string
+		for _, r := range records {
+			ids = append(ids, r.SessionID)
+		}
+		return ids
+	}
+
+	It("should reject invalid configuration", func() {
+		_, err := NewAuditSink("database", "", 0, 0, 0)
+		Expect(err).To(HaveOccurred())
+		_, err = NewAuditSink(AuditSinkFile, "", 100, 5, 0)
+		Expect(err).To(HaveOccurred())
+		_, err = NewAuditSink(AuditSinkFile, filepath.Join(GinkgoT().TempDir(), "allocations.jsonl"), 0, 5, 0)
+		Expect(err).To(HaveOccurred())
+		_, err = NewAuditSink(AuditSinkMemory, "", 0, 0, 0)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should rotate the audit file and query the rotated files", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "audit", "allocations.jsonl")
+		line, err := json.Marshal(newRecord(0, buildID1, sessionID1))
+		Expect(err).ToNot(HaveOccurred())
+		// every file fits two records
+		fs, err := NewFileAuditSink(path, int64(2*(len(line)+1)), 2)
+		Expect(err).ToNot(HaveOccurred())
+		sessions := []string{sessionID1, sessionID2, sessionID1, sessionID2, sessionID1, sessionID2, sessionID1}
+		for i, sessionID := range sessions {
+			Expect(fs.Write(newRecord(i, buildID1, sessionID))).To(Succeed())
+		}
+		// the current file and two rotated files are kept, so the first file with two records was deleted
+		_, err = os.Stat(fs.rotatedPath(3))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		records, err := fs.Query(&AuditQuery{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(5))
+		Expect(records[0].Time).To(Equal(baseTime.Add(6 * time.Minute)))
+		Expect(records[4].Time).To(Equal(baseTime.Add(2 * time.Minute)))
+
+		records, err = fs.Query(&AuditQuery{SessionID: sessionID1, Limit: 2})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(2))
+		Expect(records[0].Time).To(Equal(baseTime.Add(6 * time.Minute)))
+		Expect(records[1].Time).To(Equal(baseTime.Add(4 * time.Minute)))
+
+		// records are appended to the existing file when the sink is created again
+		fs2, err := NewFileAuditSink(path, int64(2*(len(line)+1)), 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fs2.Write(newRecord(7, buildID1, sessionID2))).To(Succeed())
+		records, err = fs2.Query(&AuditQuery{From: baseTime.Add(6 * time.Minute)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sessionIDs(records)).To(Equal([]string{sessionID2, sessionID1}))
+	})
+	It("should query the audit files while records are written and rotated", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "allocations.jsonl")
+		line, err := json.Marshal(newRecord(0, buildID1, sessionID1))
+		Expect(err).ToNot(HaveOccurred())
+		fs, err := NewFileAuditSink(path, int64(10*(len(line)+1)), 3)
+		Expect(err).ToNot(HaveOccurred())
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			for i := 0; i < 200; i++ {
+				Expect(fs.Write(newRecord(i, buildID1, sessionID1))).To(Succeed())
+			}
+		}()
+		for i := 0; i < 20; i++ {
+			records, err := fs.Query(&AuditQuery{Limit: 5})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(records)).To(BeNumerically("<=", 5))
+			for j := 1; j < len(records); j++ {
+				Expect(records[j].Time.Before(records[j-1].Time)).To(BeTrue())
+			}
+		}
+		Eventually(done).Should(BeClosed())
+		records, err := fs.Query(&AuditQuery{Limit: 5})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(5))
+		Expect(records[0].Time).To(Equal(baseTime.Add(199 * time.Minute)))
+	})
+	It("should keep the most recent records in memory", func() {
+		ms, err := NewMemoryAuditSink(3)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 5; i++ {
+			buildID := buildID1
+			if i%2 == 1 {
+				buildID = buildID2
+			}
+			Expect(ms.Write(newRecord(i, buildID, sessionID1))).To(Succeed())
+		}
+		records, err := ms.Query(&AuditQuery{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(3))
+		Expect(records[0].Time).To(Equal(baseTime.Add(4 * time.Minute)))
+		Expect(records[2].Time).To(Equal(baseTime.Add(2 * time.Minute)))
+
+		records, err = ms.Query(&AuditQuery{BuildID: buildID1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(2))
+		records, err = ms.Query(&AuditQuery{From: baseTime.Add(3 * time.Minute), To: baseTime.Add(4 * time.Minute)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].BuildID).To(Equal(buildID2))
+	})
+	It("should record allocation attempts", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		ms, err := NewMemoryAuditSink(10)
+		Expect(err).ToNot(HaveOccurred())
+		h.SetAuditSink(ms)
+
+		ctx := withCallerClaims(context.Background(), &CallerClaims{Subject: "caller1"})
+		// the session already exists, so the allocation returns it
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"buildID\":\"%s\",\"sessionID\":\"%s\"}", buildID1, sessionID1)))
+		w := httptest.NewRecorder()
+		h.handleAllocationRequest(w, req.WithContext(ctx))
+		Expect(w.Result().StatusCode).To(Equal(http.StatusOK))
+		// the build does not exist
+		req = httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"buildID\":\"%s\",\"sessionID\":\"%s\"}", buildID2, sessionID2)))
+		w = httptest.NewRecorder()
+		h.handleAllocationRequest(w, req)
+		Expect(w.Result().StatusCode).To(Equal(http.StatusNotFound))
+
+		records, err := ms.Query(&AuditQuery{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(2))
+		Expect(records[0].BuildID).To(Equal(buildID2))
+		Expect(records[0].StatusCode).To(Equal(http.StatusNotFound))
+		Expect(records[0].Error).ToNot(BeEmpty())
+		Expect(records[0].GameServerName).To(BeEmpty())
+		Expect(records[1].Operation).To(Equal(auditOperationAllocate))
+		Expect(records[1].Caller).To(Equal("caller1"))
+		Expect(records[1].SessionID).To(Equal(sessionID1))
+		Expect(records[1].GameServerName).To(Equal(gsName))
+		Expect(records[1].Namespace).To(Equal(testnamespace))
+		Expect(records[1].StatusCode).To(Equal(http.StatusOK))
+	})
+	It("should query the audit records", func() {
+		h := NewAllocationApiServer(nil, testNewSimpleK8sClient(), allocationApiSvcPort)
+		ms, err := NewMemoryAuditSink(10)
+		Expect(err).ToNot(HaveOccurred())
+		h.SetAuditSink(ms)
+		for i, sessionID := range []string{sessionID1, sessionID2, sessionID1} {
+			r := newRecord(i, buildID1, sessionID)
+			r.Caller = "caller1"
+			Expect(ms.Write(r)).To(Succeed())
+		}
+		Expect(ms.Write(newRecord(3, buildID2, sessionID2))).To(Succeed())
+
+		query := func(ctx context.Context, params string) (int, []AllocationAuditRecord) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/audit/allocations"+params, nil)
+			w := httptest.NewRecorder()
+			h.handleAuditQueryRequest(w, req.WithContext(ctx))
+			var resp AuditQueryResponse
+			if w.Result().StatusCode == http.StatusOK {
+				Expect(json.NewDecoder(w.Body).Decode(&resp)).To(Succeed())
+			}
+			return w.Result().StatusCode, resp.Records
+		}
+
+		code, records := query(context.Background(), "")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(records).To(HaveLen(4))
+		code, records = query(context.Background(), "?buildID="+buildID1+"&sessionID="+sessionID1)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(records).To(HaveLen(2))
+		code, records = query(context.Background(), "?from=2022-06-01T10:01:00Z&to=2022-06-01T10:03:00Z")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(sessionIDs(records)).To(Equal([]string{sessionID1, sessionID2}))
+		code, records = query(context.Background(), "?limit=1")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].BuildID).To(Equal(buildID2))
+		// callers authenticated with a token only see their own records
+		code, records = query(withCallerClaims(context.Background(), &CallerClaims{Subject: "caller1"}), "?sessionID="+sessionID2)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].BuildID).To(Equal(buildID1))
+		// no records is an empty list
+		code, records = query(context.Background(), "?from=2023-01-01T00:00:00Z")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(records).ToNot(BeNil())
+		Expect(records).To(BeEmpty())
+
+		for _, params := range []string{"?buildID=invalid", "?from=yesterday", "?limit=0", "?limit=1001"} {
+			code, _ = query(context.Background(), params)
+			Expect(code).To(Equal(http.StatusBadRequest), params)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/audit/allocations", nil)
+		w := httptest.NewRecorder()
+		h.handleAuditQueryRequest(w, req)
+		Expect(w.Result().StatusCode).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -104,6 +104,45 @@ func (cw *CertificateWatcher) GetConfigForClient(_ *tls.ClientHelloInfo) (*tls.C
 	}, nil
 }
 
+// GetClientCertificate returns the current TLS certificate.
+// It is intended to be used as the tls.Config.GetClientCertificate callback, when calling other allocation API services.
+func (cw *CertificateWatcher) GetClientCertificate(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return cw.GetCertificate(nil)
+}
+
+// VerifyPeerCertificate verifies the certificate chain presented by a server against the current CA cert pool.
+// It is intended to be used as the tls.Config.VerifyPeerCertificate callback, together with InsecureSkipVerify,
+// so that the verification follows certificate rotation. The host name of the server is not verified.
+func (cw *CertificateWatcher) VerifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("no certificate presented by the server")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("parsing server certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	cw.mu.RLock()
+	roots := cw.caCertPool
+	cw.mu.RUnlock()
+	if roots == nil {
+		return fmt.Errorf("no CA certificate pool loaded")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
 // Start implements the manager.Runnable interface.
 // It polls the cert files for changes and reloads them when modified.
 func (cw *CertificateWatcher) Start(ctx context.Context) error {
@@ -18,4 +18,45 @@ type Config struct {
 	InitContainerImageWin                  string `env:"THUNDERNETES_INIT_CONTAINER_IMAGE_WIN,notEmpty" envDefault:"ghcr.io/playfab/thundernetes-initcontainer-win:0.6.0"`
 	MaxNumberOfGameServersToAdd            int    `env:"MAX_NUM_GS_TO_ADD" envDefault:"20"`
 	MaxNumberOfGameServersToDelete         int    `env:"MAX_NUM_GS_TO_DEL" envDefault:"20"`
+	// TerminationGracePeriodSeconds is the time a GameServer process has to exit after it was marked for termination, before its GameServer is deleted
+	TerminationGracePeriodSeconds int `env:"GS_TERMINATION_GRACE_PERIOD_SECONDS" envDefault:"30"`
+	// CrashBackoffInitialSeconds and CrashBackoffMaxSeconds bound the backoff of the GameServer creations of a GameServerBuild after a process crash,
+	// the backoff is opt-in, it is disabled if CrashBackoffInitialSeconds is zero
+	CrashBackoffInitialSeconds int `env:"CRASH_BACKOFF_INITIAL_SECONDS" envDefault:"0"`
+	CrashBackoffMaxSeconds     int `env:"CRASH_BACKOFF_MAX_SECONDS" envDefault:"300"`
+	// FederationPeers is a list of region=url pairs for the allocation API services of the peer clusters, federation is disabled if empty
+	FederationPeers            []string `env:"FEDERATION_PEERS" envSeparator:","`
+	FederationLocalRegion      string   `env:"FEDERATION_LOCAL_REGION"`
+	FederationRequestTimeoutMs int      `env:"FEDERATION_REQUEST_TIMEOUT_MS" envDefault:"5000"`
+	// AuthApiKeysSecretName is the name of the Secret with the API keys, used when ApiServiceSecurity is "usetoken", API keys are disabled if empty
+	AuthApiKeysSecretName      string `env:"AUTH_API_KEYS_SECRET_NAME"`
+	AuthApiKeysSecretNamespace string `env:"AUTH_API_KEYS_SECRET_NAMESPACE" envDefault:"thundernetes-system"`
+	// AuthJwksFile is the path of the JWKS file that JWTs are validated against, used when ApiServiceSecurity is "usetoken", JWTs are disabled if empty
+	AuthJwksFile    string `env:"AUTH_JWKS_FILE"`
+	AuthJwtIssuer   string `env:"AUTH_JWT_ISSUER"`
+	AuthJwtAudience string `env:"AUTH_JWT_AUDIENCE"`
+	// RateLimitPerCallerQPS and RateLimitPerBuildQPS are the allocation rates allowed per caller and per build, the respective limit is disabled if zero
+	RateLimitPerCallerQPS   float64 `env:"RATE_LIMIT_PER_CALLER_QPS" envDefault:"0"`
+	RateLimitPerCallerBurst int     `env:"RATE_LIMIT_PER_CALLER_BURST" envDefault:"10"`
+	RateLimitPerBuildQPS    float64 `env:"RATE_LIMIT_PER_BUILD_QPS" envDefault:"0"`
+	RateLimitPerBuildBurst  int     `env:"RATE_LIMIT_PER_BUILD_BURST" envDefault:"20"`
+	// TitleActiveSessionsLimits is a list of titleID=limit pairs that cap the concurrent Active sessions of a title
+	TitleActiveSessionsLimits []string `env:"TITLE_ACTIVE_SESSIONS_LIMITS" envSeparator:","`
+	// LifecycleEventEndpoints is a list of HTTP endpoints the GameServer lifecycle events are POSTed to, lifecycle events are disabled if empty
+	LifecycleEventEndpoints       []string `env:"LIFECYCLE_EVENT_ENDPOINTS" envSeparator:","`
+	LifecycleEventSource          string   `env:"LIFECYCLE_EVENT_SOURCE" envDefault:"thundernetes"`
+	LifecycleEventBufferSize      int      `env:"LIFECYCLE_EVENT_BUFFER_SIZE" envDefault:"1000"`
+	LifecycleEventBatchSize       int      `env:"LIFECYCLE_EVENT_BATCH_SIZE" envDefault:"50"`
+	LifecycleEventFlushIntervalMs int      `env:"LIFECYCLE_EVENT_FLUSH_INTERVAL_MS" envDefault:"1000"`
+	LifecycleEventMaxRetries      int      `env:"LIFECYCLE_EVENT_MAX_RETRIES" envDefault:"5"`
+	// AllocationHeartbeatStalenessMs is the maximum age of the last heartbeat, as published by the NodeAgent, of a GameServer that can be allocated, the check is disabled if zero
+	AllocationHeartbeatStalenessMs int `env:"ALLOCATION_HEARTBEAT_STALENESS_MS" envDefault:"0"`
+	// AllocationAuditSink is the sink of the allocation audit records, either file or memory, the audit log is disabled if empty
+	AllocationAuditSink          string `env:"ALLOCATION_AUDIT_SINK"`
+	AllocationAuditFile          string `env:"ALLOCATION_AUDIT_FILE" envDefault:"/var/log/thundernetes/allocations.jsonl"`
+	AllocationAuditMaxFileSizeMB int    `env:"ALLOCATION_AUDIT_MAX_FILE_SIZE_MB" envDefault:"100"`
+	AllocationAuditMaxFiles      int    `env:"ALLOCATION_AUDIT_MAX_FILES" envDefault:"5"`
+	AllocationAuditMaxRecords    int    `env:"ALLOCATION_AUDIT_MAX_RECORDS" envDefault:"10000"`
+	// GrpcAllocationApiSvcPort is the port of the gRPC allocation API service, the service is disabled if it is zero
+	GrpcAllocationApiSvcPort int32 `env:"GRPC_ALLOC_API_SVC_PORT" envDefault:"0"`
 }
@@ -3,7 +3,9 @@ package controllers
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"math/rand"
 	"strconv"
 	"strings"
@@ -16,6 +18,8 @@ import (
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
 )
 
 const (
@@ -34,6 +38,8 @@ const (
 	LabelOwningGameServer = "mps.playfab.com/OwningGameServer"
 	LabelOwningOperator   = "mps.playfab.com/OwningOperator"
 	LabelNodeName         = "NodeName"
+	// LabelTemplateHash is the hash of the GameServerBuild Template the GameServer was created from
+	LabelTemplateHash = "mps.playfab.com/TemplateHash"
 
 	GsdkConfigFile    = DataVolumeMountPath + "/Config/gsdkConfig.json"
 	GsdkConfigFileWin = DataVolumeMountPathWin + "\\Config\\gsdkConfig.json"
@@ -111,7 +117,7 @@ func NewGameServerForGameServerBuild(gsb *mpsv1alpha1.GameServerBuild, portRegis
 					Kind:    GameServerBuildKind,
 				}),
 			},
-			Labels: map[string]string{LabelBuildID: gsb.Spec.BuildID, LabelBuildName: gsb.Name},
+			Labels: map[string]string{LabelBuildID: gsb.Spec.BuildID, LabelBuildName: gsb.Name, LabelTemplateHash: getTemplateHash(&gsb.Spec.Template)},
 		},
 		Spec: mpsv1alpha1.GameServerSpec{
 			// we're doing a DeepCopy since we modify the hostPort
@@ -149,6 +155,45 @@ func NewGameServerForGameServerBuild(gsb *mpsv1alpha1.GameServerBuild, portRegis
 	return gs, nil
 }
 
+// getTemplateHash returns a hash of the provided pod template, used to find the GameServers created from a previous template
+func getTemplateHash(template *corev1.PodTemplateSpec) string {
+	hasher := fnv.New32a()
+	// JSON encoding is deterministic, since struct fields are encoded in order and map keys are sorted
+	b, _ := json.Marshal(template)
+	hasher.Write(b)
+	return utilrand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// getRolloutLimits returns the maximum number of non-Active GameServers above standingBy
+// and of StandingBy GameServers below standingBy while outdated GameServers are replaced
+// percentages are of standingBy, maxSurge is rounded up and maxUnavailable is rounded down, like in Deployments
+func getRolloutLimits(gsb *mpsv1alpha1.GameServerBuild, standingBy int) (int, int) {
+	defaultValue := intstr.FromString("25%")
+	maxSurgeValue, maxUnavailableValue := &defaultValue, &defaultValue
+	if gsb.Spec.RolloutStrategy != nil {
+		if gsb.Spec.RolloutStrategy.MaxSurge != nil {
+			maxSurgeValue = gsb.Spec.RolloutStrategy.MaxSurge
+		}
+		if gsb.Spec.RolloutStrategy.MaxUnavailable != nil {
+			maxUnavailableValue = gsb.Spec.RolloutStrategy.MaxUnavailable
+		}
+	}
+	// invalid values are rejected by the webhook, we fall back to zero in case it is not installed
+	maxSurge, err := intstr.GetScaledValueFromIntOrPercent(maxSurgeValue, standingBy, true)
+	if err != nil || maxSurge < 0 {
+		maxSurge = 0
+	}
+	maxUnavailable, err := intstr.GetScaledValueFromIntOrPercent(maxUnavailableValue, standingBy, false)
+	if err != nil || maxUnavailable < 0 {
+		maxUnavailable = 0
+	}
+	// the rollout could not progress if both were zero
+	if maxSurge == 0 && maxUnavailable == 0 {
+		maxSurge = 1
+	}
+	return maxSurge, maxUnavailable
+}
+
 // NewPodForGameServer returns a Kubernetes Pod struct for a specified GameServer
 // Pod has the same name as the GameServer
 // It also sets a label called "GameServer" with the value of the corresponding GameServer resource
@@ -1,13 +1,16 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
 	"sort"
 
 	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -392,5 +395,97 @@ var _ = Describe("Utilities tests", func() {
 			// verify name has the build name prefix
 			Expect(gs.Name).To(HavePrefix(fmt.Sprintf("%s-", gsb.Name)))
 		})
+		It("should label GameServers with the hash of the GameServerBuild Template", func() {
+			client := testNewSimpleK8sClient()
+			pr, err := NewPortRegistry(client, &mpsv1alpha1.GameServerList{}, 20000, 20100, 1, false, ctrl.Log.WithName("test"))
+			Expect(err).ToNot(HaveOccurred())
+			gsb := testGenerateGameServerBuild("test-build-hash", "default", "build-id-hash", 2, 4, false)
+			hash := getTemplateHash(&gsb.Spec.Template)
+			Expect(hash).ToNot(BeEmpty())
+			gs, err := NewGameServerForGameServerBuild(&gsb, pr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gs.Labels[LabelTemplateHash]).To(Equal(hash))
+			// the host ports assigned to the GameServer do not change the hash of the GameServerBuild Template
+			Expect(getTemplateHash(&gsb.Spec.Template)).To(Equal(hash))
+			Expect(isOutdatedGameServer(gs, hash)).To(BeFalse())
+
+			gsb.Spec.Template.Spec.Containers[0].Image = "testimage:v2"
+			newHash := getTemplateHash(&gsb.Spec.Template)
+			Expect(newHash).ToNot(Equal(hash))
+			Expect(isOutdatedGameServer(gs, newHash)).To(BeTrue())
+			// GameServers created before the label was added are not outdated
+			delete(gs.Labels, LabelTemplateHash)
+			Expect(isOutdatedGameServer(gs, newHash)).To(BeFalse())
+		})
+		It("should adopt the GameServers if the Template hash changed without a change of the spec", func() {
+			cl := testNewSimpleK8sClient()
+			gs, err := testCreateGameServerAndBuild(cl, "gs-1", "test-build-adopt", "build-id-adopt", "", mpsv1alpha1.GameServerStateStandingBy)
+			Expect(err).ToNot(HaveOccurred())
+			gs.Labels[LabelTemplateHash] = "previous"
+			Expect(cl.Update(context.Background(), gs)).To(Succeed())
+
+			gsb := testGenerateGameServerBuild("test-build-adopt", "default", "build-id-adopt", 2, 4, false)
+			gsb.Generation = 2
+			gsb.Status.TemplateHash = "previous"
+			gsb.Status.ObservedGeneration = 2
+			Expect(isTemplateHashChangedWithoutSpecChange(&gsb, "previous")).To(BeFalse())
+			Expect(isTemplateHashChangedWithoutSpecChange(&gsb, "current")).To(BeTrue())
+			// the spec changed, so the Template might have changed as well
+			gsb.Generation = 3
+			Expect(isTemplateHashChangedWithoutSpecChange(&gsb, "current")).To(BeFalse())
+			gsb.Generation = 2
+
+			var gameServers mpsv1alpha1.GameServerList
+			Expect(cl.List(context.Background(), &gameServers)).To(Succeed())
+			r := &GameServerBuildReconciler{Client: cl}
+			Expect(r.adoptGameServers(context.Background(), &gsb, &gameServers, "current")).To(Succeed())
+			Expect(gameServers.Items[0].Labels[LabelTemplateHash]).To(Equal("current"))
+			Expect(cl.Get(context.Background(), client.ObjectKeyFromObject(gs), gs)).To(Succeed())
+			Expect(gs.Labels[LabelTemplateHash]).To(Equal("current"))
+		})
+		It("should return the rollout limits", func() {
+			gsb := testGenerateGameServerBuild("test-build-rollout", "default", "build-id-rollout", 10, 20, false)
+			// defaults to 25%, maxSurge is rounded up and maxUnavailable down
+			maxSurge, maxUnavailable := getRolloutLimits(&gsb, gsb.Spec.StandingBy)
+			Expect(maxSurge).To(Equal(3))
+			Expect(maxUnavailable).To(Equal(2))
+
+			surge, unavailable := intstr.FromInt(4), intstr.FromString("50%")
+			gsb.Spec.RolloutStrategy = &mpsv1alpha1.RolloutStrategy{MaxSurge: &surge, MaxUnavailable: &unavailable}
+			maxSurge, maxUnavailable = getRolloutLimits(&gsb, gsb.Spec.StandingBy)
+			Expect(maxSurge).To(Equal(4))
+			Expect(maxUnavailable).To(Equal(5))
+
+			// the rollout would not progress if both were zero, so maxSurge is at least one
+			zero := intstr.FromInt(0)
+			gsb.Spec.RolloutStrategy = &mpsv1alpha1.RolloutStrategy{MaxSurge: &zero, MaxUnavailable: &zero}
+			maxSurge, maxUnavailable = getRolloutLimits(&gsb, gsb.Spec.StandingBy)
+			Expect(maxSurge).To(Equal(1))
+			Expect(maxUnavailable).To(Equal(0))
+		})
+		It("should count the GameServers by Template", func() {
+			hash := "current"
+			newGameServer := func(templateHash string, state mpsv1alpha1.GameServerState, health mpsv1alpha1.GameServerHealth) mpsv1alpha1.GameServer {
+				return mpsv1alpha1.GameServer{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{LabelTemplateHash: templateHash}},
+					Status:     mpsv1alpha1.GameServerStatus{State: state, Health: health},
+				}
+			}
+			gameServers := mpsv1alpha1.GameServerList{Items: []mpsv1alpha1.GameServer{
+				newGameServer(hash, "", ""),
+				newGameServer(hash, mpsv1alpha1.GameServerStateStandingBy, mpsv1alpha1.GameServerHealthy),
+				newGameServer(hash, mpsv1alpha1.GameServerStateActive, mpsv1alpha1.GameServerHealthy),
+				newGameServer("previous", "", ""),
+				newGameServer("previous", mpsv1alpha1.GameServerStateInitializing, mpsv1alpha1.GameServerHealthy),
+				newGameServer("previous", mpsv1alpha1.GameServerStateStandingBy, mpsv1alpha1.GameServerHealthy),
+				newGameServer("previous", mpsv1alpha1.GameServerStateStandingBy, mpsv1alpha1.GameServerUnhealthy),
+				newGameServer("previous", mpsv1alpha1.GameServerStateActive, mpsv1alpha1.GameServerHealthy),
+				newGameServer("previous", mpsv1alpha1.GameServerStateReserved, mpsv1alpha1.GameServerHealthy),
+			}}
+			updatedCount, outdatedCount, outdatedStandingByCount := countGameServersByTemplate(&gameServers, hash)
+			Expect(updatedCount).To(Equal(3))
+			Expect(outdatedCount).To(Equal(3))
+			Expect(outdatedStandingByCount).To(Equal(1))
+		})
 	})
 })
@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+// types of the GameServer lifecycle events
+const (
+	LifecycleEventAllocated    = "com.playfab.thundernetes.gameserver.allocated"
+	LifecycleEventStandingBy   = "com.playfab.thundernetes.gameserver.standingby"
+	LifecycleEventCrashed      = "com.playfab.thundernetes.gameserver.crashed"
+	LifecycleEventSessionEnded = "com.playfab.thundernetes.gameserver.sessionended"
+	LifecycleEventUnhealthy    = "com.playfab.thundernetes.gameserver.unhealthy"
+)
+
+const (
+	// cloudEventsSpecVersion is the version of the CloudEvents specification the events conform to
+	cloudEventsSpecVersion = "1.0"
+	// cloudEventsBatchContentType is the content type of the CloudEvents batched HTTP content mode
+	cloudEventsBatchContentType = "application/cloudevents-batch+json"
+	// eventSinkRequestTimeout is the timeout of every POST request to an endpoint
+	eventSinkRequestTimeout = 5 * time.Second
+	// eventSinkInitialRetryDelay is the delay before the first retry, it doubles on every retry
+	eventSinkInitialRetryDelay = 500 * time.Millisecond
+)
+
+// CloudEvent is a GameServer lifecycle event in the CloudEvents JSON format
+// https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/formats/json-format.md
+type CloudEvent struct {
+	SpecVersion     string              `json:"specversion"`
+	ID              string              `json:"id"`
+	Source          string              `json:"source"`
+	Type            string              `json:"type"`
+	Subject         string              `json:"subject"`
+	Time            time.Time           `json:"time"`
+	DataContentType string              `json:"datacontenttype"`
+	Data            GameServerEventData `json:"data"`
+}
+
+// GameServerEventData contains the details of the GameServer of a lifecycle event
+type GameServerEventData struct {
+	GameServerName string                       `json:"gameServerName"`
+	Namespace      string                       `json:"namespace"`
+	BuildName      string                       `json:"buildName"`
+	BuildID        string                       `json:"buildID"`
+	TitleID        string                       `json:"titleID,omitempty"`
+	SessionID      string                       `json:"sessionID,omitempty"`
+	State          mpsv1alpha1.GameServerState  `json:"state,omitempty"`
+	Health         mpsv1alpha1.GameServerHealth `json:"health,omitempty"`
+	NodeName       string                       `json:"nodeName,omitempty"`
+	PublicIP       string                       `json:"publicIP,omitempty"`
+}
+
+// EventSink sends GameServer lifecycle events as CloudEvents to HTTP endpoints
+// events are buffered in memory and POSTed in batches, every batch is retried with exponential backoff if an endpoint fails
+// if the buffer is full, new events are dropped so that the reconcilers and the allocation API service are never blocked
+// EventSink implements the manager.Runnable interface so it can be added to the controller manager
+type EventSink struct {
+	endpoints     []string
+	source        string
+	events        chan CloudEvent
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	httpClient    *http.Client
+	logger        logr.Logger
+}
+
+// NewEventSink returns a new EventSink that sends events to the provided endpoints
+// source is the CloudEvents source attribute of the events, e.g. the name of the cluster
+func NewEventSink(endpoints []string, source string, bufferSize, batchSize int, flushInterval time.Duration, maxRetries int) (*EventSink, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoints configured")
+	}
+	if bufferSize < 1 || batchSize < 1 || flushInterval <= 0 || maxRetries < 0 {
+		return nil, fmt.Errorf("invalid event sink configuration, bufferSize, batchSize and flushInterval must be positive and maxRetries non-negative")
+	}
+	return &EventSink{
+		endpoints:     endpoints,
+		source:        source,
+		events:        make(chan CloudEvent, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		maxRetries:    maxRetries,
+		httpClient:    &http.Client{Timeout: eventSinkRequestTimeout},
+		logger:        log.Log.WithName("event-sink"),
+	}, nil
+}
+
+// Emit buffers a lifecycle event of the provided type for the provided GameServer
+// it never blocks, the event is dropped if the buffer is full. It is a no-op on a nil EventSink, so callers don't need to check if events are enabled
+func (es *EventSink) Emit(eventType string, gs *mpsv1alpha1.GameServer) {
+	if es == nil {
+		return
+	}
+	ce := CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              uuid.NewString(),
+		Source:          es.source,
+		Type:            eventType,
+		Subject:         gs.Namespace + "/" + gs.Name,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data: GameServerEventData{
+			GameServerName: gs.Name,
+			Namespace:      gs.Namespace,
+			BuildName:      gs.Labels[LabelBuildName],
+			BuildID:        gs.Labels[LabelBuildID],
+			TitleID:        gs.Spec.TitleID,
+			SessionID:      gs.Status.SessionID,
+			State:          gs.Status.State,
+			Health:         gs.Status.Health,
+			NodeName:       gs.Status.NodeName,
+			PublicIP:       gs.Status.PublicIP,
+		},
+	}
+	select {
+	case es.events <- ce:
+	default:
+		LifecycleEventsDroppedCounter.WithLabelValues(eventType).Inc()
+		es.logger.Info("event buffer is full, dropping event", "type", eventType, "subject", ce.Subject)
+	}
+}
+
+// Start implements the manager.Runnable interface
+// it sends the buffered events in batches, a batch is sent when it is full or when the flush interval has passed
+func (es *EventSink) Start(ctx context.Context) error {
+	es.logger.Info("starting event sink", "endpoints", es.endpoints, "batchSize", es.batchSize, "flushInterval", es.flushInterval)
+	ticker := time.NewTicker(es.flushInterval)
+	defer ticker.Stop()
+	batch := make([]CloudEvent, 0, es.batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			// try to send the events we already have, without retries since we're shutting down
+			es.drain(&batch)
+			if len(batch) > 0 {
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), eventSinkRequestTimeout)
+				es.sendBatch(shutdownCtx, batch, 0)
+				cancel()
+			}
+			es.logger.Info("stopping event sink")
+			return nil
+		case ce := <-es.events:
+			batch = append(batch, ce)
+			if len(batch) >= es.batchSize {
+				es.sendBatch(ctx, batch, es.maxRetries)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				es.sendBatch(ctx, batch, es.maxRetries)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// drain moves the events of the buffer to the batch, without blocking
+func (es *EventSink) drain(batch *[]CloudEvent) {
+	for {
+		select {
+		case ce := <-es.events:
+			*batch = append(*batch, ce)
+		default:
+			return
+		}
+	}
+}
+
+// sendBatch POSTs the batch to all endpoints in parallel, retrying every endpoint up to maxRetries times
+func (es *EventSink) sendBatch(ctx context.Context, batch []CloudEvent, maxRetries int) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		es.logger.Error(err, "error marshaling events")
+		return
+	}
+	var wg sync.WaitGroup
+	for _, endpoint := range es.endpoints {
+		wg.Add(1)
+		go func(endpoint string) {
+			defer wg.Done()
+			if err := es.sendWithRetries(ctx, endpoint, body, maxRetries); err != nil {
+				LifecycleEventsFailedCounter.WithLabelValues(endpoint).Add(float64(len(batch)))
+				es.logger.Error(err, "error sending events, dropping them", "endpoint", endpoint, "count", len(batch))
+				return
+			}
+			for _, ce := range batch {
+				LifecycleEventsSentCounter.WithLabelValues(ce.Type).Inc()
+			}
+		}(endpoint)
+	}
+	wg.Wait()
+}
+
+// sendWithRetries POSTs the body to the endpoint, retrying with exponential backoff on network errors, 429 and 5xx responses
+func (es *EventSink) sendWithRetries(ctx context.Context, endpoint string, body []byte, maxRetries int) error {
+	delay := eventSinkInitialRetryDelay
+	var err error
+	for i := 0; i <= maxRetries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		var retryable bool
+		if retryable, err = es.send(ctx, endpoint, body); err == nil || !retryable {
+			return err
+		}
+		es.logger.V(1).Info("error sending events, retrying", "endpoint", endpoint, "error", err, "retry", i)
+	}
+	return err
+}
+
+// send POSTs the body to the endpoint, it returns whether the request can be retried if it failed
+func (es *EventSink) send(ctx context.Context, endpoint string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", cloudEventsBatchContentType)
+	res, err := es.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retryable, fmt.Errorf("endpoint returned status code %d", res.StatusCode)
+}
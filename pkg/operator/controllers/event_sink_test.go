@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("lifecycle event sink tests", func() {
+	testGameServer := func(name string) *mpsv1alpha1.GameServer {
+		return &mpsv1alpha1.GameServer{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels: map[string]string{
+					LabelBuildID:   "acb84898-cf73-46e2-8057-314ac557d85d",
+					LabelBuildName: "testbuild",
+				},
+			},
+			Status: mpsv1alpha1.GameServerStatus{
+				State:     mpsv1alpha1.GameServerStateActive,
+				SessionID: "d5f075a4-517b-4bf4-8123-dfa0021aa169",
+			},
+		}
+	}
+
+	// testNewEndpoint returns a server that fails the first failures requests and records the events of the rest
+	testNewEndpoint := func(failures int32) (*httptest.Server, func() [][]CloudEvent) {
+		var mu sync.Mutex
+		var batches [][]CloudEvent
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Header.Get("Content-Type")).To(Equal(cloudEventsBatchContentType))
+			if atomic.AddInt32(&calls, 1) <= failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			var batch []CloudEvent
+			Expect(json.NewDecoder(r.Body).Decode(&batch)).To(Succeed())
+			mu.Lock()
+			batches = append(batches, batch)
+			mu.Unlock()
+		}))
+		DeferCleanup(srv.Close)
+		return srv, func() [][]CloudEvent {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([][]CloudEvent{}, batches...)
+		}
+	}
+
+	It("should reject invalid configuration", func() {
+		_, err := NewEventSink(nil, "test", 10, 10, time.Second, 1)
+		Expect(err).To(HaveOccurred())
+		_, err = NewEventSink([]string{"http://localhost"}, "test", 0, 10, time.Second, 1)
+		Expect(err).To(HaveOccurred())
+		// a nil EventSink ignores events
+		var es *EventSink
+		es.Emit(LifecycleEventAllocated, testGameServer("gs1"))
+	})
+	It("should send the events in batches", func() {
+		srv, getBatches := testNewEndpoint(0)
+		es, err := NewEventSink([]string{srv.URL}, "test", 10, 2, time.Hour, 0)
+		Expect(err).ToNot(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		go es.Start(ctx)
+
+		es.Emit(LifecycleEventAllocated, testGameServer("gs1"))
+		es.Emit(LifecycleEventSessionEnded, testGameServer("gs2"))
+		Eventually(getBatches).Should(HaveLen(1))
+		batch := getBatches()[0]
+		Expect(batch).To(HaveLen(2))
+		Expect(batch[0].SpecVersion).To(Equal(cloudEventsSpecVersion))
+		Expect(batch[0].Source).To(Equal("test"))
+		Expect(batch[0].Type).To(Equal(LifecycleEventAllocated))
+		Expect(batch[0].Subject).To(Equal("default/gs1"))
+		Expect(batch[0].Data.BuildName).To(Equal("testbuild"))
+		Expect(batch[0].Data.SessionID).To(Equal("d5f075a4-517b-4bf4-8123-dfa0021aa169"))
+		Expect(batch[1].Type).To(Equal(LifecycleEventSessionEnded))
+		Expect(batch[0].ID).ToNot(Equal(batch[1].ID))
+	})
+	It("should flush incomplete batches and retry failed requests", func() {
+		srv, getBatches := testNewEndpoint(2)
+		es, err := NewEventSink([]string{srv.URL}, "test", 10, 10, 50*time.Millisecond, 3)
+		Expect(err).ToNot(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		go es.Start(ctx)
+
+		es.Emit(LifecycleEventCrashed, testGameServer("gs1"))
+		Eventually(getBatches, 5*time.Second).Should(HaveLen(1))
+		Expect(getBatches()[0][0].Type).To(Equal(LifecycleEventCrashed))
+	})
+	It("should drop events when the buffer is full", func() {
+		es, err := NewEventSink([]string{"http://localhost"}, "test", 1, 10, time.Hour, 0)
+		Expect(err).ToNot(HaveOccurred())
+		// the sink is not started, so the buffer is never emptied
+		es.Emit(LifecycleEventStandingBy, testGameServer("gs1"))
+		es.Emit(LifecycleEventStandingBy, testGameServer("gs2"))
+		Expect(es.events).To(HaveLen(1))
+		ce := <-es.events
+		Expect(ce.Subject).To(Equal("default/gs1"))
+	})
+	It("should emit an event when a game server is allocated", func() {
+		client := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(client, "testgs", "testbuild", "acb84898-cf73-46e2-8057-314ac557d85d", "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            gs.Name,
+			Namespace:       gs.Namespace,
+			BuildID:         "acb84898-cf73-46e2-8057-314ac557d85d",
+			ResourceVersion: gs.ResourceVersion,
+		})
+		es, err := NewEventSink([]string{"http://localhost"}, "test", 10, 10, time.Hour, 0)
+		Expect(err).ToNot(HaveOccurred())
+		h.SetEventSink(es)
+
+		_, err = h.allocate(context.Background(), &AllocateArgs{BuildID: "acb84898-cf73-46e2-8057-314ac557d85d", SessionID: "d5f075a4-517b-4bf4-8123-dfa0021aa169"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(es.events).To(HaveLen(1))
+		ce := <-es.events
+		Expect(ce.Type).To(Equal(LifecycleEventAllocated))
+		Expect(ce.Data.GameServerName).To(Equal("testgs"))
+		Expect(ce.Data.BuildName).To(Equal("testbuild"))
+		Expect(ce.Data.State).To(Equal(mpsv1alpha1.GameServerStateActive))
+	})
+	It("should emit the StandingBy event once per transition, even after a restart", func() {
+		startTime := time.Now().Truncate(time.Second)
+		gs := testGameServer("gs-standingby")
+		DeferCleanup(func() {
+			observedStandingByTimes.Delete(client.ObjectKeyFromObject(gs))
+		})
+		gs.Status.State = mpsv1alpha1.GameServerStateStandingBy
+		// the GameServer reached StandingBy before the controller started, so the previous controller has already observed it
+		before := metav1.NewTime(startTime.Add(-time.Minute))
+		gs.Status.ReachedStandingByOn = &before
+		Expect(reachedStandingBy(gs, startTime)).To(BeFalse())
+		Expect(reachedStandingBy(gs, startTime)).To(BeFalse())
+
+		// it becomes StandingBy again after its session is released
+		gs.Status.State = mpsv1alpha1.GameServerStateActive
+		Expect(reachedStandingBy(gs, startTime)).To(BeFalse())
+		gs.Status.State = mpsv1alpha1.GameServerStateStandingBy
+		after := metav1.NewTime(startTime.Add(time.Minute))
+		gs.Status.ReachedStandingByOn = &after
+		Expect(reachedStandingBy(gs, startTime)).To(BeTrue())
+		Expect(reachedStandingBy(gs, startTime)).To(BeFalse())
+
+		// a GameServer that reached StandingBy after the controller started is emitted when it is first observed
+		observedStandingByTimes.Delete(client.ObjectKeyFromObject(gs))
+		Expect(reachedStandingBy(gs, startTime)).To(BeTrue())
+	})
+})
@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+const (
+	// defaultExternalScalingInterval is the time between two requests to the external scaling endpoint if IntervalSeconds is not set
+	defaultExternalScalingInterval = 30 * time.Second
+	// defaultExternalScalingTimeout is the timeout of every request to the external scaling endpoint if TimeoutSeconds is not set
+	defaultExternalScalingTimeout = 5 * time.Second
+)
+
+// results of the requests to the external scaling endpoints, used as a label of the ExternalScalingDecisionsCounter
+const (
+	externalScalingResultSuccess = "success"
+	externalScalingResultTimeout = "timeout"
+	externalScalingResultError   = "error"
+)
+
+// externalScalingHTTPClient is the client of the requests to the external scaling endpoints, their timeout is set on the context
+var externalScalingHTTPClient = &http.Client{}
+
+// ExternalScalingRequest is the body of the POST request to the external scaling endpoint of a GameServerBuild
+type ExternalScalingRequest struct {
+	BuildName           string `json:"buildName"`
+	Namespace           string `json:"namespace"`
+	BuildID             string `json:"buildID"`
+	StandingBy          int    `json:"standingBy"`
+	Max                 int    `json:"max"`
+	CurrentPending      int    `json:"currentPending"`
+	CurrentInitializing int    `json:"currentInitializing"`
+	CurrentStandingBy   int    `json:"currentStandingBy"`
+	CurrentActive       int    `json:"currentActive"`
+	CurrentReserved     int    `json:"currentReserved"`
+	CrashesCount        int    `json:"crashesCount"`
+}
+
+// ExternalScalingResponse is the body of the response of the external scaling endpoint
+// StandingBy is required, if Max is not set the Max of the GameServerBuild is used
+type ExternalScalingResponse struct {
+	StandingBy *int `json:"standingBy"`
+	Max        *int `json:"max,omitempty"`
+}
+
+// externalScalingJobsSize is the capacity of the channel of the pending requests to the external scaling endpoints
+const externalScalingJobsSize = 100
+
+// ExternalScalingPoller calls the external scaling endpoints of the GameServerBuilds outside of their reconcile loops,
+// so that a slow endpoint does not block the reconciliation. Reconcile reads only the last decision of the poller
+// and a GameServerBuild is reconciled again every time one of its requests completes
+type ExternalScalingPoller struct {
+	recorder record.EventRecorder
+	// polls contains the state of the requests of each GameServerBuild
+	// key is namespace/name of the GameServerBuild
+	// value is a *externalScalingPoll
+	polls sync.Map
+	// jobs contains the requests that are sent by Start
+	jobs chan externalScalingJob
+	// events is watched by the GameServerBuild controller to reconcile a GameServerBuild when its request completes
+	events chan event.GenericEvent
+}
+
+// externalScalingPoll is the state of the requests to the external scaling endpoint of a GameServerBuild
+type externalScalingPoll struct {
+	mu sync.Mutex
+	// lastRequest is the time of the last request
+	lastRequest time.Time
+	// inFlight is true while a request has not completed
+	inFlight bool
+	// status is the result of the last completed request, nil if no request completed since the controller started
+	status *mpsv1alpha1.ExternalScalingStatus
+}
+
+// externalScalingJob is a request to the external scaling endpoint of a GameServerBuild
+type externalScalingJob struct {
+	gsb      *mpsv1alpha1.GameServerBuild
+	previous *mpsv1alpha1.ExternalScalingStatus
+	req      *ExternalScalingRequest
+	poll     *externalScalingPoll
+}
+
+// NewExternalScalingPoller returns a pointer to a new ExternalScalingPoller
+func NewExternalScalingPoller(recorder record.EventRecorder) *ExternalScalingPoller {
+	return &ExternalScalingPoller{
+		recorder: recorder,
+		jobs:     make(chan externalScalingJob, externalScalingJobsSize),
+		events:   make(chan event.GenericEvent),
+	}
+}
+
+// Start sends the requests to the external scaling endpoints until the context is cancelled
+// every request is sent on its own goroutine, there is at most one request in flight per GameServerBuild
+func (p *ExternalScalingPoller) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case job := <-p.jobs:
+			go p.run(ctx, job)
+		}
+	}
+}
+
+// run sends the request of the job, stores its result and triggers a reconcile of the GameServerBuild
+func (p *ExternalScalingPoller) run(ctx context.Context, job externalScalingJob) {
+	status := requestExternalScaling(ctx, p.recorder, job.gsb, job.previous, job.req, time.Now())
+	job.poll.mu.Lock()
+	job.poll.status = status
+	job.poll.inFlight = false
+	job.poll.mu.Unlock()
+	select {
+	case p.events <- event.GenericEvent{Object: job.gsb}:
+	case <-ctx.Done():
+	}
+}
+
+// decision returns the last decision of the external scaling endpoint of the GameServerBuild, along with the time until the next request
+// it is the status of the GameServerBuild until a request completes, so that the decision is kept across restarts of the controller
+// a new request is queued if the interval has passed since the last one and no request is in flight
+func (p *ExternalScalingPoller) decision(gsb *mpsv1alpha1.GameServerBuild, req *ExternalScalingRequest, now time.Time) (*mpsv1alpha1.ExternalScalingStatus, time.Duration) {
+	es := gsb.Spec.ExternalScaling
+	if es == nil {
+		return nil, 0
+	}
+	interval := defaultExternalScalingInterval
+	if es.IntervalSeconds > 0 {
+		interval = time.Duration(es.IntervalSeconds) * time.Second
+	}
+	val, _ := p.polls.LoadOrStore(client.ObjectKeyFromObject(gsb).String(), &externalScalingPoll{})
+	poll := val.(*externalScalingPoll)
+	poll.mu.Lock()
+	defer poll.mu.Unlock()
+	status := poll.status
+	if status == nil {
+		status = gsb.Status.ExternalScaling
+	}
+	if poll.inFlight {
+		return status, interval
+	}
+	if next := poll.lastRequest.Add(interval); !poll.lastRequest.IsZero() && now.Before(next) {
+		return status, next.Sub(now)
+	}
+	var previous *mpsv1alpha1.ExternalScalingStatus
+	if status != nil {
+		previous = status.DeepCopy()
+	}
+	select {
+	case p.jobs <- externalScalingJob{gsb: gsb.DeepCopy(), previous: previous, req: req, poll: poll}:
+		poll.inFlight = true
+		poll.lastRequest = now
+	default:
+		// too many pending requests, the next reconcile tries again
+	}
+	return status, interval
+}
+
+// forget removes the state of the requests of a deleted GameServerBuild
+func (p *ExternalScalingPoller) forget(key string) {
+	p.polls.Delete(key)
+}
+
+// requestExternalScaling calls the external scaling endpoint of the GameServerBuild and returns the decision that should be applied,
+// which is the previous one with the error if the request failed
+// every request is recorded as an event on the GameServerBuild and in the ExternalScalingDecisionsCounter metric
+func requestExternalScaling(ctx context.Context, recorder record.EventRecorder, gsb *mpsv1alpha1.GameServerBuild, previous *mpsv1alpha1.ExternalScalingStatus, req *ExternalScalingRequest, now time.Time) *mpsv1alpha1.ExternalScalingStatus {
+	status := &mpsv1alpha1.ExternalScalingStatus{}
+	if previous != nil {
+		status = previous.DeepCopy()
+	}
+	resp, err := callExternalScaling(ctx, gsb.Spec.ExternalScaling, req)
+	if err != nil {
+		result := externalScalingResultError
+		if errors.Is(err, context.DeadlineExceeded) {
+			result = externalScalingResultTimeout
+		}
+		ExternalScalingDecisionsCounter.WithLabelValues(gsb.Name, result).Inc()
+		status.LastError = err.Error()
+		if status.LastDecisionTime != nil {
+			recorder.Eventf(gsb, corev1.EventTypeWarning, "ExternalScalingFailed", "External scaling request failed, keeping standingBy %d and max %d: %s", status.StandingBy, status.Max, err.Error())
+		} else {
+			recorder.Eventf(gsb, corev1.EventTypeWarning, "ExternalScalingFailed", "External scaling request failed, keeping the standingBy and max of the spec: %s", err.Error())
+		}
+		return status
+	}
+
+	status.StandingBy, status.Max = applyExternalScalingBounds(gsb, resp)
+	lastDecisionTime := metav1.NewTime(now)
+	status.LastDecisionTime = &lastDecisionTime
+	status.LastError = ""
+	ExternalScalingDecisionsCounter.WithLabelValues(gsb.Name, externalScalingResultSuccess).Inc()
+	ExternalScalingDecisionGauge.WithLabelValues(gsb.Name, "standingBy").Set(float64(status.StandingBy))
+	ExternalScalingDecisionGauge.WithLabelValues(gsb.Name, "max").Set(float64(status.Max))
+	recorder.Eventf(gsb, corev1.EventTypeNormal, "ExternalScaling", "External scaling decided standingBy %d and max %d", status.StandingBy, status.Max)
+	return status
+}
+
+// callExternalScaling POSTs the request to the external scaling endpoint and returns its decision
+func callExternalScaling(ctx context.Context, es *mpsv1alpha1.ExternalScaling, req *ExternalScalingRequest) (*ExternalScalingResponse, error) {
+	timeout := defaultExternalScalingTimeout
+	if es.TimeoutSeconds > 0 {
+		timeout = time.Duration(es.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, es.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpResp, err := externalScalingHTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		// drain the body so the connection can be reused
+		_, _ = io.Copy(io.Discard, httpResp.Body)
+		return nil, fmt.Errorf("endpoint returned status code %d", httpResp.StatusCode)
+	}
+	var resp ExternalScalingResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if resp.StandingBy == nil || *resp.StandingBy < 0 || (resp.Max != nil && *resp.Max < 0) {
+		return nil, errors.New("invalid response: standingBy is required and standingBy and max must be non-negative")
+	}
+	return &resp, nil
+}
+
+// applyExternalScalingBounds returns the standingBy and max of the decision of the endpoint, after applying the safety bounds
+// max is never more than the Max of the GameServerBuild, and standingBy is clamped between MinStandingBy and MaxStandingBy
+func applyExternalScalingBounds(gsb *mpsv1alpha1.GameServerBuild, resp *ExternalScalingResponse) (int, int) {
+	es := gsb.Spec.ExternalScaling
+	max := gsb.Spec.Max
+	if resp.Max != nil {
+		max = int(math.Min(float64(*resp.Max), float64(gsb.Spec.Max)))
+	}
+	standingBy := int(math.Max(float64(*resp.StandingBy), float64(es.MinStandingBy)))
+	if es.MaxStandingBy > 0 {
+		standingBy = int(math.Min(float64(standingBy), float64(es.MaxStandingBy)))
+	}
+	// the minimum is respected even if the endpoint decided a lower max
+	max = int(math.Max(float64(max), float64(es.MinStandingBy)))
+	return standingBy, max
+}
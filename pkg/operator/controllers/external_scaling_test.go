@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("external scaling tests", func() {
+	now := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	var server *httptest.Server
+	var handler http.HandlerFunc
+	var requests []ExternalScalingRequest
+	BeforeEach(func() {
+		requests = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req ExternalScalingRequest
+			Expect(json.NewDecoder(r.Body).Decode(&req)).To(Succeed())
+			requests = append(requests, req)
+			handler(w, r)
+		}))
+		DeferCleanup(server.Close)
+	})
+	respond := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}
+	}
+	newBuild := func(name string) *mpsv1alpha1.GameServerBuild {
+		gsb := testGenerateGameServerBuild(name, "default", "build-id-external", 2, 100, false)
+		gsb.Spec.ExternalScaling = &mpsv1alpha1.ExternalScaling{URL: server.URL, IntervalSeconds: 60, TimeoutSeconds: 1, MinStandingBy: 2, MaxStandingBy: 20}
+		return &gsb
+	}
+
+	It("should apply the decision of the endpoint within the bounds", func() {
+		gsb := newBuild("external-scaling-bounds")
+		recorder := record.NewFakeRecorder(10)
+		handler = respond(`{"standingBy":50,"max":500}`)
+		status := requestExternalScaling(context.Background(), recorder, gsb, nil, &ExternalScalingRequest{BuildName: gsb.Name, CurrentActive: 7}, now)
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].BuildName).To(Equal(gsb.Name))
+		Expect(requests[0].CurrentActive).To(Equal(7))
+		Expect(status.StandingBy).To(Equal(20))
+		Expect(status.Max).To(Equal(100))
+		Expect(status.LastDecisionTime.Time).To(Equal(now))
+		Expect(status.LastError).To(BeEmpty())
+		Expect(<-recorder.Events).To(ContainSubstring("External scaling decided standingBy 20 and max 100"))
+
+		handler = respond(`{"standingBy":0,"max":1}`)
+		status = requestExternalScaling(context.Background(), recorder, gsb, status, &ExternalScalingRequest{}, now.Add(time.Minute))
+		Expect(status.StandingBy).To(Equal(2))
+		Expect(status.Max).To(Equal(2))
+		// the max of the spec is used if the endpoint does not return one
+		handler = respond(`{"standingBy":5}`)
+		status = requestExternalScaling(context.Background(), recorder, gsb, status, &ExternalScalingRequest{}, now.Add(2*time.Minute))
+		Expect(status.StandingBy).To(Equal(5))
+		Expect(status.Max).To(Equal(100))
+	})
+	It("should send the requests in the background and return the last decision", func() {
+		gsb := newBuild("external-scaling-poller")
+		recorder := record.NewFakeRecorder(10)
+		p := NewExternalScalingPoller(recorder)
+		release := make(chan struct{})
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.Write([]byte(`{"standingBy":5}`))
+		}
+		// the status of the GameServerBuild is used until the first request completes
+		gsb.Status.ExternalScaling = &mpsv1alpha1.ExternalScalingStatus{StandingBy: 3, Max: 30}
+		status, requeueAfter := p.decision(gsb, &ExternalScalingRequest{}, now)
+		Expect(status).To(BeIdenticalTo(gsb.Status.ExternalScaling))
+		Expect(requeueAfter).To(Equal(time.Minute))
+		Expect(p.jobs).To(HaveLen(1))
+		// there is no other request while one is in flight, even after the interval
+		status, _ = p.decision(gsb, &ExternalScalingRequest{}, now.Add(2*time.Minute))
+		Expect(status).To(BeIdenticalTo(gsb.Status.ExternalScaling))
+		Expect(p.jobs).To(HaveLen(1))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		go p.Start(ctx)
+		close(release)
+		var e event.GenericEvent
+		Eventually(p.events).Should(Receive(&e))
+		Expect(e.Object.GetName()).To(Equal(gsb.Name))
+		Expect(<-recorder.Events).To(ContainSubstring("External scaling decided standingBy 5 and max 100"))
+
+		// the decision is returned without a new request until the interval has passed
+		status, requeueAfter = p.decision(gsb, &ExternalScalingRequest{}, now.Add(20*time.Second))
+		Expect(status.StandingBy).To(Equal(5))
+		Expect(status.Max).To(Equal(100))
+		Expect(requeueAfter).To(Equal(40 * time.Second))
+		Expect(p.jobs).To(BeEmpty())
+
+		// the state is removed when the GameServerBuild is deleted
+		p.forget("default/" + gsb.Name)
+		cancel()
+		status, _ = p.decision(gsb, &ExternalScalingRequest{}, now.Add(30*time.Second))
+		Expect(status).To(BeIdenticalTo(gsb.Status.ExternalScaling))
+	})
+	It("should keep the last good decision if the endpoint fails", func() {
+		gsb := newBuild("external-scaling-failure")
+		recorder := record.NewFakeRecorder(10)
+		// no decision yet, so the spec is used
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		status := requestExternalScaling(context.Background(), recorder, gsb, nil, &ExternalScalingRequest{}, now)
+		Expect(status.LastDecisionTime).To(BeNil())
+		Expect(status.LastError).To(ContainSubstring("500"))
+		Expect(<-recorder.Events).To(ContainSubstring("keeping the standingBy and max of the spec"))
+		scaling := getBuildScaling(gsb, 0, status, now)
+		Expect(scaling.standingBy).To(Equal(2))
+		Expect(scaling.max).To(Equal(100))
+
+		handler = respond(`{"standingBy":10,"max":50}`)
+		status = requestExternalScaling(context.Background(), recorder, gsb, status, &ExternalScalingRequest{}, now.Add(time.Minute))
+		Expect(status.LastError).To(BeEmpty())
+		<-recorder.Events
+
+		for i, h := range []http.HandlerFunc{
+			respond(`{"max":50}`),
+			respond(`{"standingBy":-1}`),
+			respond(`not json`),
+			func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+		} {
+			handler = h
+			failed := requestExternalScaling(context.Background(), recorder, gsb, status, &ExternalScalingRequest{}, now.Add(time.Duration(i+2)*time.Minute))
+			Expect(failed.StandingBy).To(Equal(10))
+			Expect(failed.Max).To(Equal(50))
+			Expect(failed.LastDecisionTime.Time).To(Equal(now.Add(time.Minute)))
+			Expect(failed.LastError).ToNot(BeEmpty())
+			Expect(<-recorder.Events).To(ContainSubstring("keeping standingBy 10 and max 50"))
+			scaling := getBuildScaling(gsb, 0, failed, now)
+			Expect(scaling.standingBy).To(Equal(10))
+			Expect(scaling.max).To(Equal(50))
+			Expect(scaling.external).To(Equal(failed))
+		}
+	})
+})
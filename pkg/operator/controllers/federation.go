@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+const (
+	// maxFederationResponseSize is the maximum size of a response body we read from a peer allocation API service
+	maxFederationResponseSize = 64 * 1024
+)
+
+// errNoPeerResponse is wrapped by the errors of the requests whose outcome is unknown, since the peer did not return a response
+// the allocation might have succeeded in the peer cluster, so these requests must not fall back to another region
+var errNoPeerResponse = errors.New("no response from peer")
+
+// LatencyMeasurement is the latency a client has measured to a region
+type LatencyMeasurement struct {
+	Region    string `json:"region"`
+	LatencyMs int    `json:"latencyMs"`
+}
+
+// FederatedAllocateArgs contains information necessary to allocate a GameServer in one of the federated clusters
+type FederatedAllocateArgs struct {
+	AllocateArgs
+	// PreferredRegions is the list of regions to try, in order of preference
+	PreferredRegions []string `json:"preferredRegions"`
+	// LatencyMeasurements are the latencies the client has measured to each region
+	// if they are provided, regions are tried in ascending order of latency
+	LatencyMeasurements []LatencyMeasurement `json:"latencyMeasurements"`
+}
+
+// FederatedAllocateResponse contains details that are returned on a successful federated GameServer allocation call
+type FederatedAllocateResponse struct {
+	RequestMultiplayerServerResponse
+	// Region is the region of the cluster the GameServer was allocated in
+	Region string
+}
+
+// FederationAllocator forwards allocation requests to the allocation API services of peer clusters
+type FederationAllocator struct {
+	// localRegion is the region of this cluster, allocations for this region are served without forwarding
+	localRegion string
+	// peers is a map of region to the base URL of the allocation API service of the cluster in that region
+	peers map[string]string
+	// requestTimeout is the timeout for each request to a peer
+	requestTimeout time.Duration
+	httpClient     *http.Client
+}
+
+// NewFederationAllocator returns a new FederationAllocator
+// peers is a list of "region=url" strings, where url is the base URL of the allocation API service of the cluster in that region
+// if certWatcher is not nil, its certificate is used to authenticate to the peers and to verify their certificates
+func NewFederationAllocator(localRegion string, peers []string, certWatcher *CertificateWatcher, requestTimeout time.Duration) (*FederationAllocator, error) {
+	fa := &FederationAllocator{
+		localRegion:    localRegion,
+		peers:          make(map[string]string),
+		requestTimeout: requestTimeout,
+		httpClient:     &http.Client{},
+	}
+	for _, peer := range peers {
+		region, url, found := strings.Cut(peer, "=")
+		if !found || region == "" || url == "" {
+			return nil, fmt.Errorf("invalid federation peer %q, expected format is region=url", peer)
+		}
+		if region == localRegion {
+			return nil, fmt.Errorf("federation peer %q has the same region as the local cluster", peer)
+		}
+		fa.peers[region] = strings.TrimSuffix(url, "/")
+	}
+	if certWatcher != nil {
+		fa.httpClient.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{
+				GetClientCertificate: certWatcher.GetClientCertificate,
+				// peers are verified against the current CA pool of the CertificateWatcher, since it can be rotated
+				InsecureSkipVerify:    true,
+				VerifyPeerCertificate: certWatcher.VerifyPeerCertificate,
+			},
+		}
+	}
+	return fa, nil
+}
+
+// getRegions returns the regions that should be tried for the provided arguments, in order
+// regions that are not known to the FederationAllocator are skipped
+func (fa *FederationAllocator) getRegions(args *FederatedAllocateArgs) []string {
+	candidates := args.PreferredRegions
+	if len(args.LatencyMeasurements) > 0 {
+		measurements := make([]LatencyMeasurement, len(args.LatencyMeasurements))
+		copy(measurements, args.LatencyMeasurements)
+		sort.SliceStable(measurements, func(i, j int) bool {
+			return measurements[i].LatencyMs < measurements[j].LatencyMs
+		})
+		// if preferred regions are also provided, we only consider them
+		preferred := make(map[string]struct{}, len(args.PreferredRegions))
+		for _, region := range args.PreferredRegions {
+			preferred[region] = struct{}{}
+		}
+		candidates = nil
+		for _, m := range measurements {
+			if _, ok := preferred[m.Region]; ok || len(preferred) == 0 {
+				candidates = append(candidates, m.Region)
+			}
+		}
+	}
+
+	regions := make([]string, 0, len(candidates))
+	seen := make(map[string]struct{}, len(candidates))
+	for _, region := range candidates {
+		if _, ok := seen[region]; ok {
+			continue
+		}
+		if _, ok := fa.peers[region]; !ok && (fa.localRegion == "" || region != fa.localRegion) {
+			continue
+		}
+		seen[region] = struct{}{}
+		regions = append(regions, region)
+	}
+	return regions
+}
+
+// forward sends the allocation request to the peer cluster in the provided region
+func (fa *FederationAllocator) forward(ctx context.Context, region string, args *AllocateArgs) (*RequestMultiplayerServerResponse, error) {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return nil, newAllocationError(http.StatusInternalServerError, err, "error serializing request")
+	}
+	ctx, cancel := context.WithTimeout(ctx, fa.requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fa.peers[region]+"/api/v1/allocate", bytes.NewReader(body))
+	if err != nil {
+		return nil, newAllocationError(http.StatusInternalServerError, err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := fa.httpClient.Do(req)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, context.DeadlineExceeded) {
+			statusCode = http.StatusGatewayTimeout
+		}
+		return nil, newAllocationError(statusCode, fmt.Errorf("%w: %w", errNoPeerResponse, err), fmt.Sprintf("error calling region %s", region))
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, maxFederationResponseSize))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, context.DeadlineExceeded) {
+			statusCode = http.StatusGatewayTimeout
+		}
+		return nil, newAllocationError(statusCode, fmt.Errorf("%w: %w", errNoPeerResponse, err), fmt.Sprintf("error reading response from region %s", region))
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, newAllocationError(res.StatusCode, errors.New(string(resBody)), fmt.Sprintf("allocation in region %s failed", region))
+	}
+	var rs RequestMultiplayerServerResponse
+	if err := json.Unmarshal(resBody, &rs); err != nil {
+		return nil, newAllocationError(http.StatusInternalServerError, err, fmt.Sprintf("error deserializing response from region %s", region))
+	}
+	return &rs, nil
+}
+
+// handleFederatedAllocationRequest allocates a GameServer in the best region based on the preferred regions or the latency measurements
+// if the allocation fails in a region, the next one is tried, unless the outcome of the allocation in that region is unknown
+func (s *AllocationApiServer) handleFederatedAllocationRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		badRequestError(w, s.logger, errors.New("invalid method"), "Only POST is accepted")
+		return
+	}
+
+	var args FederatedAllocateArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		badRequestError(w, s.logger, err, "cannot deserialize json")
+		return
+	}
+	if !validateAllocateArgs(&args.AllocateArgs) {
+		badRequestError(w, s.logger, errors.New("invalid sessionID, buildID or waitTimeoutMs"), "invalid arguments")
+		return
+	}
+	// waiting in one region would delay falling back to the next one
+	if args.WaitTimeoutMs > 0 {
+		badRequestError(w, s.logger, errors.New("invalid waitTimeoutMs"), "waitTimeoutMs is not supported for federated allocations")
+		return
+	}
+	regions := s.federationAllocator.getRegions(&args)
+	if len(regions) == 0 {
+		badRequestError(w, s.logger, errors.New("no known regions"), "preferredRegions or latencyMeasurements must contain at least one known region")
+		return
+	}
+
+	var lastErr error
+	tooManyRequests := false
+	for _, region := range regions {
+		var rs *RequestMultiplayerServerResponse
+		var err error
+		if region == s.federationAllocator.localRegion {
+			var gs *mpsv1alpha1.GameServer
+			gs, err = s.allocate(ctx, &args.AllocateArgs)
+			if err == nil {
+				rs = &RequestMultiplayerServerResponse{
+					IPV4Address: gs.Status.PublicIP,
+					Ports:       gs.Status.Ports,
+					SessionID:   args.SessionID,
+				}
+			}
+		} else {
+			rs, err = s.federationAllocator.forward(ctx, region, &args.AllocateArgs)
+		}
+		if err == nil {
+			FederatedAllocationsCounter.WithLabelValues(region).Inc()
+			if err := json.NewEncoder(w).Encode(FederatedAllocateResponse{RequestMultiplayerServerResponse: *rs, Region: region}); err != nil {
+				internalServerError(w, s.logger, err, "encode json response")
+			}
+			return
+		}
+		// the arguments are the same for all regions, so there is no point in trying the next one
+		if getAllocationErrorStatusCode(err) == http.StatusBadRequest {
+			writeAllocationError(w, s.logger, err)
+			return
+		}
+		// the session might have been allocated in this region, the client should retry the allocation in the same region
+		// instead of getting a second GameServer for its session in another one
+		if errors.Is(err, errNoPeerResponse) {
+			writeAllocationError(w, s.logger, err)
+			return
+		}
+		s.logger.Info("federated allocation failed, trying next region", "region", region, "sessionID", args.SessionID, "buildID", args.BuildID, "error", err.Error())
+		FederatedAllocationFallbacksCounter.WithLabelValues(region).Inc()
+		if getAllocationErrorStatusCode(err) == http.StatusTooManyRequests {
+			tooManyRequests = true
+		}
+		lastErr = err
+	}
+
+	// if any region had no capacity, we return a 429 so the client can retry later
+	if tooManyRequests {
+		tooManyRequestsError(w, s.logger, lastErr, "there are not enough standingBy servers in any of the regions")
+		return
+	}
+	writeAllocationError(w, s.logger, lastErr)
+}
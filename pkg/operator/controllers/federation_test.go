@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+var _ = Describe("federation tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		gsName     string = "testgs"
+	)
+
+	// testNewPeer returns an in-process stand-in for the allocation API service of a peer cluster
+	// it replies with the provided status code and counts the requests it receives
+	testNewPeer := func(statusCode int, ip string, requests *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			atomic.AddInt32(requests, 1)
+			Expect(r.URL.Path).To(Equal("/api/v1/allocate"))
+			var args AllocateArgs
+			Expect(json.NewDecoder(r.Body).Decode(&args)).To(Succeed())
+			if statusCode != http.StatusOK {
+				w.WriteHeader(statusCode)
+				w.Write([]byte(fmt.Sprintf("%d - error", statusCode)))
+				return
+			}
+			json.NewEncoder(w).Encode(RequestMultiplayerServerResponse{IPV4Address: ip, Ports: "80:10000", SessionID: args.SessionID})
+		}))
+	}
+
+	testFederatedAllocate := func(h *AllocationApiServer, body string) (int, FederatedAllocateResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/federation/allocate", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		h.handleFederatedAllocationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		var rs FederatedAllocateResponse
+		if res.StatusCode == http.StatusOK {
+			b, err := io.ReadAll(res.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(json.Unmarshal(b, &rs)).To(Succeed())
+		}
+		return res.StatusCode, rs
+	}
+
+	It("should fail to create a FederationAllocator with invalid peers", func() {
+		_, err := NewFederationAllocator("eastus", []string{"westus"}, nil, time.Second)
+		Expect(err).To(HaveOccurred())
+		_, err = NewFederationAllocator("eastus", []string{"eastus=http://localhost:5000"}, nil, time.Second)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should order regions by preference or latency and skip unknown regions", func() {
+		fa, err := NewFederationAllocator("eastus", []string{"westus=http://westus:5000", "northeurope=http://northeurope:5000/"}, nil, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fa.peers["northeurope"]).To(Equal("http://northeurope:5000"))
+		Expect(fa.getRegions(&FederatedAllocateArgs{
+			PreferredRegions: []string{"westus", "unknown", "eastus", "westus"},
+		})).To(Equal([]string{"westus", "eastus"}))
+		Expect(fa.getRegions(&FederatedAllocateArgs{
+			LatencyMeasurements: []LatencyMeasurement{{Region: "westus", LatencyMs: 80}, {Region: "northeurope", LatencyMs: 20}, {Region: "eastus", LatencyMs: 40}},
+		})).To(Equal([]string{"northeurope", "eastus", "westus"}))
+		Expect(fa.getRegions(&FederatedAllocateArgs{
+			PreferredRegions:    []string{"westus", "eastus"},
+			LatencyMeasurements: []LatencyMeasurement{{Region: "westus", LatencyMs: 80}, {Region: "northeurope", LatencyMs: 20}, {Region: "eastus", LatencyMs: 40}},
+		})).To(Equal([]string{"eastus", "westus"}))
+	})
+	It("should fall back to the next region if a peer has no standingBy servers", func() {
+		var requests1, requests2 int32
+		peer1 := testNewPeer(http.StatusTooManyRequests, "", &requests1)
+		defer peer1.Close()
+		peer2 := testNewPeer(http.StatusOK, "1.2.3.4", &requests2)
+		defer peer2.Close()
+		fa, err := NewFederationAllocator("", []string{"westus=" + peer1.URL, "northeurope=" + peer2.URL}, nil, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, testNewSimpleK8sClient(), allocationApiSvcPort)
+		h.SetFederationAllocator(fa)
+		statusCode, rs := testFederatedAllocate(h, fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"preferredRegions\":[\"westus\",\"northeurope\"]}", sessionID1, buildID1))
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(rs.Region).To(Equal("northeurope"))
+		Expect(rs.IPV4Address).To(Equal("1.2.3.4"))
+		Expect(rs.SessionID).To(Equal(sessionID1))
+		Expect(atomic.LoadInt32(&requests1)).To(Equal(int32(1)))
+		Expect(atomic.LoadInt32(&requests2)).To(Equal(int32(1)))
+	})
+	It("should return 429 if none of the regions have standingBy servers", func() {
+		var requests1, requests2 int32
+		peer1 := testNewPeer(http.StatusTooManyRequests, "", &requests1)
+		defer peer1.Close()
+		peer2 := testNewPeer(http.StatusInternalServerError, "", &requests2)
+		defer peer2.Close()
+		fa, err := NewFederationAllocator("", []string{"westus=" + peer1.URL, "northeurope=" + peer2.URL}, nil, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, testNewSimpleK8sClient(), allocationApiSvcPort)
+		h.SetFederationAllocator(fa)
+		statusCode, _ := testFederatedAllocate(h, fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"preferredRegions\":[\"westus\",\"northeurope\"]}", sessionID1, buildID1))
+		Expect(statusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(atomic.LoadInt32(&requests1)).To(Equal(int32(1)))
+		Expect(atomic.LoadInt32(&requests2)).To(Equal(int32(1)))
+	})
+	It("should not fall back if a peer returns a bad request", func() {
+		var requests1, requests2 int32
+		peer1 := testNewPeer(http.StatusBadRequest, "", &requests1)
+		defer peer1.Close()
+		peer2 := testNewPeer(http.StatusOK, "1.2.3.4", &requests2)
+		defer peer2.Close()
+		fa, err := NewFederationAllocator("", []string{"westus=" + peer1.URL, "northeurope=" + peer2.URL}, nil, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, testNewSimpleK8sClient(), allocationApiSvcPort)
+		h.SetFederationAllocator(fa)
+		statusCode, _ := testFederatedAllocate(h, fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"preferredRegions\":[\"westus\",\"northeurope\"]}", sessionID1, buildID1))
+		Expect(statusCode).To(Equal(http.StatusBadRequest))
+		Expect(atomic.LoadInt32(&requests2)).To(Equal(int32(0)))
+	})
+	It("should not fall back if a peer does not respond", func() {
+		var requests2 int32
+		release := make(chan struct{})
+		slowPeer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer slowPeer.Close()
+		defer close(release)
+		closedPeer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		closedPeer.Close()
+		peer2 := testNewPeer(http.StatusOK, "1.2.3.4", &requests2)
+		defer peer2.Close()
+		fa, err := NewFederationAllocator("", []string{"westus=" + slowPeer.URL, "eastus=" + closedPeer.URL, "northeurope=" + peer2.URL}, nil, 100*time.Millisecond)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, testNewSimpleK8sClient(), allocationApiSvcPort)
+		h.SetFederationAllocator(fa)
+		// the allocation might have succeeded in the peer cluster, so the client has to retry in the same region
+		statusCode, _ := testFederatedAllocate(h, fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"preferredRegions\":[\"westus\",\"northeurope\"]}", sessionID1, buildID1))
+		Expect(statusCode).To(Equal(http.StatusGatewayTimeout))
+		statusCode, _ = testFederatedAllocate(h, fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"preferredRegions\":[\"eastus\",\"northeurope\"]}", sessionID1, buildID1))
+		Expect(statusCode).To(Equal(http.StatusInternalServerError))
+		Expect(atomic.LoadInt32(&requests2)).To(Equal(int32(0)))
+	})
+	It("should allocate in the local region without forwarding", func() {
+		var requests int32
+		peer := testNewPeer(http.StatusOK, "1.2.3.4", &requests)
+		defer peer.Close()
+		client := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		fa, err := NewFederationAllocator("eastus", []string{"westus=" + peer.URL}, nil, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.SetFederationAllocator(fa)
+		h.gameServerQueue = NewGameServersQueue()
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            gsName,
+			Namespace:       "default",
+			BuildID:         buildID1,
+			ResourceVersion: gs.ObjectMeta.ResourceVersion,
+		})
+		body := fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"latencyMeasurements\":[{\"region\":\"westus\",\"latencyMs\":50},{\"region\":\"eastus\",\"latencyMs\":10}]}", sessionID1, buildID1)
+		statusCode, rs := testFederatedAllocate(h, body)
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(rs.Region).To(Equal("eastus"))
+		Expect(atomic.LoadInt32(&requests)).To(Equal(int32(0)))
+
+		// the local region has no more standingBy servers, so the next allocation should be forwarded
+		body = fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"latencyMeasurements\":[{\"region\":\"westus\",\"latencyMs\":50},{\"region\":\"eastus\",\"latencyMs\":10}]}", "4ee2a1b4-8f3c-4a1d-9b6e-2c7d5f8e1a30", buildID1)
+		statusCode, rs = testFederatedAllocate(h, body)
+		Expect(statusCode).To(Equal(http.StatusOK))
+		Expect(rs.Region).To(Equal("westus"))
+		Expect(atomic.LoadInt32(&requests)).To(Equal(int32(1)))
+	})
+	It("should reject requests with unknown regions or waitTimeoutMs", func() {
+		fa, err := NewFederationAllocator("eastus", nil, nil, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, testNewSimpleK8sClient(), allocationApiSvcPort)
+		h.SetFederationAllocator(fa)
+		statusCode, _ := testFederatedAllocate(h, fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"preferredRegions\":[\"westus\"]}", sessionID1, buildID1))
+		Expect(statusCode).To(Equal(http.StatusBadRequest))
+		statusCode, _ = testFederatedAllocate(h, fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"preferredRegions\":[\"eastus\"],\"waitTimeoutMs\":100}", sessionID1, buildID1))
+		Expect(statusCode).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -43,6 +43,13 @@ var (
 	apiGVStr = mpsv1alpha1.GroupVersion.String()
 
 	podsUnderCreation = sync.Map{}
+	// observedStandingByTimes holds the ReachedStandingByOn time of the last StandingBy lifecycle event of each GameServer,
+	// so that the event is emitted once per transition to StandingBy
+	// key is the namespaced name of the GameServer
+	observedStandingByTimes = sync.Map{}
+	// controllerStartTime is the time the controller started, GameServers that reached StandingBy before it
+	// are not emitted again since the previous instance of the controller has already observed them
+	controllerStartTime = time.Now()
 )
 
 const SafeToEvictPodAttribute string = "cluster-autoscaler.kubernetes.io/safe-to-evict"
@@ -56,6 +63,10 @@ type GameServerReconciler struct {
 	InitContainerImageLinux string
 	InitContainerImageWin   string
 	GetNodeDetailsProvider  func(ctx context.Context, r client.Reader, nodeName string) (string, string, int, error) // we abstract this for testing purposes
+	// TerminationGracePeriod is the time a GameServer process has to exit after it was marked for termination
+	TerminationGracePeriod time.Duration
+	// EventSink sends the GameServer lifecycle events, it can be nil if lifecycle events are disabled
+	EventSink *EventSink
 }
 
 // NewGameServerReconciler returns a pointer to a new GameServerReconciler
@@ -63,7 +74,8 @@ func NewGameServerReconciler(mgr manager.Manager,
 	portRegistry *PortRegistry,
 	getNodeDetailsProvider func(ctx context.Context, r client.Reader, nodeName string) (string, string, int, error),
 	initContainerImageLinux string,
-	initContainerImageWin string) *GameServerReconciler {
+	initContainerImageWin string,
+	terminationGracePeriod time.Duration) *GameServerReconciler {
 	return &GameServerReconciler{
 		Client:                  mgr.GetClient(),
 		Scheme:                  mgr.GetScheme(),
@@ -72,6 +84,7 @@ func NewGameServerReconciler(mgr manager.Manager,
 		GetNodeDetailsProvider:  getNodeDetailsProvider,
 		InitContainerImageLinux: initContainerImageLinux,
 		InitContainerImageWin:   initContainerImageWin,
+		TerminationGracePeriod:  terminationGracePeriod,
 	}
 }
 
@@ -102,6 +115,7 @@ func (r *GameServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	if err := r.Get(ctx, req.NamespacedName, &gs); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Info("Unable to fetch GameServer, it has probably been deleted. Trying to deregister ports")
+			observedStandingByTimes.Delete(req.NamespacedName)
 			ports, err := r.PortRegistry.DeregisterPorts(req.Namespace, req.Name)
 			if err != nil {
 				return ctrl.Result{}, err
@@ -170,10 +184,20 @@ func (r *GameServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}
 
+	// the GameServer was marked for termination and its process has not exited yet
+	// it is deleted if the process does not exit within the grace period
+	if gs.Status.TerminationRequestedOn != nil {
+		return r.terminateIfGracePeriodExpired(ctx, &gs)
+	}
+
 	// if a game server is active, there are players present.
 	// When using the cluster autoscaler, an annotation will be added
 	// to prevent the node from being scaled down.
 	r.Recorder.Eventf(&gs, corev1.EventTypeNormal, "Update", "Gameserver %s state is %s, health is %s", gs.Name, gs.Status.State, gs.Status.Health)
+	// the GameServer becomes StandingBy after its initialization or after its session was released
+	if reachedStandingBy(&gs, controllerStartTime) {
+		r.EventSink.Emit(LifecycleEventStandingBy, &gs)
+	}
 	err := r.addSafeToEvictAnnotationIfNecessary(ctx, &gs, &pod)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -263,7 +287,8 @@ func (r *GameServerReconciler) addSafeToEvictAnnotationIfNecessary(ctx context.C
 	// we don't need to check if pod.ObjectMeta.Annotations is nil since the check below accommodates for that
 	// https://go.dev/play/p/O9QmzPnKsOK
 	if gs.Status.State == mpsv1alpha1.GameServerStateInitializing || gs.Status.State == mpsv1alpha1.GameServerStateStandingBy {
-		if _, ok := pod.ObjectMeta.Annotations[SafeToEvictPodAttribute]; !ok {
+		// a StandingBy GameServer might have been Active before, if it was released back to StandingBy
+		if val, ok := pod.ObjectMeta.Annotations[SafeToEvictPodAttribute]; !ok || val == strconv.FormatBool(false) {
 			return r.patchPodSafeToEvictAnnotation(ctx, pod, true)
 		}
 	} else if gs.Status.State == mpsv1alpha1.GameServerStateActive {
@@ -288,3 +313,19 @@ func (r *GameServerReconciler) patchPodSafeToEvictAnnotation(ctx context.Context
 	}
 	return nil
 }
+
+// reachedStandingBy returns true if the GameServer reached StandingBy since the last time it was observed
+// transitions are told apart by ReachedStandingByOn, which unlike the in-memory state survives restarts of the controller,
+// so a GameServer that is observed for the first time is new only if it reached StandingBy after startTime
+func reachedStandingBy(gs *mpsv1alpha1.GameServer, startTime time.Time) bool {
+	if gs.Status.State != mpsv1alpha1.GameServerStateStandingBy || gs.Status.ReachedStandingByOn == nil {
+		return false
+	}
+	reachedOn := gs.Status.ReachedStandingByOn.Time
+	previous, loaded := observedStandingByTimes.Swap(client.ObjectKeyFromObject(gs), reachedOn)
+	if loaded {
+		return !previous.(time.Time).Equal(reachedOn)
+	}
+	// the status keeps the times with a precision of a second
+	return !reachedOn.Before(startTime.Truncate(time.Second))
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+// reasons of failed GameServerAllocations, they are set on the status and on the events
+// TooManyRequests is used when there are no StandingBy GameServers or when a rate limit or quota was exceeded
+const (
+	allocationFailedReasonInvalidSpec     = "InvalidSpec"
+	allocationFailedReasonForbidden       = "Forbidden"
+	allocationFailedReasonBuildNotFound   = "BuildNotFound"
+	allocationFailedReasonConflict        = "Conflict"
+	allocationFailedReasonTooManyRequests = "TooManyRequests"
+)
+
+// GameServerAllocationReconciler reconciles a GameServerAllocation object
+// it allocates a GameServer using the queue and the patch logic of the allocation API service and writes the result to the status
+type GameServerAllocationReconciler struct {
+	client.Client
+	Scheme   *k8sruntime.Scheme
+	Recorder record.EventRecorder
+	// AllocationApiServer is the allocation API service whose queue is used to allocate GameServers
+	AllocationApiServer *AllocationApiServer
+}
+
+// NewGameServerAllocationReconciler returns a pointer to a new GameServerAllocationReconciler
+func NewGameServerAllocationReconciler(mgr manager.Manager, aas *AllocationApiServer) *GameServerAllocationReconciler {
+	return &GameServerAllocationReconciler{
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		Recorder:            mgr.GetEventRecorderFor("GameServerAllocation"),
+		AllocationApiServer: aas,
+	}
+}
+
+//+kubebuilder:rbac:groups=mps.playfab.com,resources=gameserverallocations,verbs=get;list;watch
+//+kubebuilder:rbac:groups=mps.playfab.com,resources=gameserverallocations/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile allocates a GameServer for a pending GameServerAllocation
+// GameServerAllocations that already have a result are not reconciled again. Since allocating the same session again returns the
+// GameServer that was already allocated for it, a GameServerAllocation whose status could not be updated can be safely retried
+func (r *GameServerAllocationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var gsa mpsv1alpha1.GameServerAllocation
+	if err := r.Get(ctx, req.NamespacedName, &gsa); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "unable to fetch GameServerAllocation")
+		return ctrl.Result{}, err
+	}
+
+	if gsa.Status.State != "" || !gsa.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	args := &AllocateArgs{
+		BuildID:         gsa.Spec.BuildID,
+		SessionID:       gsa.Spec.SessionID,
+		SessionCookie:   gsa.Spec.SessionCookie,
+		InitialPlayers:  gsa.Spec.InitialPlayers,
+		SessionMetadata: gsa.Spec.SessionMetadata,
+	}
+
+	patch := client.MergeFrom(gsa.DeepCopy())
+	var err error
+	if !validateAllocateArgs(args) {
+		err = newAllocationError(http.StatusBadRequest, errors.New("invalid spec"), "buildID and sessionID must be valid UUIDs")
+	} else {
+		var gs *mpsv1alpha1.GameServer
+		if gs, err = r.AllocationApiServer.allocate(ctx, args); err == nil {
+			gsa.Status.State = mpsv1alpha1.GameServerAllocationStateAllocated
+			gsa.Status.GameServerName = gs.Name
+			gsa.Status.GameServerNamespace = gs.Namespace
+			gsa.Status.NodeName = gs.Status.NodeName
+			gsa.Status.PublicIP = gs.Status.PublicIP
+			gsa.Status.Ports = gs.Status.Ports
+			allocatedOn := metav1.Now()
+			if gs.Status.ReachedActiveOn != nil {
+				allocatedOn = *gs.Status.ReachedActiveOn
+			}
+			gsa.Status.AllocatedOn = &allocatedOn
+		}
+	}
+	if err != nil {
+		reason := getAllocationFailedReason(err)
+		// internal errors are transient, so we return them to retry the allocation
+		if reason == "" {
+			log.Error(err, "error allocating GameServer", "buildID", args.BuildID, "sessionID", args.SessionID)
+			return ctrl.Result{}, err
+		}
+		gsa.Status.State = mpsv1alpha1.GameServerAllocationStateFailed
+		gsa.Status.Reason = reason
+		gsa.Status.Message = err.Error()
+	}
+
+	if err := r.Status().Patch(ctx, &gsa, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+	if gsa.Status.State == mpsv1alpha1.GameServerAllocationStateAllocated {
+		r.Recorder.Eventf(&gsa, corev1.EventTypeNormal, "Allocated", "Allocated GameServer %s/%s", gsa.Status.GameServerNamespace, gsa.Status.GameServerName)
+	} else {
+		r.Recorder.Eventf(&gsa, corev1.EventTypeWarning, gsa.Status.Reason, "Allocation failed: %s", gsa.Status.Message)
+	}
+	return ctrl.Result{}, nil
+}
+
+// getAllocationFailedReason returns the reason of a failed GameServerAllocation for the provided allocation error
+// returns an empty string for internal errors, which should be retried
+func getAllocationFailedReason(err error) string {
+	switch getAllocationErrorStatusCode(err) {
+	case http.StatusBadRequest:
+		return allocationFailedReasonInvalidSpec
+	case http.StatusForbidden:
+		return allocationFailedReasonForbidden
+	case http.StatusNotFound:
+		return allocationFailedReasonBuildNotFound
+	case http.StatusConflict:
+		return allocationFailedReasonConflict
+	case http.StatusTooManyRequests:
+		return allocationFailedReasonTooManyRequests
+	default:
+		return ""
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *GameServerAllocationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&mpsv1alpha1.GameServerAllocation{}).
+		Complete(r)
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("GameServerAllocation controller tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		buildID2   string = "5f0e6e4b-7b8a-4c3d-9e2f-1a2b3c4d5e6f"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		gsName     string = "testgs"
+		gsaName    string = "testgsa"
+	)
+
+	testNewReconciler := func(cl client.Client) (*GameServerAllocationReconciler, *AllocationApiServer) {
+		h := NewAllocationApiServer(nil, cl, allocationApiSvcPort)
+		return &GameServerAllocationReconciler{
+			Client:              cl,
+			Recorder:            record.NewFakeRecorder(10),
+			AllocationApiServer: h,
+		}, h
+	}
+
+	testReconcileGameServerAllocation := func(cl client.Client, r *GameServerAllocationReconciler, buildID string) *mpsv1alpha1.GameServerAllocation {
+		gsa := &mpsv1alpha1.GameServerAllocation{
+			ObjectMeta: metav1.ObjectMeta{Name: gsaName, Namespace: "default"},
+			Spec: mpsv1alpha1.GameServerAllocationSpec{
+				BuildID:         buildID,
+				SessionID:       sessionID1,
+				SessionCookie:   "cookie",
+				SessionMetadata: map[string]string{"map": "de_dust2"},
+			},
+		}
+		Expect(cl.Create(context.Background(), gsa)).To(Succeed())
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: gsaName}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsaName}, gsa)).To(Succeed())
+		return gsa
+	}
+
+	It("should allocate a game server and write the result to the status", func() {
+		cl := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(cl, gsName, buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		patch := client.MergeFrom(gs.DeepCopy())
+		gs.Status.PublicIP = "1.2.3.4"
+		gs.Status.Ports = "gameport:10000"
+		Expect(cl.Status().Patch(context.Background(), gs, patch)).To(Succeed())
+		r, h := testNewReconciler(cl)
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            gs.Name,
+			Namespace:       gs.Namespace,
+			BuildID:         buildID1,
+			ResourceVersion: gs.ResourceVersion,
+		})
+
+		gsa := testReconcileGameServerAllocation(cl, r, buildID1)
+		Expect(gsa.Status.State).To(Equal(mpsv1alpha1.GameServerAllocationStateAllocated))
+		Expect(gsa.Status.GameServerName).To(Equal(gsName))
+		Expect(gsa.Status.GameServerNamespace).To(Equal("default"))
+		Expect(gsa.Status.PublicIP).To(Equal("1.2.3.4"))
+		Expect(gsa.Status.Ports).To(Equal("gameport:10000"))
+		Expect(gsa.Status.AllocatedOn).ToNot(BeNil())
+
+		Expect(cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsName}, gs)).To(Succeed())
+		Expect(gs.Status.State).To(Equal(mpsv1alpha1.GameServerStateActive))
+		Expect(gs.Status.SessionID).To(Equal(sessionID1))
+		Expect(gs.Status.SessionCookie).To(Equal("cookie"))
+		Expect(gs.Status.SessionMetadata).To(HaveKeyWithValue("map", "de_dust2"))
+
+		// a fulfilled GameServerAllocation is not reconciled again
+		gsa.Spec.SessionID = "7b8e4f2a-3c1d-4e5f-9a6b-0c1d2e3f4a5b"
+		Expect(cl.Update(context.Background(), gsa)).To(Succeed())
+		_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: gsaName}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsName}, gs)).To(Succeed())
+		Expect(gs.Status.SessionID).To(Equal(sessionID1))
+	})
+	It("should write the failure reason to the status", func() {
+		cl := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(cl, gsName, buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		r, _ := testNewReconciler(cl)
+
+		// the GameServer was not pushed to the queue, so there are no StandingBy servers
+		gsa := testReconcileGameServerAllocation(cl, r, buildID1)
+		Expect(gsa.Status.State).To(Equal(mpsv1alpha1.GameServerAllocationStateFailed))
+		Expect(gsa.Status.Reason).To(Equal(allocationFailedReasonTooManyRequests))
+		Expect(gsa.Status.Message).ToNot(BeEmpty())
+		Expect(gsa.Status.GameServerName).To(BeEmpty())
+
+		Expect(cl.Delete(context.Background(), gsa)).To(Succeed())
+		gsa = testReconcileGameServerAllocation(cl, r, buildID2)
+		Expect(gsa.Status.State).To(Equal(mpsv1alpha1.GameServerAllocationStateFailed))
+		Expect(gsa.Status.Reason).To(Equal(allocationFailedReasonBuildNotFound))
+	})
+})
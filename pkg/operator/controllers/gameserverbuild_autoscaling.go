@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"math"
+	"time"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// autoscalingStepRequeueInterval is how soon a GameServerBuild is reconciled again after a scale down was limited by MaxScaleDownStep
+// and there is no cool-off, so that the scale down continues even if none of its GameServers changes
+const autoscalingStepRequeueInterval = 5 * time.Second
+
+// buildScaling contains the number of standingBy and max servers the GameServerBuildReconciler keeps for a GameServerBuild on a reconcile
+type buildScaling struct {
+	// standingBy is the effective number of standingBy servers
+	standingBy int
+	// max is the effective maximum number of servers in any state
+	max int
+	// lastScaleDownTime is the last time the effective standingBy was decreased by Autoscaling
+	lastScaleDownTime *metav1.Time
+	// schedule is the name of the active schedule, if any
+	schedule string
+	// scheduleEndTime is the end of the window of the active schedule
+	scheduleEndTime *metav1.Time
+	// external is the last decision of the external scaling endpoint, if it is configured
+	external *mpsv1alpha1.ExternalScalingStatus
+	// requeueAfter is larger than zero if a scale down was delayed or a schedule window starts or ends later,
+	// so the GameServerBuild should be reconciled again
+	requeueAfter time.Duration
+}
+
+// getBuildScaling returns the effective number of standingBy and max servers of the GameServerBuild
+// the StandingBy and Max of the spec are replaced by the last decision of the external scaling endpoint, if any,
+// and they are overridden by the active schedule, if any
+// if Autoscaling is set, standingBy is calculated from the buffer policy and the number of Active and Reserved GameServers,
+// raised to the standingBy of the active schedule, and decreases are limited by the scale down cool-off and step,
+// starting from the effective standingBy of the previous reconcile
+func getBuildScaling(gsb *mpsv1alpha1.GameServerBuild, allocatedCount int, external *mpsv1alpha1.ExternalScalingStatus, now time.Time) buildScaling {
+	scaling := buildScaling{
+		standingBy:        gsb.Spec.StandingBy,
+		max:               gsb.Spec.Max,
+		lastScaleDownTime: gsb.Status.LastScaleDownTime,
+		external:          external,
+	}
+	if external != nil && external.LastDecisionTime != nil {
+		scaling.standingBy = external.StandingBy
+		scaling.max = external.Max
+	}
+	schedule, scheduleEnd, nextBoundary := getActiveSchedule(gsb.Spec.Schedules, now)
+	scaling.requeueAfter = nextBoundary
+	if schedule != nil {
+		scaling.schedule = schedule.Name
+		scheduleEndTime := metav1.NewTime(scheduleEnd)
+		scaling.scheduleEndTime = &scheduleEndTime
+		if schedule.Max != nil {
+			scaling.max = *schedule.Max
+		}
+		if schedule.StandingBy != nil {
+			scaling.standingBy = *schedule.StandingBy
+		}
+	}
+	scaling.standingBy = int(math.Min(float64(scaling.standingBy), float64(scaling.max)))
+
+	autoscaling := gsb.Spec.Autoscaling
+	if autoscaling == nil || autoscaling.Buffer == nil {
+		return scaling
+	}
+
+	desired := getBufferStandingBy(autoscaling.Buffer, allocatedCount, scaling.max)
+	if schedule != nil && schedule.StandingBy != nil {
+		desired = int(math.Max(float64(desired), float64(scaling.standingBy)))
+	}
+	previous := gsb.Status.EffectiveStandingBy
+	if desired >= previous {
+		scaling.standingBy = desired
+		return scaling
+	}
+
+	// we're scaling down, so we respect the cool-off since the last scale down
+	coolOff := time.Duration(autoscaling.ScaleDownCoolOffSeconds) * time.Second
+	if coolOff > 0 && gsb.Status.LastScaleDownTime != nil {
+		if coolOffEnd := gsb.Status.LastScaleDownTime.Add(coolOff); now.Before(coolOffEnd) {
+			// the previous value may be above a max that was lowered since
+			scaling.standingBy = int(math.Min(float64(previous), float64(scaling.max)))
+			scaling.setRequeueAfter(coolOffEnd.Sub(now))
+			return scaling
+		}
+	}
+	// and we don't scale down more than the step at a time
+	if autoscaling.MaxScaleDownStep > 0 && previous-desired > autoscaling.MaxScaleDownStep {
+		desired = int(math.Min(float64(previous-autoscaling.MaxScaleDownStep), float64(scaling.max)))
+		if coolOff > 0 {
+			scaling.setRequeueAfter(coolOff)
+		} else {
+			scaling.setRequeueAfter(autoscalingStepRequeueInterval)
+		}
+	}
+	scaling.standingBy = desired
+	lastScaleDownTime := metav1.NewTime(now)
+	scaling.lastScaleDownTime = &lastScaleDownTime
+	return scaling
+}
+
+// setRequeueAfter sets requeueAfter to the provided duration, if it is sooner than the current one
+func (s *buildScaling) setRequeueAfter(d time.Duration) {
+	if s.requeueAfter == 0 || d < s.requeueAfter {
+		s.requeueAfter = d
+	}
+}
+
+// getBufferStandingBy returns the number of standingBy servers of the buffer policy for the provided number of Active and Reserved GameServers
+// the result is clamped between the minimum and maximum of the policy, and it is never larger than max
+func getBufferStandingBy(buffer *mpsv1alpha1.BufferPolicy, allocatedCount, max int) int {
+	// invalid sizes are rejected by the webhook, we fall back to the minimum in case it is not installed
+	standingBy, err := intstr.GetScaledValueFromIntOrPercent(&buffer.Size, allocatedCount, true)
+	if err != nil {
+		standingBy = 0
+	}
+	standingBy = int(math.Max(float64(standingBy), float64(buffer.MinStandingBy)))
+	if buffer.MaxStandingBy > 0 {
+		standingBy = int(math.Min(float64(standingBy), float64(buffer.MaxStandingBy)))
+	}
+	return int(math.Min(float64(standingBy), float64(max)))
+}
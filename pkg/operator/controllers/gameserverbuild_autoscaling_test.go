@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("GameServerBuild autoscaling tests", func() {
+	now := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	newBuild := func(size intstr.IntOrString, min, max int) *mpsv1alpha1.GameServerBuild {
+		gsb := testGenerateGameServerBuild("test-build-autoscaling", "default", "build-id-autoscaling", 2, 50, false)
+		gsb.Spec.Autoscaling = &mpsv1alpha1.GameServerBuildAutoscaling{
+			Buffer: &mpsv1alpha1.BufferPolicy{Size: size, MinStandingBy: min, MaxStandingBy: max},
+		}
+		return &gsb
+	}
+
+	It("should use the standingBy of the spec if autoscaling is not set", func() {
+		gsb := testGenerateGameServerBuild("test-build-autoscaling", "default", "build-id-autoscaling", 3, 10, false)
+		scaling := getBuildScaling(&gsb, 5, nil, now)
+		Expect(scaling.standingBy).To(Equal(3))
+		Expect(scaling.requeueAfter).To(BeZero())
+	})
+	It("should calculate the buffer", func() {
+		buffer := &mpsv1alpha1.BufferPolicy{Size: intstr.FromInt(4)}
+		Expect(getBufferStandingBy(buffer, 0, 50)).To(Equal(4))
+		Expect(getBufferStandingBy(buffer, 30, 50)).To(Equal(4))
+		// a percentage of the Active and Reserved GameServers, rounded up
+		buffer = &mpsv1alpha1.BufferPolicy{Size: intstr.FromString("20%")}
+		Expect(getBufferStandingBy(buffer, 0, 50)).To(Equal(0))
+		Expect(getBufferStandingBy(buffer, 11, 50)).To(Equal(3))
+		// clamped between the minimum and maximum of the policy and max
+		buffer = &mpsv1alpha1.BufferPolicy{Size: intstr.FromString("20%"), MinStandingBy: 2, MaxStandingBy: 10}
+		Expect(getBufferStandingBy(buffer, 0, 50)).To(Equal(2))
+		Expect(getBufferStandingBy(buffer, 100, 50)).To(Equal(10))
+		Expect(getBufferStandingBy(buffer, 100, 8)).To(Equal(8))
+	})
+	It("should scale up immediately", func() {
+		gsb := newBuild(intstr.FromString("50%"), 2, 0)
+		gsb.Status.EffectiveStandingBy = 2
+		scaling := getBuildScaling(gsb, 10, nil, now)
+		Expect(scaling.standingBy).To(Equal(5))
+		Expect(scaling.lastScaleDownTime).To(BeNil())
+		Expect(scaling.requeueAfter).To(BeZero())
+	})
+	It("should respect the scale down cool-off", func() {
+		gsb := newBuild(intstr.FromString("50%"), 2, 0)
+		gsb.Spec.Autoscaling.ScaleDownCoolOffSeconds = 300
+		gsb.Status.EffectiveStandingBy = 10
+		// no previous scale down, so we can scale down
+		scaling := getBuildScaling(gsb, 4, nil, now)
+		Expect(scaling.standingBy).To(Equal(2))
+		Expect(scaling.lastScaleDownTime.Time).To(Equal(now))
+
+		gsb.Status.LastScaleDownTime = &metav1.Time{Time: now.Add(-time.Minute)}
+		scaling = getBuildScaling(gsb, 4, nil, now)
+		Expect(scaling.standingBy).To(Equal(10))
+		Expect(scaling.lastScaleDownTime).To(Equal(gsb.Status.LastScaleDownTime))
+		Expect(scaling.requeueAfter).To(Equal(4 * time.Minute))
+		// scaling up is not affected by the cool-off
+		scaling = getBuildScaling(gsb, 30, nil, now)
+		Expect(scaling.standingBy).To(Equal(15))
+
+		gsb.Status.LastScaleDownTime = &metav1.Time{Time: now.Add(-5 * time.Minute)}
+		scaling = getBuildScaling(gsb, 4, nil, now)
+		Expect(scaling.standingBy).To(Equal(2))
+		Expect(scaling.lastScaleDownTime.Time).To(Equal(now))
+	})
+	It("should respect the scale down step", func() {
+		gsb := newBuild(intstr.FromInt(2), 0, 0)
+		gsb.Spec.Autoscaling.MaxScaleDownStep = 3
+		gsb.Status.EffectiveStandingBy = 10
+		scaling := getBuildScaling(gsb, 0, nil, now)
+		Expect(scaling.standingBy).To(Equal(7))
+		Expect(scaling.requeueAfter).To(Equal(autoscalingStepRequeueInterval))
+
+		gsb.Spec.Autoscaling.ScaleDownCoolOffSeconds = 60
+		scaling = getBuildScaling(gsb, 0, nil, now)
+		Expect(scaling.standingBy).To(Equal(7))
+		Expect(scaling.requeueAfter).To(Equal(time.Minute))
+
+		gsb.Status.EffectiveStandingBy = 4
+		scaling = getBuildScaling(gsb, 0, nil, now)
+		Expect(scaling.standingBy).To(Equal(2))
+		Expect(scaling.requeueAfter).To(BeZero())
+	})
+})
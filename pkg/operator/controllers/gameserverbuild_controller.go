@@ -27,6 +27,7 @@ import (
 
 	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
@@ -34,16 +35,13 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
-// a map to hold the number of crashes per Build
-// concurrent since the reconcile loop can be called multiple times for different GameServerBuilds
-// key is namespace/name of the GameServerBuild
-// value is the number of crashes
-var crashesPerBuild = sync.Map{}
-
 // Simple async map implementation using a mutex
 // used to manage the expected GameServer creations and deletions
 type MutexMap struct {
@@ -59,18 +57,24 @@ type GameServerBuildReconciler struct {
 	Recorder     record.EventRecorder
 	expectations *GameServerExpectations
 	Config       *Config
+	// EventSink sends the GameServer lifecycle events, it can be nil if lifecycle events are disabled
+	EventSink *EventSink
+	// externalScaling calls the external scaling endpoints outside of the reconcile loop
+	externalScaling *ExternalScalingPoller
 }
 
 // NewGameServerBuildReconciler returns a pointer to a new GameServerBuildReconciler
 func NewGameServerBuildReconciler(mgr manager.Manager, portRegistry *PortRegistry, cfg *Config) *GameServerBuildReconciler {
 	cl := mgr.GetClient()
+	recorder := mgr.GetEventRecorderFor("GameServerBuild")
 	return &GameServerBuildReconciler{
-		Client:       cl,
-		Scheme:       mgr.GetScheme(),
-		PortRegistry: portRegistry,
-		Recorder:     mgr.GetEventRecorderFor("GameServerBuild"),
-		expectations: NewGameServerExpectations(cl),
-		Config:       cfg,
+		Client:          cl,
+		Scheme:          mgr.GetScheme(),
+		PortRegistry:    portRegistry,
+		Recorder:        recorder,
+		expectations:    NewGameServerExpectations(cl),
+		Config:          cfg,
+		externalScaling: NewExternalScalingPoller(recorder),
 	}
 }
 
@@ -92,9 +96,9 @@ func (r *GameServerBuildReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	if err := r.Get(ctx, req.NamespacedName, &gsb); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Info("Unable to fetch GameServerBuild - it is being deleted")
-			// GameServerBuild is being deleted so clear its entry from the crashesPerBuild map
+			// GameServerBuild is being deleted so clear its entry from the external scaling poller
 			// no-op if the entry is not present
-			crashesPerBuild.Delete(getKeyForCrashesPerBuildMap(&gsb))
+			r.externalScaling.forget(req.NamespacedName.String())
 			return ctrl.Result{}, nil
 		}
 		log.Error(err, "unable to fetch gameServerBuild")
@@ -106,13 +110,32 @@ func (r *GameServerBuildReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		GameServerBuildReconcileDuration.WithLabelValues(gsb.Name).Observe(time.Since(startTime).Seconds())
 	}()
 
-	// if GameServerBuild is unhealthy and current crashes equal or more than CrashesToMarkUnhealthy, do nothing more
-	if gsb.Status.Health == mpsv1alpha1.BuildUnhealthy &&
-		gsb.Spec.CrashesToMarkUnhealthy != nil &&
-		gsb.Status.CrashesCount >= *gsb.Spec.CrashesToMarkUnhealthy {
-		log.Info("GameServerBuild is Unhealthy, do nothing")
-		r.Recorder.Event(&gsb, corev1.EventTypeNormal, "Unhealthy Build", "GameServerBuild is Unhealthy, stopping reconciliation")
-		return ctrl.Result{}, nil
+	// the finalizer makes the deletion of the GameServerBuild wait until its Active GameServers end their sessions
+	if gsb.DeletionTimestamp.IsZero() && !controllerutil.ContainsFinalizer(&gsb, mpsv1alpha1.GameServerBuildFinalizer) {
+		patch := client.MergeFrom(gsb.DeepCopy())
+		controllerutil.AddFinalizer(&gsb, mpsv1alpha1.GameServerBuildFinalizer)
+		if err := r.Patch(ctx, &gsb, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	// unless the user has asked to delete it without waiting
+	if isForceDeleted(&gsb) {
+		r.Recorder.Event(&gsb, corev1.EventTypeNormal, "ForceDeleted", "GameServerBuild is deleted without waiting for its Active GameServers")
+		return ctrl.Result{}, r.removeFinalizer(ctx, &gsb)
+	}
+
+	// a GameServerBuild that is being deleted is Draining
+	mode := getBuildMode(&gsb)
+
+	// if GameServerBuild is unhealthy and its recent crashes are equal or more than CrashesToMarkUnhealthy, do nothing more
+	// until enough crashes leave the crash window for it to recover
+	// a Draining GameServerBuild is still reconciled, since it does not create GameServers
+	if gsb.Status.Health == mpsv1alpha1.BuildUnhealthy && mode != mpsv1alpha1.BuildModeDraining {
+		if unhealthy, recoverAfter := getBuildRecovery(&gsb, time.Now()); unhealthy {
+			log.Info("GameServerBuild is Unhealthy, do nothing", "recoverAfter", recoverAfter)
+			r.Recorder.Event(&gsb, corev1.EventTypeNormal, "Unhealthy Build", "GameServerBuild is Unhealthy, stopping reconciliation")
+			return ctrl.Result{RequeueAfter: recoverAfter}, nil
+		}
 	}
 
 	deletionsCompleted, err := r.expectations.gameServersUnderDeletionWereDeleted(ctx, &gsb)
@@ -139,9 +162,10 @@ func (r *GameServerBuildReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	}
 
 	// calculate counts by state so we can update .status accordingly
-	var activeCount, standingByCount, crashesCount, initializingCount, pendingCount int
+	var activeCount, reservedCount, standingByCount, crashesCount, processCrashesCount, initializingCount, pendingCount, reusesCount int
 	for i := 0; i < len(gameServers.Items); i++ {
 		gs := gameServers.Items[i]
+		reusesCount += gs.Status.ReuseCount
 
 		if gs.Status.State == "" && gs.Status.Health != mpsv1alpha1.GameServerUnhealthy { // under normal circumstances, Health will also be equal to ""
 			pendingCount++
@@ -151,21 +175,26 @@ func (r *GameServerBuildReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 			standingByCount++
 		} else if gs.Status.State == mpsv1alpha1.GameServerStateActive && gs.Status.Health == mpsv1alpha1.GameServerHealthy {
 			activeCount++
+		} else if gs.Status.State == mpsv1alpha1.GameServerStateReserved && gs.Status.Health == mpsv1alpha1.GameServerHealthy {
+			reservedCount++
 		} else if gs.Status.State == mpsv1alpha1.GameServerStateGameCompleted && gs.Status.Health == mpsv1alpha1.GameServerHealthy {
 			// game server process exited with code 0
 			if err := r.Delete(ctx, &gs); err != nil {
 				return ctrl.Result{}, err
 			}
 			GameServersSessionEndedCounter.WithLabelValues(gsb.Name).Inc()
+			r.EventSink.Emit(LifecycleEventSessionEnded, &gs)
 			r.expectations.addGameServerToUnderDeletionMap(gsb.Name, gs.Name)
 			r.Recorder.Eventf(&gsb, corev1.EventTypeNormal, "Exited", "GameServer %s session completed", gs.Name)
 		} else if gs.Status.State == mpsv1alpha1.GameServerStateCrashed {
 			// game server process exited with code != 0 (crashed)
 			crashesCount++
+			processCrashesCount++
 			if err := r.Delete(ctx, &gs); err != nil {
 				return ctrl.Result{}, err
 			}
 			GameServersCrashedCounter.WithLabelValues(gsb.Name).Inc()
+			r.EventSink.Emit(LifecycleEventCrashed, &gs)
 			r.expectations.addGameServerToUnderDeletionMap(gsb.Name, gs.Name)
 			r.Recorder.Eventf(&gsb, corev1.EventTypeNormal, "Unhealthy", "GameServer %s was deleted because it became unhealthy, state: %s, health: %s", gs.Name, gs.Status.State, gs.Status.Health)
 		} else if gs.Status.Health == mpsv1alpha1.GameServerUnhealthy {
@@ -175,6 +204,7 @@ func (r *GameServerBuildReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 				return ctrl.Result{}, err
 			}
 			GameServersUnhealthyCounter.WithLabelValues(gsb.Name).Inc()
+			r.EventSink.Emit(LifecycleEventUnhealthy, &gs)
 			r.expectations.addGameServerToUnderDeletionMap(gsb.Name, gs.Name)
 			r.Recorder.Eventf(&gsb, corev1.EventTypeNormal, "Crashed", "GameServer %s was deleted because it crashed, state: %s, health: %s", gs.Name, gs.Status.State, gs.Status.Health)
 		}
@@ -182,20 +212,81 @@ func (r *GameServerBuildReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 
 	// calculate the total amount of servers not in the active state
 	nonActiveGameServersCount := standingByCount + initializingCount + pendingCount
+	// Reserved servers are not available for allocation and should not be deleted, so we count them along with the Active ones
+	allocatedGameServersCount := activeCount + reservedCount
+
+	// read the last standingBy and max decided by the external scaling endpoint, if it is configured
+	// a new request is sent in the background if its interval has passed
+	externalScaling, externalScalingRequeueAfter := r.externalScaling.decision(&gsb, &ExternalScalingRequest{
+		BuildName:           gsb.Name,
+		Namespace:           gsb.Namespace,
+		BuildID:             gsb.Spec.BuildID,
+		StandingBy:          gsb.Spec.StandingBy,
+		Max:                 gsb.Spec.Max,
+		CurrentPending:      pendingCount,
+		CurrentInitializing: initializingCount,
+		CurrentStandingBy:   standingByCount,
+		CurrentActive:       activeCount,
+		CurrentReserved:     reservedCount,
+		CrashesCount:        gsb.Status.CrashesCount,
+	}, time.Now())
+
+	// the number of standingBy and max servers we keep, which are calculated if Autoscaling or ExternalScaling is set or a schedule is active
+	scaling := getBuildScaling(&gsb, allocatedGameServersCount, externalScaling, time.Now())
+	if externalScalingRequeueAfter > 0 {
+		scaling.setRequeueAfter(externalScalingRequeueAfter)
+	}
+	standingBy, max := scaling.standingBy, scaling.max
+
+	// the crashes within the crash window, including the ones detected on this reconcile loop, and the backoff of the GameServer creations after the process crashes
+	crashes := getBuildCrashes(&gsb, crashesCount, processCrashesCount, r.Config, time.Now())
+	if crashes.backoffEndTime != nil {
+		log.Info("GameServerBuild is backing off GameServer creations after a crash", "backoff", crashes.backoff, "recentProcessCrashes", len(crashes.processCrashes))
+		scaling.setRequeueAfter(time.Until(crashes.backoffEndTime.Time))
+	}
+
+	// find the GameServers that were created from a previous Template
+	templateHash := getTemplateHash(&gsb.Spec.Template)
+	if isTemplateHashChangedWithoutSpecChange(&gsb, templateHash) {
+		if err := r.adoptGameServers(ctx, &gsb, &gameServers, templateHash); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	updatedCount, outdatedCount, outdatedStandingByCount := countGameServersByTemplate(&gameServers, templateHash)
+	// while the outdated non-Active GameServers are being replaced, we can have up to maxSurge of them above StandingBy
+	// and up to maxUnavailable StandingBy GameServers below StandingBy
+	maxSurge, maxUnavailable := 0, 0
+	if outdatedCount > 0 {
+		maxSurge, maxUnavailable = getRolloutLimits(&gsb, standingBy)
+	}
 
 	// Evaluate desired number of servers against actual
 	var totalNumberOfGameServersToDelete int = 0
 	// user has decreased standingBy numbers
-	if nonActiveGameServersCount > gsb.Spec.StandingBy {
-		totalNumberOfGameServersToDelete += int(math.Min(float64(nonActiveGameServersCount-gsb.Spec.StandingBy), float64(r.Config.MaxNumberOfGameServersToDelete)))
+	if nonActiveGameServersCount > standingBy+maxSurge {
+		totalNumberOfGameServersToDelete += int(math.Min(float64(nonActiveGameServersCount-standingBy-maxSurge), float64(r.Config.MaxNumberOfGameServersToDelete)))
 	}
 	// we also need to check if we are above the max
-	// this can happen if the user modifies the spec.Max during the GameServerBuild's lifetime
-	if nonActiveGameServersCount+activeCount > gsb.Spec.Max {
-		totalNumberOfGameServersToDelete += int(math.Min(float64(totalNumberOfGameServersToDelete+(nonActiveGameServersCount+activeCount-gsb.Spec.Max)), float64(r.Config.MaxNumberOfGameServersToDelete)))
+	// this can happen if the user modifies the spec.Max during the GameServerBuild's lifetime or a schedule lowers it
+	if nonActiveGameServersCount+allocatedGameServersCount > max {
+		totalNumberOfGameServersToDelete += int(math.Min(float64(totalNumberOfGameServersToDelete+(nonActiveGameServersCount+allocatedGameServersCount-max)), float64(r.Config.MaxNumberOfGameServersToDelete)))
+	}
+	// if we are not scaling down, we replace the outdated GameServers that are not StandingBy, since they are not available for allocation,
+	// and as many outdated StandingBy GameServers as maxUnavailable allows
+	if totalNumberOfGameServersToDelete == 0 && outdatedCount > 0 {
+		replaceableStandingByCount := int(math.Max(0, math.Min(float64(outdatedStandingByCount), float64(standingByCount-standingBy+maxUnavailable))))
+		totalNumberOfGameServersToDelete = int(math.Min(float64(outdatedCount-outdatedStandingByCount+replaceableStandingByCount), float64(r.Config.MaxNumberOfGameServersToDelete)))
+	}
+	switch mode {
+	case mpsv1alpha1.BuildModePaused:
+		// a Paused GameServerBuild keeps its existing GameServers
+		totalNumberOfGameServersToDelete = 0
+	case mpsv1alpha1.BuildModeDraining:
+		// a Draining GameServerBuild deletes all its non-Active GameServers, the Active ones are deleted when their sessions end
+		totalNumberOfGameServersToDelete = int(math.Min(float64(nonActiveGameServersCount), float64(r.Config.MaxNumberOfGameServersToDelete)))
 	}
 	if totalNumberOfGameServersToDelete > 0 {
-		err := r.deleteNonActiveGameServers(ctx, &gsb, &gameServers, totalNumberOfGameServersToDelete)
+		err := r.deleteNonActiveGameServers(ctx, &gsb, &gameServers, totalNumberOfGameServersToDelete, templateHash)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
@@ -204,12 +295,16 @@ func (r *GameServerBuildReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	// we are in need of standingBy servers, so we're creating them here
 	// we're also limiting the number of game servers that are created to avoid issues like this https://github.com/kubernetes-sigs/controller-runtime/issues/1782
 	// we attempt to create the missing number of game servers, but we don't want to create more than the max
+	// no game servers are created while backing off after a crash, so that a build whose game servers crash on start does not flood the API server
+	// Paused and Draining GameServerBuilds do not create game servers
 	// an error channel for the go routines to write errors
 	errCh := make(chan error, r.Config.MaxNumberOfGameServersToAdd)
 	// a waitgroup for async create calls
 	var wg sync.WaitGroup
-	for i := 0; i < gsb.Spec.StandingBy-nonActiveGameServersCount &&
-		i+nonActiveGameServersCount+activeCount < gsb.Spec.Max &&
+	for i := 0; mode == mpsv1alpha1.BuildModeRunning &&
+		crashes.backoffEndTime == nil &&
+		i < standingBy+maxSurge-nonActiveGameServersCount &&
+		i+nonActiveGameServersCount+allocatedGameServersCount < max &&
 		i < r.Config.MaxNumberOfGameServersToAdd; i++ {
 		wg.Add(1)
 		go func() {
@@ -233,37 +328,113 @@ func (r *GameServerBuildReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, <-errCh
 	}
 
-	return r.updateStatus(ctx, &gsb, pendingCount, initializingCount, standingByCount, activeCount, crashesCount)
+	// draining is complete when all the GameServers of the GameServerBuild have been deleted
+	drainingComplete := mode == mpsv1alpha1.BuildModeDraining && len(gameServers.Items) == 0
+
+	result, err := r.updateStatus(ctx, &gsb, pendingCount, initializingCount, standingByCount, activeCount, reservedCount, crashesCount, reusesCount, templateHash, updatedCount, outdatedCount, &scaling, &crashes, drainingComplete)
+	if err != nil {
+		return result, err
+	}
+	if !gsb.DeletionTimestamp.IsZero() {
+		if drainingComplete {
+			return ctrl.Result{}, r.removeFinalizer(ctx, &gsb)
+		}
+		log.Info("GameServerBuild is being deleted, waiting for its GameServers to be deleted", "active", activeCount, "reserved", reservedCount)
+	}
+	if scaling.requeueAfter > 0 {
+		result.RequeueAfter = scaling.requeueAfter
+	}
+	return result, nil
+}
+
+// removeFinalizer removes the finalizer of the GameServerBuild, so that its deletion can complete
+func (r *GameServerBuildReconciler) removeFinalizer(ctx context.Context, gsb *mpsv1alpha1.GameServerBuild) error {
+	if !controllerutil.ContainsFinalizer(gsb, mpsv1alpha1.GameServerBuildFinalizer) {
+		return nil
+	}
+	patch := client.MergeFrom(gsb.DeepCopy())
+	controllerutil.RemoveFinalizer(gsb, mpsv1alpha1.GameServerBuildFinalizer)
+	return client.IgnoreNotFound(r.Patch(ctx, gsb, patch))
 }
 
 // updateStatus patches the GameServerBuild's status only if the status of at least one of its GameServers has changed
-func (r *GameServerBuildReconciler) updateStatus(ctx context.Context, gsb *mpsv1alpha1.GameServerBuild, pendingCount, initializingCount, standingByCount, activeCount, crashesCount int) (ctrl.Result, error) {
+func (r *GameServerBuildReconciler) updateStatus(ctx context.Context, gsb *mpsv1alpha1.GameServerBuild, pendingCount, initializingCount, standingByCount, activeCount, reservedCount, crashesCount, reusesCount int,
+	templateHash string, updatedCount, outdatedCount int, scaling *buildScaling, crashes *buildCrashes, drainingComplete bool) (ctrl.Result, error) {
 	// patch GameServerBuild status only if one of the fields has changed
 	if gsb.Status.CurrentPending != pendingCount ||
 		gsb.Status.CurrentInitializing != initializingCount ||
 		gsb.Status.CurrentActive != activeCount ||
+		gsb.Status.CurrentReserved != reservedCount ||
+		gsb.Status.ReusesCount != reusesCount ||
 		gsb.Status.CurrentStandingBy != standingByCount ||
+		gsb.Status.TemplateHash != templateHash ||
+		gsb.Status.ObservedGeneration != gsb.Generation ||
+		gsb.Status.UpdatedGameServers != updatedCount ||
+		gsb.Status.OutdatedGameServers != outdatedCount ||
+		gsb.Status.EffectiveStandingBy != scaling.standingBy ||
+		!gsb.Status.LastScaleDownTime.Equal(scaling.lastScaleDownTime) ||
+		gsb.Status.ActiveSchedule != scaling.schedule ||
+		!gsb.Status.ActiveScheduleEndTime.Equal(scaling.scheduleEndTime) ||
+		!equality.Semantic.DeepEqual(gsb.Status.ExternalScaling, scaling.external) ||
+		len(gsb.Status.RecentCrashes) != len(crashes.recent) ||
+		len(gsb.Status.RecentProcessCrashes) != len(crashes.processCrashes) ||
+		gsb.Status.Health != crashes.health ||
+		gsb.Status.CrashBackoffSeconds != int(crashes.backoff.Seconds()) ||
+		!gsb.Status.CrashBackoffEndTime.Equal(crashes.backoffEndTime) ||
+		gsb.Status.DrainingComplete != drainingComplete ||
 		crashesCount > 0 {
 
+		if gsb.Status.TemplateHash != "" && gsb.Status.TemplateHash != templateHash && gsb.Status.ObservedGeneration != gsb.Generation {
+			r.Recorder.Eventf(gsb, corev1.EventTypeNormal, "RolloutStarted", "Template changed, replacing %d outdated non-Active GameServers", outdatedCount)
+		} else if gsb.Status.OutdatedGameServers > 0 && outdatedCount == 0 {
+			r.Recorder.Event(gsb, corev1.EventTypeNormal, "RolloutCompleted", "All non-Active GameServers were created from the current Template")
+		}
+		if gsb.Spec.Autoscaling != nil && gsb.Status.EffectiveStandingBy != scaling.standingBy {
+			r.Recorder.Eventf(gsb, corev1.EventTypeNormal, "Autoscaling", "Effective standingBy changed from %d to %d, with %d Active and %d Reserved", gsb.Status.EffectiveStandingBy, scaling.standingBy, activeCount, reservedCount)
+		}
+		if gsb.Status.ActiveSchedule != "" && gsb.Status.ActiveSchedule != scaling.schedule {
+			r.Recorder.Eventf(gsb, corev1.EventTypeNormal, "ScheduleEnded", "Window of schedule %s ended", gsb.Status.ActiveSchedule)
+		}
+		if scaling.schedule != "" && (gsb.Status.ActiveSchedule != scaling.schedule || !gsb.Status.ActiveScheduleEndTime.Equal(scaling.scheduleEndTime)) {
+			r.Recorder.Eventf(gsb, corev1.EventTypeNormal, "ScheduleStarted", "Window of schedule %s started, standingBy %d and max %d until %s", scaling.schedule, scaling.standingBy, scaling.max, scaling.scheduleEndTime.UTC().Format(time.RFC3339))
+		}
+		if gsb.Status.Health == mpsv1alpha1.BuildUnhealthy && crashes.health == mpsv1alpha1.BuildHealthy {
+			r.Recorder.Eventf(gsb, corev1.EventTypeNormal, "Healthy Build", "GameServerBuild is Healthy again, with %d crashes within the crash window", len(crashes.recent))
+		}
+		if crashes.backoffEndTime != nil && !gsb.Status.CrashBackoffEndTime.Equal(crashes.backoffEndTime) {
+			r.Recorder.Eventf(gsb, corev1.EventTypeWarning, "CrashBackoff", "Backing off GameServer creations for %s after %d recent process crashes", crashes.backoff, len(crashes.processCrashes))
+		}
+		if !gsb.Status.DrainingComplete && drainingComplete {
+			r.Recorder.Event(gsb, corev1.EventTypeNormal, "DrainingCompleted", "All the GameServers of the Draining GameServerBuild were deleted")
+		}
+
 		patch := client.MergeFrom(gsb.DeepCopy())
 
 		gsb.Status.CurrentPending = pendingCount
 		gsb.Status.CurrentInitializing = initializingCount
 		gsb.Status.CurrentActive = activeCount
+		gsb.Status.CurrentReserved = reservedCount
+		gsb.Status.ReusesCount = reusesCount
 		gsb.Status.CurrentStandingBy = standingByCount
-
-		existingCrashes := r.getExistingCrashes(gsb, crashesCount)
+		gsb.Status.TemplateHash = templateHash
+		gsb.Status.ObservedGeneration = gsb.Generation
+		gsb.Status.UpdatedGameServers = updatedCount
+		gsb.Status.OutdatedGameServers = outdatedCount
+		gsb.Status.EffectiveStandingBy = scaling.standingBy
+		gsb.Status.LastScaleDownTime = scaling.lastScaleDownTime
+		gsb.Status.ActiveSchedule = scaling.schedule
+		gsb.Status.ActiveScheduleEndTime = scaling.scheduleEndTime
+		gsb.Status.ExternalScaling = scaling.external
 
 		// update the crashesCount status with the new value of total crashes
-		gsb.Status.CrashesCount = existingCrashes + crashesCount
-		gsb.Status.CurrentStandingByReadyDesired = fmt.Sprintf("%d/%d", standingByCount, gsb.Spec.StandingBy)
-
-		// GameServerBuild can only be set as Unhealthy if CrashesToMarkUnhealthy has been explicitly been set by the user
-		if gsb.Spec.CrashesToMarkUnhealthy != nil && gsb.Status.CrashesCount >= *gsb.Spec.CrashesToMarkUnhealthy {
-			gsb.Status.Health = mpsv1alpha1.BuildUnhealthy
-		} else {
-			gsb.Status.Health = mpsv1alpha1.BuildHealthy
-		}
+		gsb.Status.CrashesCount += crashesCount
+		gsb.Status.RecentCrashes = crashes.recent
+		gsb.Status.RecentProcessCrashes = crashes.processCrashes
+		gsb.Status.CrashBackoffSeconds = int(crashes.backoff.Seconds())
+		gsb.Status.CrashBackoffEndTime = crashes.backoffEndTime
+		gsb.Status.CurrentStandingByReadyDesired = fmt.Sprintf("%d/%d", standingByCount, scaling.standingBy)
+		gsb.Status.Health = crashes.health
+		gsb.Status.DrainingComplete = drainingComplete
 
 		if err := r.Status().Patch(ctx, gsb, patch); err != nil {
 			return ctrl.Result{}, err
@@ -274,6 +445,8 @@ func (r *GameServerBuildReconciler) updateStatus(ctx context.Context, gsb *mpsv1
 	CurrentGameServerGauge.WithLabelValues(gsb.Name, InitializingServerStatus).Set(float64(initializingCount))
 	CurrentGameServerGauge.WithLabelValues(gsb.Name, StandingByServerStatus).Set(float64(standingByCount))
 	CurrentGameServerGauge.WithLabelValues(gsb.Name, ActiveServerStatus).Set(float64(activeCount))
+	CurrentGameServerGauge.WithLabelValues(gsb.Name, ReservedServerStatus).Set(float64(reservedCount))
+	CrashBackoffGauge.WithLabelValues(gsb.Name).Set(crashes.backoff.Seconds())
 
 	return ctrl.Result{}, nil
 }
@@ -298,27 +471,28 @@ func (r *GameServerBuildReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	if err := mgr.Add(r.externalScaling); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&mpsv1alpha1.GameServerBuild{}).
 		Owns(&mpsv1alpha1.GameServer{}).
+		// reconcile a GameServerBuild when a request to its external scaling endpoint completes
+		WatchesRawSource(source.Channel(r.externalScaling.events, &handler.EnqueueRequestForObject{})).
 		WithOptions(controller.Options{
 			MaxConcurrentReconciles: runtime.NumCPU(),
 		}).
 		Complete(r)
 }
 
-// getKeyForCrashesPerBuildMap returns the key for the map of crashes per build
-// key is namespace/name
-func getKeyForCrashesPerBuildMap(gsb *mpsv1alpha1.GameServerBuild) string {
-	return fmt.Sprintf("%s/%s", gsb.Namespace, gsb.Name)
-}
-
 // deleteNonActiveGameServers loops through all the GameServers CRs and deletes non-Active ones
-// after it sorts all of them by state
+// after it sorts all of them by state, the ones created from a previous Template are deleted first
 func (r *GameServerBuildReconciler) deleteNonActiveGameServers(ctx context.Context,
 	gsb *mpsv1alpha1.GameServerBuild,
 	gameServers *mpsv1alpha1.GameServerList,
-	totalNumberOfGameServersToDelete int) error {
+	totalNumberOfGameServersToDelete int,
+	templateHash string) error {
 	// an error channel for the go routines to write errors
 	errCh := make(chan error, totalNumberOfGameServersToDelete)
 	// a waitgroup for async deletion calls
@@ -327,10 +501,16 @@ func (r *GameServerBuildReconciler) deleteNonActiveGameServers(ctx context.Conte
 	// we sort the GameServers by state so that we can delete the ones that are empty state or Initializing before we delete the StandingBy ones (if needed)
 	// this is to make sure we don't fall below the desired number of StandingBy during scaling down
 	sort.Sort(ByState(gameServers.Items))
+	// the sort is stable, so the outdated GameServers stay sorted by state
+	sort.SliceStable(gameServers.Items, func(i, j int) bool {
+		return isOutdatedGameServer(&gameServers.Items[i], templateHash) && !isOutdatedGameServer(&gameServers.Items[j], templateHash)
+	})
 	for i := 0; i < len(gameServers.Items) && deletionCalls < totalNumberOfGameServersToDelete; i++ {
 		gs := gameServers.Items[i]
 		// we're deleting only initializing/pending/standingBy servers, never touching active
-		if gs.Status.State == "" || gs.Status.State == mpsv1alpha1.GameServerStateInitializing || gs.Status.State == mpsv1alpha1.GameServerStateStandingBy {
+		// Unhealthy servers have already been deleted by the reconcile loop
+		if gs.Status.Health != mpsv1alpha1.GameServerUnhealthy &&
+			(gs.Status.State == "" || gs.Status.State == mpsv1alpha1.GameServerStateInitializing || gs.Status.State == mpsv1alpha1.GameServerStateStandingBy) {
 			deletionCalls++
 			wg.Add(1)
 			go func() {
@@ -355,6 +535,68 @@ func (r *GameServerBuildReconciler) deleteNonActiveGameServers(ctx context.Conte
 	return nil
 }
 
+// countGameServersByTemplate returns the number of GameServers created from the Template with the provided hash,
+// the number of non-Active GameServers created from a previous Template and how many of them are StandingBy
+// GameServers that are about to be deleted because they exited or are Unhealthy are not counted
+func countGameServersByTemplate(gameServers *mpsv1alpha1.GameServerList, templateHash string) (int, int, int) {
+	var updatedCount, outdatedCount, outdatedStandingByCount int
+	for i := 0; i < len(gameServers.Items); i++ {
+		gs := &gameServers.Items[i]
+		if gs.Status.Health == mpsv1alpha1.GameServerUnhealthy ||
+			(gs.Status.State != "" && gs.Status.Health != mpsv1alpha1.GameServerHealthy) {
+			continue
+		}
+		switch gs.Status.State {
+		case "", mpsv1alpha1.GameServerStateInitializing, mpsv1alpha1.GameServerStateStandingBy:
+			if !isOutdatedGameServer(gs, templateHash) {
+				updatedCount++
+				continue
+			}
+			outdatedCount++
+			if gs.Status.State == mpsv1alpha1.GameServerStateStandingBy {
+				outdatedStandingByCount++
+			}
+		case mpsv1alpha1.GameServerStateActive, mpsv1alpha1.GameServerStateReserved:
+			if !isOutdatedGameServer(gs, templateHash) {
+				updatedCount++
+			}
+		}
+	}
+	return updatedCount, outdatedCount, outdatedStandingByCount
+}
+
+// isOutdatedGameServer returns true if the GameServer was not created from the Template with the provided hash
+// GameServers created before the hash was added as a label are not outdated, so that upgrading the controller does not replace them
+func isOutdatedGameServer(gs *mpsv1alpha1.GameServer, templateHash string) bool {
+	hash, exists := gs.Labels[LabelTemplateHash]
+	return exists && hash != templateHash
+}
+
+// isTemplateHashChangedWithoutSpecChange returns true if the hash of the Template differs from the one in the status
+// while the spec has not changed since the status was updated, e.g. because a newer version of the controller
+// computes the hash from fields that were added to the pod template
+func isTemplateHashChangedWithoutSpecChange(gsb *mpsv1alpha1.GameServerBuild, templateHash string) bool {
+	return gsb.Status.TemplateHash != "" && gsb.Status.TemplateHash != templateHash && gsb.Status.ObservedGeneration == gsb.Generation
+}
+
+// adoptGameServers sets the TemplateHash label of the GameServers created from the hash in the status to the provided hash
+// so that they are not replaced, since they were created from the same Template
+func (r *GameServerBuildReconciler) adoptGameServers(ctx context.Context, gsb *mpsv1alpha1.GameServerBuild, gameServers *mpsv1alpha1.GameServerList, templateHash string) error {
+	for i := range gameServers.Items {
+		gs := &gameServers.Items[i]
+		if gs.Labels[LabelTemplateHash] != gsb.Status.TemplateHash {
+			continue
+		}
+		patch := client.MergeFrom(gs.DeepCopy())
+		gs.Labels[LabelTemplateHash] = templateHash
+		if err := r.Patch(ctx, gs, patch); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	log.FromContext(ctx).Info("Template hash changed without a change of the spec, adopted the existing GameServers", "previousHash", gsb.Status.TemplateHash, "hash", templateHash)
+	return nil
+}
+
 // deleteGameServer deletes the provided GameServer
 func (r *GameServerBuildReconciler) deleteGameServer(ctx context.Context, gs *mpsv1alpha1.GameServer) error {
 	// we're requesting the GameServer to be deleted to have the same ResourceVersion
@@ -364,19 +606,3 @@ func (r *GameServerBuildReconciler) deleteGameServer(ctx context.Context, gs *mp
 			ResourceVersion: &gs.ResourceVersion,
 		}})
 }
-
-// getTotalCrashes returns the total number of crashes for this GameServerBuild
-func (r *GameServerBuildReconciler) getExistingCrashes(gsb *mpsv1alpha1.GameServerBuild, newCrashesCount int) int {
-	// try and get existing crashesCount from the map
-	// if it doesn't exist, create it with initial value the number of crashes we detected on this reconcile loop
-	key := getKeyForCrashesPerBuildMap(gsb)
-	val, ok := crashesPerBuild.LoadOrStore(key, newCrashesCount)
-	// if we have existing crashes, get the value
-	var existingCrashes int = 0
-	if ok {
-		existingCrashes = val.(int)
-		// and store the new one
-		crashesPerBuild.Store(key, newCrashesCount+existingCrashes)
-	}
-	return existingCrashes
-}
@@ -2,10 +2,14 @@ package controllers
 
 import (
 	"context"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var _ = Describe("GameServerBuild controller tests", func() {
@@ -167,6 +171,125 @@ var _ = Describe("GameServerBuild controller tests", func() {
 			verifyThatBuildIsUnhealthy(ctx, buildName)
 		})
 
+		It("should mark Build as healthy again when its crashes leave the crash window", func() {
+			buildName, buildID := getNewBuildNameAndID()
+			gsb := testGenerateGameServerBuild(buildName, testnamespace, buildID, 2, 4, false)
+			crashes := 2
+			gsb.Spec.CrashesToMarkUnhealthy = &crashes
+			gsb.Spec.CrashWindowSeconds = 2
+			Expect(testk8sClient.Create(ctx, &gsb)).Should(Succeed())
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 2)
+			testUpdateGameServersState(ctx, buildID, "", v1alpha1.GameServerStateStandingBy)
+			testVerifyGameServerStates(ctx, buildID, testStates{0, 0, 2, 0})
+
+			allocateGameServerManually(ctx, buildID)
+			allocateGameServerManually(ctx, buildID)
+			testTerminateActiveGameServer(ctx, buildID, false)
+			testTerminateActiveGameServer(ctx, buildID, false)
+			verifyThatBuildIsUnhealthy(ctx, buildName)
+
+			// the crashes are persisted in the status and the build recovers without any change once they leave the window
+			Eventually(func(g Gomega) {
+				var gameServerBuild v1alpha1.GameServerBuild
+				g.Expect(testk8sClient.Get(ctx, types.NamespacedName{Name: buildName, Namespace: testnamespace}, &gameServerBuild)).To(Succeed())
+				g.Expect(gameServerBuild.Status.Health).To(Equal(v1alpha1.BuildHealthy))
+				g.Expect(gameServerBuild.Status.CrashesCount).To(Equal(2))
+				g.Expect(gameServerBuild.Status.RecentCrashes).To(BeEmpty())
+			}, 5*time.Second, assertPollingInterval).Should(Succeed())
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 2)
+		})
+
+		It("should keep the game servers of a Paused GameServerBuild", func() {
+			buildName, buildID := getNewBuildNameAndID()
+			gsb := testGenerateGameServerBuild(buildName, testnamespace, buildID, 2, 4, false)
+			Expect(testk8sClient.Create(ctx, &gsb)).Should(Succeed())
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 2)
+			testUpdateGameServersState(ctx, buildID, "", v1alpha1.GameServerStateStandingBy)
+			testVerifyGameServerStates(ctx, buildID, testStates{0, 0, 2, 0})
+
+			// no game servers are created to replace the allocated one while Paused
+			testUpdateGameServerBuildMode(ctx, v1alpha1.BuildModePaused, buildName)
+			allocateGameServerManually(ctx, buildID)
+			Consistently(func() int {
+				var gameServers v1alpha1.GameServerList
+				Expect(testk8sClient.List(ctx, &gameServers, client.InNamespace(testnamespace), client.MatchingLabels{LabelBuildID: buildID})).To(Succeed())
+				return len(gameServers.Items)
+			}, time.Second, assertPollingInterval).Should(Equal(2))
+			testVerifyGameServerStates(ctx, buildID, testStates{0, 0, 1, 1})
+
+			testUpdateGameServerBuildMode(ctx, v1alpha1.BuildModeRunning, buildName)
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 3)
+		})
+
+		It("should delete the non-Active game servers of a Draining GameServerBuild", func() {
+			buildName, buildID := getNewBuildNameAndID()
+			gsb := testGenerateGameServerBuild(buildName, testnamespace, buildID, 2, 4, false)
+			Expect(testk8sClient.Create(ctx, &gsb)).Should(Succeed())
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 2)
+			testUpdateGameServersState(ctx, buildID, "", v1alpha1.GameServerStateStandingBy)
+			allocateGameServerManually(ctx, buildID)
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 3)
+
+			testUpdateGameServerBuildMode(ctx, v1alpha1.BuildModeDraining, buildName)
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 1)
+			testVerifyGameServerStates(ctx, buildID, testStates{0, 0, 0, 1})
+			Expect(getGameServerBuild(ctx, buildName).Status.DrainingComplete).To(BeFalse())
+
+			// draining is complete once the Active game server ends its session
+			testTerminateActiveGameServer(ctx, buildID, true)
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 0)
+			Eventually(func() bool {
+				return getGameServerBuild(ctx, buildName).Status.DrainingComplete
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("should wait for the Active game servers before deleting a GameServerBuild", func() {
+			buildName, buildID := getNewBuildNameAndID()
+			gsb := testGenerateGameServerBuild(buildName, testnamespace, buildID, 2, 4, false)
+			Expect(testk8sClient.Create(ctx, &gsb)).Should(Succeed())
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 2)
+			testUpdateGameServersState(ctx, buildID, "", v1alpha1.GameServerStateStandingBy)
+			allocateGameServerManually(ctx, buildID)
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 3)
+			Eventually(func() []string {
+				return getGameServerBuild(ctx, buildName).Finalizers
+			}, timeout, interval).Should(ContainElement(v1alpha1.GameServerBuildFinalizer))
+
+			gsb = getGameServerBuild(ctx, buildName)
+			Expect(testk8sClient.Delete(ctx, &gsb)).Should(Succeed())
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 1)
+			Expect(getGameServerBuild(ctx, buildName).DeletionTimestamp).ToNot(BeNil())
+
+			testTerminateActiveGameServer(ctx, buildID, true)
+			Eventually(func() bool {
+				var gameServerBuild v1alpha1.GameServerBuild
+				err := testk8sClient.Get(ctx, types.NamespacedName{Name: buildName, Namespace: testnamespace}, &gameServerBuild)
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("should not wait for the Active game servers when a GameServerBuild is force deleted", func() {
+			buildName, buildID := getNewBuildNameAndID()
+			gsb := testGenerateGameServerBuild(buildName, testnamespace, buildID, 2, 4, false)
+			gsb.Annotations = map[string]string{v1alpha1.GameServerBuildForceDeleteAnnotation: "true"}
+			Expect(testk8sClient.Create(ctx, &gsb)).Should(Succeed())
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 2)
+			testUpdateGameServersState(ctx, buildID, "", v1alpha1.GameServerStateStandingBy)
+			allocateGameServerManually(ctx, buildID)
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 3)
+			Eventually(func() []string {
+				return getGameServerBuild(ctx, buildName).Finalizers
+			}, timeout, interval).Should(ContainElement(v1alpha1.GameServerBuildFinalizer))
+
+			gsb = getGameServerBuild(ctx, buildName)
+			Expect(testk8sClient.Delete(ctx, &gsb)).Should(Succeed())
+			Eventually(func() bool {
+				var gameServerBuild v1alpha1.GameServerBuild
+				err := testk8sClient.Get(ctx, types.NamespacedName{Name: buildName, Namespace: testnamespace}, &gameServerBuild)
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+
 		It("should delete initializing servers before deleting standingBy, during downscaling", func() {
 			// create a new GameServerBuild with 4 standingBy and 16 max
 			buildName, buildID := getNewBuildNameAndID()
@@ -207,6 +330,50 @@ var _ = Describe("GameServerBuild controller tests", func() {
 			testVerifyGameServerStates(ctx, buildID, testStates{0, 0, 3, 0})
 		})
 
+		It("should replace the non-Active game servers when the template changes", func() {
+			// create a new GameServerBuild with 4 standingBy and 8 max
+			buildName, buildID := getNewBuildNameAndID()
+			gsb := testGenerateGameServerBuild(buildName, testnamespace, buildID, 4, 8, false)
+			Expect(testk8sClient.Create(ctx, &gsb)).Should(Succeed())
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 4)
+			testUpdateGameServersState(ctx, buildID, "", v1alpha1.GameServerStateStandingBy)
+			testVerifyGameServerStates(ctx, buildID, testStates{0, 0, 4, 0})
+
+			// allocate one game server, which should never be replaced
+			allocateGameServerManually(ctx, buildID)
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 5)
+			testUpdateGameServersState(ctx, buildID, "", v1alpha1.GameServerStateStandingBy)
+			testVerifyGameServerStates(ctx, buildID, testStates{0, 0, 4, 1})
+			activeGameServerName := testGetGameServerNamesByState(ctx, buildID, v1alpha1.GameServerStateActive)[0]
+
+			// change the image, with the default limits one game server is replaced at a time
+			Eventually(func() error {
+				gsb := getGameServerBuild(ctx, buildName)
+				gsb.Spec.Template.Spec.Containers[0].Image = "testimage:v2"
+				return testk8sClient.Update(ctx, &gsb)
+			}, timeout, interval).Should(Succeed())
+			gsb = getGameServerBuild(ctx, buildName)
+			newTemplateHash := getTemplateHash(&gsb.Spec.Template)
+			Eventually(func(g Gomega) {
+				// promote the new game servers, so the rollout can progress
+				testUpdateGameServersState(ctx, buildID, "", v1alpha1.GameServerStateStandingBy)
+				gsb := getGameServerBuild(ctx, buildName)
+				g.Expect(gsb.Status.TemplateHash).To(Equal(newTemplateHash))
+				g.Expect(gsb.Status.OutdatedGameServers).To(Equal(0))
+				g.Expect(gsb.Status.UpdatedGameServers).To(Equal(4))
+			}, timeout, interval).Should(Succeed())
+			testWaitAndVerifyTotalGameServerCount(ctx, buildID, 5)
+			testVerifyGameServerStates(ctx, buildID, testStates{0, 0, 4, 1})
+
+			// the Active game server was not touched and still has the previous template
+			gs := getGameServer(ctx, activeGameServerName)
+			Expect(gs.Status.State).To(Equal(v1alpha1.GameServerStateActive))
+			Expect(gs.Labels[LabelTemplateHash]).ToNot(Equal(newTemplateHash))
+			for _, name := range testGetGameServerNamesByState(ctx, buildID, v1alpha1.GameServerStateStandingBy) {
+				Expect(getGameServer(ctx, name).Labels[LabelTemplateHash]).To(Equal(newTemplateHash))
+			}
+		})
+
 		It("should overwrite containerPort with hostPort value when hostNetwork is required", func() {
 			// create a Build with 2 standingBy
 			buildName, buildID := getNewBuildNameAndID()
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+const (
+	// defaultCrashWindow is the sliding window of the crashes that count towards CrashesToMarkUnhealthy if CrashWindowSeconds is not set
+	defaultCrashWindow = time.Hour
+	// maxRecentCrashes is the maximum number of crash times kept in the status, unless CrashesToMarkUnhealthy is larger
+	maxRecentCrashes = 100
+)
+
+// buildCrashes contains the recent crashes of a GameServerBuild on a reconcile and their effect on it
+type buildCrashes struct {
+	// recent contains the times of the crashes within the crash window, oldest first
+	recent []metav1.Time
+	// health is Unhealthy if there are at least CrashesToMarkUnhealthy recent crashes
+	health mpsv1alpha1.GameServerBuildHealth
+	// processCrashes contains the times of the process crashes within the last CrashBackoffMaxSeconds, oldest first
+	processCrashes []metav1.Time
+	// backoff is the current backoff of the GameServer creations after the last crash, zero if GameServers can be created
+	backoff time.Duration
+	// backoffEndTime is the end of the current backoff, nil if GameServers can be created
+	backoffEndTime *metav1.Time
+}
+
+// getBuildCrashes returns the recent crashes of the GameServerBuild, including newCrashesCount crashes that happened now,
+// along with the health of the GameServerBuild and the backoff of its GameServer creations
+// newProcessCrashesCount is the number of the new crashes whose process crashed, only these count towards the backoff
+func getBuildCrashes(gsb *mpsv1alpha1.GameServerBuild, newCrashesCount, newProcessCrashesCount int, cfg *Config, now time.Time) buildCrashes {
+	recentCrashes := getRecentCrashes(gsb, newCrashesCount, now)
+	initial, max := time.Duration(cfg.CrashBackoffInitialSeconds)*time.Second, time.Duration(cfg.CrashBackoffMaxSeconds)*time.Second
+	processCrashes := getRecentProcessCrashes(gsb, newProcessCrashesCount, initial, max, now)
+	backoff, backoffEndTime := getCrashBackoff(processCrashes, initial, max, now)
+	return buildCrashes{
+		recent:         recentCrashes,
+		health:         getBuildHealth(gsb, recentCrashes),
+		processCrashes: processCrashes,
+		backoff:        backoff,
+		backoffEndTime: backoffEndTime,
+	}
+}
+
+// getCrashWindow returns the sliding window of the crashes of the GameServerBuild
+func getCrashWindow(gsb *mpsv1alpha1.GameServerBuild) time.Duration {
+	if gsb.Spec.CrashWindowSeconds > 0 {
+		return time.Duration(gsb.Spec.CrashWindowSeconds) * time.Second
+	}
+	return defaultCrashWindow
+}
+
+// getRecentCrashes returns the crash times of the status that are still within the window, along with newCrashesCount crashes that happened now
+// only the newest crashes are kept so that the status does not grow without limit
+func getRecentCrashes(gsb *mpsv1alpha1.GameServerBuild, newCrashesCount int, now time.Time) []metav1.Time {
+	windowStart := now.Add(-getCrashWindow(gsb))
+	var recentCrashes []metav1.Time
+	for _, t := range gsb.Status.RecentCrashes {
+		if t.Time.After(windowStart) {
+			recentCrashes = append(recentCrashes, t)
+		}
+	}
+	for i := 0; i < newCrashesCount; i++ {
+		// the status keeps the times with a precision of a second
+		recentCrashes = append(recentCrashes, metav1.NewTime(now).Rfc3339Copy())
+	}
+	limit := maxRecentCrashes
+	if gsb.Spec.CrashesToMarkUnhealthy != nil && *gsb.Spec.CrashesToMarkUnhealthy > limit {
+		limit = *gsb.Spec.CrashesToMarkUnhealthy
+	}
+	if len(recentCrashes) > limit {
+		recentCrashes = recentCrashes[len(recentCrashes)-limit:]
+	}
+	return recentCrashes
+}
+
+// getRecentProcessCrashes returns the process crash times of the status within the last max, along with newCrashesCount crashes that happened now
+// the times are only kept if the backoff is enabled
+func getRecentProcessCrashes(gsb *mpsv1alpha1.GameServerBuild, newCrashesCount int, initial, max time.Duration, now time.Time) []metav1.Time {
+	if initial <= 0 {
+		return nil
+	}
+	if max < initial {
+		max = initial
+	}
+	var processCrashes []metav1.Time
+	for _, t := range gsb.Status.RecentProcessCrashes {
+		if t.Time.After(now.Add(-max)) {
+			processCrashes = append(processCrashes, t)
+		}
+	}
+	for i := 0; i < newCrashesCount; i++ {
+		// the status keeps the times with a precision of a second
+		processCrashes = append(processCrashes, metav1.NewTime(now).Rfc3339Copy())
+	}
+	if len(processCrashes) > maxRecentCrashes {
+		processCrashes = processCrashes[len(processCrashes)-maxRecentCrashes:]
+	}
+	return processCrashes
+}
+
+// getBuildHealth returns the health of the GameServerBuild given its recent crashes
+// GameServerBuild can only be Unhealthy if CrashesToMarkUnhealthy has been explicitly been set by the user
+func getBuildHealth(gsb *mpsv1alpha1.GameServerBuild, recentCrashes []metav1.Time) mpsv1alpha1.GameServerBuildHealth {
+	if gsb.Spec.CrashesToMarkUnhealthy != nil && len(recentCrashes) >= *gsb.Spec.CrashesToMarkUnhealthy {
+		return mpsv1alpha1.BuildUnhealthy
+	}
+	return mpsv1alpha1.BuildHealthy
+}
+
+// getBuildRecovery returns true if the GameServerBuild is still Unhealthy, along with the time until enough crashes leave the window
+// for it to become Healthy again, which is zero if it can never recover (CrashesToMarkUnhealthy is zero)
+func getBuildRecovery(gsb *mpsv1alpha1.GameServerBuild, now time.Time) (bool, time.Duration) {
+	recentCrashes := getRecentCrashes(gsb, 0, now)
+	if getBuildHealth(gsb, recentCrashes) == mpsv1alpha1.BuildHealthy {
+		return false, 0
+	}
+	threshold := *gsb.Spec.CrashesToMarkUnhealthy
+	if threshold <= 0 {
+		return true, 0
+	}
+	// the build becomes Healthy when it has threshold-1 crashes in the window,
+	// which happens when the crash that is threshold places from the newest one leaves it
+	return true, recentCrashes[len(recentCrashes)-threshold].Add(getCrashWindow(gsb)).Sub(now)
+}
+
+// getCrashBackoff returns the backoff of the GameServer creations after the last of the recent process crashes, along with its end
+// the backoff starts at initial and doubles with each additional crash within the last max, so the GameServers of a build that keeps crashing
+// are created every max at most, it returns zero and nil if the backoff is disabled or has ended
+func getCrashBackoff(recentCrashes []metav1.Time, initial, max time.Duration, now time.Time) (time.Duration, *metav1.Time) {
+	if initial <= 0 || len(recentCrashes) == 0 {
+		return 0, nil
+	}
+	if max < initial {
+		max = initial
+	}
+	backoff := initial
+	for i := len(recentCrashes) - 2; i >= 0 && backoff < max && recentCrashes[i].Time.After(now.Add(-max)); i-- {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	end := recentCrashes[len(recentCrashes)-1].Add(backoff)
+	if !now.Before(end) {
+		return 0, nil
+	}
+	backoffEndTime := metav1.NewTime(end)
+	return backoff, &backoffEndTime
+}
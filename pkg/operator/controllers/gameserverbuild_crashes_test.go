@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/caarlos0/env/v6"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("GameServerBuild crashes tests", func() {
+	now := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	crashesAt := func(minutesAgo ...int) []metav1.Time {
+		var crashes []metav1.Time
+		for _, m := range minutesAgo {
+			crashes = append(crashes, metav1.NewTime(now.Add(-time.Duration(m)*time.Minute)))
+		}
+		return crashes
+	}
+
+	It("should keep only the crashes within the window", func() {
+		gsb := testGenerateGameServerBuild("test-build-crashes", "default", "build-id-crashes", 2, 10, false)
+		gsb.Status.RecentCrashes = crashesAt(90, 60, 30, 1)
+		recentCrashes := getRecentCrashes(&gsb, 2, now)
+		Expect(recentCrashes).To(Equal(append(crashesAt(30, 1), crashesAt(0, 0)...)))
+
+		gsb.Spec.CrashWindowSeconds = 600
+		recentCrashes = getRecentCrashes(&gsb, 0, now)
+		Expect(recentCrashes).To(Equal(crashesAt(1)))
+	})
+	It("should keep only the newest crashes", func() {
+		gsb := testGenerateGameServerBuild("test-build-crashes", "default", "build-id-crashes", 2, 10, false)
+		recentCrashes := getRecentCrashes(&gsb, maxRecentCrashes+5, now)
+		Expect(recentCrashes).To(HaveLen(maxRecentCrashes))
+
+		// the limit is raised to CrashesToMarkUnhealthy so the build can still become Unhealthy
+		crashesToMarkUnhealthy := maxRecentCrashes * 2
+		gsb.Spec.CrashesToMarkUnhealthy = &crashesToMarkUnhealthy
+		recentCrashes = getRecentCrashes(&gsb, crashesToMarkUnhealthy+5, now)
+		Expect(recentCrashes).To(HaveLen(crashesToMarkUnhealthy))
+		Expect(getBuildHealth(&gsb, recentCrashes)).To(Equal(mpsv1alpha1.BuildUnhealthy))
+	})
+	It("should be Unhealthy only when CrashesToMarkUnhealthy is set", func() {
+		gsb := testGenerateGameServerBuild("test-build-crashes", "default", "build-id-crashes", 2, 10, false)
+		Expect(getBuildHealth(&gsb, crashesAt(3, 2, 1))).To(Equal(mpsv1alpha1.BuildHealthy))
+		crashesToMarkUnhealthy := 3
+		gsb.Spec.CrashesToMarkUnhealthy = &crashesToMarkUnhealthy
+		Expect(getBuildHealth(&gsb, crashesAt(2, 1))).To(Equal(mpsv1alpha1.BuildHealthy))
+		Expect(getBuildHealth(&gsb, crashesAt(3, 2, 1))).To(Equal(mpsv1alpha1.BuildUnhealthy))
+	})
+	It("should recover once enough crashes leave the window", func() {
+		gsb := testGenerateGameServerBuild("test-build-crashes", "default", "build-id-crashes", 2, 10, false)
+		crashesToMarkUnhealthy := 3
+		gsb.Spec.CrashesToMarkUnhealthy = &crashesToMarkUnhealthy
+		gsb.Status.Health = mpsv1alpha1.BuildUnhealthy
+		gsb.Status.RecentCrashes = crashesAt(70, 50, 40, 20)
+		// the crash 50 minutes ago is the third newest one, two crashes remain after it leaves the window
+		unhealthy, recoverAfter := getBuildRecovery(&gsb, now)
+		Expect(unhealthy).To(BeTrue())
+		Expect(recoverAfter).To(Equal(10 * time.Minute))
+
+		unhealthy, recoverAfter = getBuildRecovery(&gsb, now.Add(recoverAfter))
+		Expect(unhealthy).To(BeFalse())
+		Expect(recoverAfter).To(BeZero())
+
+		// the build never recovers if CrashesToMarkUnhealthy is zero
+		zero := 0
+		gsb.Spec.CrashesToMarkUnhealthy = &zero
+		unhealthy, recoverAfter = getBuildRecovery(&gsb, now.Add(24*time.Hour))
+		Expect(unhealthy).To(BeTrue())
+		Expect(recoverAfter).To(BeZero())
+	})
+	It("should back off exponentially after recent crashes", func() {
+		initial, max := time.Second, 5*time.Minute
+		backoff, end := getCrashBackoff(nil, initial, max, now)
+		Expect(backoff).To(BeZero())
+		Expect(end).To(BeNil())
+
+		// the backoff doubles with each crash within the last max, starting from the newest crash
+		backoff, end = getCrashBackoff(crashesAt(10, 4, 3, 0, 0), initial, max, now)
+		Expect(backoff).To(Equal(8 * time.Second))
+		Expect(end.Time).To(Equal(now.Add(8 * time.Second)))
+		backoff, _ = getCrashBackoff(crashesAt(1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0), initial, max, now)
+		Expect(backoff).To(Equal(max))
+
+		// the backoff ends, so GameServers are created again
+		backoff, end = getCrashBackoff(crashesAt(10, 4, 3, 0, 0), initial, max, now.Add(8*time.Second))
+		Expect(backoff).To(BeZero())
+		Expect(end).To(BeNil())
+
+		// the backoff is disabled
+		backoff, end = getCrashBackoff(crashesAt(0), 0, max, now)
+		Expect(backoff).To(BeZero())
+		Expect(end).To(BeNil())
+	})
+	It("should keep only the process crashes within the last max", func() {
+		gsb := testGenerateGameServerBuild("test-build-crashes", "default", "build-id-crashes", 2, 10, false)
+		gsb.Status.RecentProcessCrashes = crashesAt(10, 4, 1)
+		processCrashes := getRecentProcessCrashes(&gsb, 1, time.Second, 5*time.Minute, now)
+		Expect(processCrashes).To(Equal(crashesAt(4, 1, 0)))
+
+		// the times are not kept if the backoff is disabled
+		Expect(getRecentProcessCrashes(&gsb, 1, 0, 5*time.Minute, now)).To(BeEmpty())
+	})
+	It("should report the backoff of the build", func() {
+		gsb := testGenerateGameServerBuild("test-build-crashes", "default", "build-id-crashes", 2, 10, false)
+		crashesToMarkUnhealthy := 5
+		gsb.Spec.CrashesToMarkUnhealthy = &crashesToMarkUnhealthy
+		gsb.Status.RecentCrashes = crashesAt(2)
+		gsb.Status.RecentProcessCrashes = crashesAt(2)
+		cfg := &Config{CrashBackoffInitialSeconds: 1, CrashBackoffMaxSeconds: 300}
+		crashes := getBuildCrashes(&gsb, 2, 2, cfg, now)
+		Expect(crashes.recent).To(HaveLen(3))
+		Expect(crashes.processCrashes).To(HaveLen(3))
+		Expect(crashes.health).To(Equal(mpsv1alpha1.BuildHealthy))
+		Expect(crashes.backoff).To(Equal(4 * time.Second))
+		Expect(crashes.backoffEndTime.Time).To(Equal(now.Add(4 * time.Second)))
+
+		gsb.Status.RecentCrashes = crashes.recent
+		gsb.Status.RecentProcessCrashes = crashes.processCrashes
+		crashes = getBuildCrashes(&gsb, 2, 2, cfg, now.Add(30*time.Second))
+		Expect(crashes.recent).To(HaveLen(5))
+		Expect(crashes.health).To(Equal(mpsv1alpha1.BuildUnhealthy))
+		Expect(crashes.backoff).To(Equal(16 * time.Second))
+	})
+	It("should back off only after process crashes", func() {
+		gsb := testGenerateGameServerBuild("test-build-crashes", "default", "build-id-crashes", 2, 10, false)
+		cfg := &Config{CrashBackoffInitialSeconds: 1, CrashBackoffMaxSeconds: 300}
+		// GameServers that were marked as Unhealthy count as crashes but do not back off the creations
+		crashes := getBuildCrashes(&gsb, 3, 0, cfg, now)
+		Expect(crashes.recent).To(HaveLen(3))
+		Expect(crashes.processCrashes).To(BeEmpty())
+		Expect(crashes.backoff).To(BeZero())
+		Expect(crashes.backoffEndTime).To(BeNil())
+
+		gsb.Status.RecentCrashes = crashes.recent
+		crashes = getBuildCrashes(&gsb, 1, 1, cfg, now)
+		Expect(crashes.recent).To(HaveLen(4))
+		Expect(crashes.backoff).To(Equal(time.Second))
+	})
+	It("should not back off by default", func() {
+		gsb := testGenerateGameServerBuild("test-build-crashes", "default", "build-id-crashes", 2, 10, false)
+		cfg := &Config{}
+		Expect(env.Parse(cfg)).To(Succeed())
+		Expect(cfg.CrashBackoffInitialSeconds).To(BeZero())
+		crashes := getBuildCrashes(&gsb, 3, 3, cfg, now)
+		Expect(crashes.recent).To(HaveLen(3))
+		Expect(crashes.processCrashes).To(BeEmpty())
+		Expect(crashes.backoff).To(BeZero())
+		Expect(crashes.backoffEndTime).To(BeNil())
+	})
+})
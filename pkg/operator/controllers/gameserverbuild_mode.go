@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+// getBuildMode returns the mode of the GameServerBuild, a GameServerBuild that is being deleted is Draining
+func getBuildMode(gsb *mpsv1alpha1.GameServerBuild) mpsv1alpha1.GameServerBuildMode {
+	if !gsb.DeletionTimestamp.IsZero() {
+		return mpsv1alpha1.BuildModeDraining
+	}
+	if gsb.Spec.Mode == "" {
+		return mpsv1alpha1.BuildModeRunning
+	}
+	return gsb.Spec.Mode
+}
+
+// isForceDeleted returns true if the GameServerBuild is being deleted without waiting for its Active GameServers
+func isForceDeleted(gsb *mpsv1alpha1.GameServerBuild) bool {
+	return !gsb.DeletionTimestamp.IsZero() && gsb.Annotations[mpsv1alpha1.GameServerBuildForceDeleteAnnotation] == "true"
+}
+
+// skipDrainingBuilds returns the BuildIDs of the builds that are not Draining, keeping their order
+// it returns an error with status code 429 if all of them are Draining, so that a federated allocation can be forwarded to another region
+func (s *AllocationApiServer) skipDrainingBuilds(ctx context.Context, buildIDs []string, requestedID string) ([]string, error) {
+	allowed := make([]string, 0, len(buildIDs))
+	for _, buildID := range buildIDs {
+		var gameServerBuilds mpsv1alpha1.GameServerBuildList
+		if err := s.Client.List(ctx, &gameServerBuilds, client.MatchingFields{specBuildId: buildID}); err != nil {
+			return nil, newAllocationError(http.StatusInternalServerError, err, "error listing")
+		}
+		if len(gameServerBuilds.Items) == 0 || getBuildMode(&gameServerBuilds.Items[0]) == mpsv1alpha1.BuildModeDraining {
+			continue
+		}
+		allowed = append(allowed, buildID)
+	}
+	if len(allowed) == 0 {
+		for _, buildID := range buildIDs {
+			Allocations429ErrorsCounter.WithLabelValues(buildID).Inc()
+		}
+		return nil, newAllocationError(http.StatusTooManyRequests, errors.New("GameServerBuild is draining"), fmt.Sprintf("GameServerBuild or BuildAlias with ID %s is draining", requestedID))
+	}
+	return allowed, nil
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("GameServerBuild mode tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		sessionID2 string = "7b8e4f2a-3c1d-4e5f-9a6b-0c1d2e3f4a5b"
+	)
+
+	allocate := func(h *AllocationApiServer, sessionID string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"buildID\":\"%s\",\"sessionID\":\"%s\"}", buildID1, sessionID)))
+		w := httptest.NewRecorder()
+		h.handleAllocationRequest(w, req)
+		return w.Result().StatusCode
+	}
+
+	It("should return the mode of the build", func() {
+		gsb := testGenerateGameServerBuild("test-build-mode", "default", "build-id-mode", 2, 4, false)
+		Expect(getBuildMode(&gsb)).To(Equal(mpsv1alpha1.BuildModeRunning))
+		gsb.Spec.Mode = mpsv1alpha1.BuildModePaused
+		Expect(getBuildMode(&gsb)).To(Equal(mpsv1alpha1.BuildModePaused))
+		Expect(isForceDeleted(&gsb)).To(BeFalse())
+
+		// a build that is being deleted is Draining
+		now := metav1.Now()
+		gsb.DeletionTimestamp = &now
+		Expect(getBuildMode(&gsb)).To(Equal(mpsv1alpha1.BuildModeDraining))
+		Expect(isForceDeleted(&gsb)).To(BeFalse())
+		gsb.Annotations = map[string]string{mpsv1alpha1.GameServerBuildForceDeleteAnnotation: "true"}
+		Expect(isForceDeleted(&gsb)).To(BeTrue())
+	})
+	It("should not allocate from a Draining build", func() {
+		cl := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(cl, "gs-1", buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		standingBy, err := testCreateGameServer(cl, "gs-2", buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		var gsb mpsv1alpha1.GameServerBuild
+		Expect(cl.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: buildName1}, &gsb)).To(Succeed())
+		gsb.Spec.Mode = mpsv1alpha1.BuildModeDraining
+		Expect(cl.Update(context.Background(), &gsb)).To(Succeed())
+
+		h := NewAllocationApiServer(nil, cl, allocationApiSvcPort)
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            standingBy.Name,
+			Namespace:       standingBy.Namespace,
+			BuildID:         buildID1,
+			ResourceVersion: standingBy.ResourceVersion,
+		})
+		// the existing session is still returned
+		Expect(allocate(h, sessionID1)).To(Equal(http.StatusOK))
+		Expect(allocate(h, sessionID2)).To(Equal(http.StatusTooManyRequests))
+
+		// the StandingBy game server was left in the queue, so a Paused build can still allocate it
+		gsb.Spec.Mode = mpsv1alpha1.BuildModePaused
+		Expect(cl.Update(context.Background(), &gsb)).To(Succeed())
+		Expect(allocate(h, sessionID2)).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+// getActiveSchedule returns the first schedule whose window contains now, along with the end of that window
+// it also returns the time until the next window of any schedule starts or ends, which is zero if there is none
+// invalid schedules are rejected by the webhook, we ignore them in case it is not installed
+func getActiveSchedule(schedules []mpsv1alpha1.ScalingSchedule, now time.Time) (*mpsv1alpha1.ScalingSchedule, time.Time, time.Duration) {
+	var active *mpsv1alpha1.ScalingSchedule
+	var activeEnd, nextBoundary time.Time
+	updateNextBoundary := func(t time.Time) {
+		if !t.IsZero() && (nextBoundary.IsZero() || t.Before(nextBoundary)) {
+			nextBoundary = t
+		}
+	}
+	for i := range schedules {
+		schedule, location, ok := parseScalingSchedule(&schedules[i])
+		if !ok {
+			continue
+		}
+		duration := time.Duration(schedules[i].DurationSeconds) * time.Second
+		// a window that contains now must have started after now-duration
+		// Next returns the zero time if the cron expression never matches
+		if start := schedule.Next(now.Add(-duration).In(location)); !start.IsZero() && !start.After(now) {
+			end := start.Add(duration)
+			if active == nil {
+				active = &schedules[i]
+				activeEnd = end
+			}
+			updateNextBoundary(end)
+		}
+		updateNextBoundary(schedule.Next(now.In(location)))
+	}
+	if nextBoundary.IsZero() {
+		return active, activeEnd, 0
+	}
+	return active, activeEnd, nextBoundary.Sub(now)
+}
+
+// parseScalingSchedule returns the parsed cron expression and the time zone of the schedule
+// returns false if the schedule is invalid or if it is an @every descriptor, whose windows have no fixed start time
+func parseScalingSchedule(s *mpsv1alpha1.ScalingSchedule) (cron.Schedule, *time.Location, bool) {
+	if s.DurationSeconds <= 0 {
+		return nil, nil, false
+	}
+	schedule, err := cron.ParseStandard(s.Schedule)
+	if err != nil {
+		return nil, nil, false
+	}
+	if _, ok := schedule.(*cron.SpecSchedule); !ok {
+		return nil, nil, false
+	}
+	location, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return nil, nil, false
+	}
+	return schedule, location, true
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("GameServerBuild schedules tests", func() {
+	// a Friday
+	now := time.Date(2022, 6, 3, 19, 30, 0, 0, time.UTC)
+	intPtr := func(i int) *int { return &i }
+
+	It("should find the active schedule and the next boundary", func() {
+		schedules := []mpsv1alpha1.ScalingSchedule{
+			// every day from 18:00 to 22:00 UTC
+			{Name: "evenings", Schedule: "0 18 * * *", DurationSeconds: 4 * 3600},
+			// every Friday from 19:00 to 21:00 in Athens, which is 16:00 to 18:00 UTC in the summer
+			{Name: "fridays", Schedule: "0 19 * * 5", TimeZone: "Europe/Athens", DurationSeconds: 2 * 3600},
+		}
+		active, end, next := getActiveSchedule(schedules, now)
+		Expect(active).ToNot(BeNil())
+		Expect(active.Name).To(Equal("evenings"))
+		Expect(end).To(BeTemporally("==", time.Date(2022, 6, 3, 22, 0, 0, 0, time.UTC)))
+		Expect(next).To(Equal(150 * time.Minute))
+
+		active, _, next = getActiveSchedule(schedules, now.Add(-2*time.Hour))
+		Expect(active).ToNot(BeNil())
+		Expect(active.Name).To(Equal("fridays"))
+		// the fridays window ends when the evenings window starts
+		Expect(next).To(Equal(30 * time.Minute))
+
+		active, _, next = getActiveSchedule(schedules, now.Add(3*time.Hour))
+		Expect(active).To(BeNil())
+		Expect(next).To(Equal(time.Duration(19.5 * float64(time.Hour))))
+	})
+	It("should ignore invalid schedules", func() {
+		schedules := []mpsv1alpha1.ScalingSchedule{
+			{Name: "invalid", Schedule: "0 25 * * *", DurationSeconds: 3600},
+			{Name: "every", Schedule: "@every 1h", DurationSeconds: 3600},
+			{Name: "timezone", Schedule: "0 18 * * *", TimeZone: "Mars/Olympus", DurationSeconds: 3600},
+			{Name: "duration", Schedule: "0 18 * * *"},
+		}
+		active, _, next := getActiveSchedule(schedules, now)
+		Expect(active).To(BeNil())
+		Expect(next).To(BeZero())
+	})
+	It("should override standingBy and max during the window", func() {
+		gsb := testGenerateGameServerBuild("test-build-schedules", "default", "build-id-schedules", 2, 10, false)
+		gsb.Spec.Schedules = []mpsv1alpha1.ScalingSchedule{
+			{Name: "evenings", Schedule: "0 18 * * *", DurationSeconds: 4 * 3600, StandingBy: intPtr(20), Max: intPtr(40)},
+			{Name: "nights", Schedule: "0 0 * * *", DurationSeconds: 6 * 3600, Max: intPtr(1)},
+		}
+		scaling := getBuildScaling(&gsb, 0, nil, now)
+		Expect(scaling.standingBy).To(Equal(20))
+		Expect(scaling.max).To(Equal(40))
+		Expect(scaling.schedule).To(Equal("evenings"))
+		Expect(scaling.scheduleEndTime.Time).To(BeTemporally("==", time.Date(2022, 6, 3, 22, 0, 0, 0, time.UTC)))
+		Expect(scaling.requeueAfter).To(Equal(150 * time.Minute))
+
+		// standingBy is never more than max
+		scaling = getBuildScaling(&gsb, 0, nil, now.Add(6*time.Hour))
+		Expect(scaling.standingBy).To(Equal(1))
+		Expect(scaling.max).To(Equal(1))
+		Expect(scaling.schedule).To(Equal("nights"))
+
+		scaling = getBuildScaling(&gsb, 0, nil, now.Add(-6*time.Hour))
+		Expect(scaling.standingBy).To(Equal(2))
+		Expect(scaling.max).To(Equal(10))
+		Expect(scaling.schedule).To(BeEmpty())
+		Expect(scaling.scheduleEndTime).To(BeNil())
+		Expect(scaling.requeueAfter).To(Equal(4*time.Hour + 30*time.Minute))
+	})
+	It("should raise the autoscaling buffer during the window", func() {
+		gsb := testGenerateGameServerBuild("test-build-schedules", "default", "build-id-schedules", 2, 50, false)
+		gsb.Spec.Autoscaling = &mpsv1alpha1.GameServerBuildAutoscaling{
+			Buffer:                  &mpsv1alpha1.BufferPolicy{Size: intstr.FromString("50%")},
+			ScaleDownCoolOffSeconds: 3600,
+		}
+		gsb.Spec.Schedules = []mpsv1alpha1.ScalingSchedule{
+			{Name: "evenings", Schedule: "0 18 * * *", DurationSeconds: 4 * 3600, StandingBy: intPtr(10)},
+		}
+		scaling := getBuildScaling(&gsb, 30, nil, now)
+		Expect(scaling.standingBy).To(Equal(15))
+		scaling = getBuildScaling(&gsb, 4, nil, now)
+		Expect(scaling.standingBy).To(Equal(10))
+
+		// after the window, the scale down respects the cool-off, and the requeue is the sooner of the cool-off and the next window
+		gsb.Status.EffectiveStandingBy = 10
+		gsb.Status.LastScaleDownTime = nil
+		scaling = getBuildScaling(&gsb, 4, nil, now.Add(3*time.Hour))
+		Expect(scaling.standingBy).To(Equal(2))
+		gsb.Status.LastScaleDownTime = scaling.lastScaleDownTime
+		gsb.Status.EffectiveStandingBy = 2
+		scaling = getBuildScaling(&gsb, 30, nil, now.Add(3*time.Hour+10*time.Minute))
+		Expect(scaling.standingBy).To(Equal(15))
+		scaling = getBuildScaling(&gsb, 0, nil, now.Add(3*time.Hour+10*time.Minute))
+		Expect(scaling.standingBy).To(Equal(2))
+		Expect(scaling.requeueAfter).To(Equal(50 * time.Minute))
+	})
+})
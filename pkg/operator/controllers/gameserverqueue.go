@@ -2,6 +2,8 @@ package controllers
 
 import (
 	"container/heap"
+	"container/list"
+	"context"
 	"sync"
 )
 
@@ -16,6 +18,24 @@ type GameServersQueue struct {
 	// this is used when we are deleting a GameServer from the queue
 	// since we need to know in which GameServerBuild it belongs to
 	namespacedNameToBuildId map[string]string
+	// waitersPerBuild is a map of FIFO lists of allocation requests that are waiting for a GameServer, one for each GameServerBuild
+	// key to the map is the BuildID, each list element is a *queueWaiter
+	waitersPerBuild map[string]*list.List
+	// handedOut is a map of the namespaced name of a GameServer that was popped off the queue or handed to a waiter to its ResourceVersion
+	// it is used to ignore the GameServer if it is pushed again, with the same ResourceVersion, by a reconcile that happened before it was allocated
+	handedOut map[string]string
+	// nodeUtilization keeps track of the Active GameServers per Node and zone, it is used by the allocation strategies
+	nodeUtilization *NodeUtilization
+	// isStale returns true if a GameServer has stopped heartbeating and should not be allocated, stale GameServers are not skipped if nil
+	isStale func(*GameServerForQueue) bool
+}
+
+// queueWaiter is an allocation request that is waiting for a GameServer of any of its GameServerBuilds
+type queueWaiter struct {
+	// ch is buffered, so PushToQueue does not block while holding the mutex
+	ch chan *GameServerForQueue
+	// elements contains the element of the waiter in the list of waiters of each of its GameServerBuilds, by BuildID
+	elements map[string]*list.Element
 }
 
 // NewGameServersQueue returns a new GameServersQueue
@@ -24,21 +44,54 @@ func NewGameServersQueue() *GameServersQueue {
 		mutex:                   &sync.RWMutex{},
 		queuesPerBuilds:         make(map[string]*GameServerQueueForBuild),
 		namespacedNameToBuildId: make(map[string]string),
+		waitersPerBuild:         make(map[string]*list.List),
+		handedOut:               make(map[string]string),
+		nodeUtilization:         NewNodeUtilization(),
 	}
 }
 
 // PushToQueue pushes a GameServerForQueue onto the queue
+// if there are allocation requests waiting for a GameServer of this GameServerBuild,
+// the GameServer is handed to the one that has been waiting the longest instead
 func (gsq *GameServersQueue) PushToQueue(gs *GameServerForQueue) {
 	gsq.mutex.Lock()
 	defer gsq.mutex.Unlock()
+	gsq.pushToQueue(gs)
+}
+
+// pushToQueue implements PushToQueue
+// caller should hold the mutex
+func (gsq *GameServersQueue) pushToQueue(gs *GameServerForQueue) {
+	namespacedName := getNamespacedName(gs.Namespace, gs.Name)
+	if resourceVersion, exists := gsq.handedOut[namespacedName]; exists {
+		if resourceVersion == gs.ResourceVersion {
+			return
+		}
+		delete(gsq.handedOut, namespacedName)
+	}
+
+	// a stale GameServer goes to the queue, so that it can be allocated if it starts heartbeating again
+	if waiters, exists := gsq.waitersPerBuild[gs.BuildID]; exists && (gsq.isStale == nil || !gsq.isStale(gs)) {
+		w := waiters.Front().Value.(*queueWaiter)
+		gsq.removeWaiter(w)
+		gsq.handedOut[namespacedName] = gs.ResourceVersion
+		// channel is buffered, so this will never block
+		w.ch <- gs
+		return
+	}
 
 	// check if we have created a queue for this GameServerBuild
 	if _, exists := gsq.queuesPerBuilds[gs.BuildID]; !exists {
 		gsq.queuesPerBuilds[gs.BuildID] = NewGameServersPerBuildQueue()
+		gsq.queuesPerBuilds[gs.BuildID].nodeUtilization = gsq.nodeUtilization
+	}
+	// the strategy of the GameServerBuild might have been changed, so we make sure the queue uses the latest one
+	if gs.AllocationStrategy != nil {
+		gsq.queuesPerBuilds[gs.BuildID].setStrategy(gs.AllocationStrategy)
 	}
 
 	// store the BuildID for this GameServer
-	gsq.namespacedNameToBuildId[getNamespacedName(gs.Namespace, gs.Name)] = gs.BuildID
+	gsq.namespacedNameToBuildId[namespacedName] = gs.BuildID
 	gsq.queuesPerBuilds[gs.BuildID].PushToQueue(gs)
 }
 
@@ -49,7 +102,110 @@ func (gsq *GameServersQueue) PopFromQueue(buildID string) *GameServerForQueue {
 	if _, exists := gsq.queuesPerBuilds[buildID]; !exists {
 		return nil
 	}
-	gsfh := gsq.queuesPerBuilds[buildID].PopFromQueue()
+	return gsq.popFromQueue(buildID)
+}
+
+// PopFromQueueWithWait pops the top GameServerForQueue off the queues of the provided GameServerBuilds, trying them in order
+// if all queues are empty, it waits for a GameServer of any of the GameServerBuilds to be pushed until the context is done
+// waiting requests are served in FIFO order. Returns nil if no GameServer became available in time
+func (gsq *GameServersQueue) PopFromQueueWithWait(ctx context.Context, buildIDs []string) *GameServerForQueue {
+	gsq.mutex.Lock()
+	for _, buildID := range buildIDs {
+		// requests that are already waiting should be served first, so we only pop if there are none
+		if _, exists := gsq.waitersPerBuild[buildID]; exists {
+			continue
+		}
+		if _, exists := gsq.queuesPerBuilds[buildID]; exists {
+			if gsfh := gsq.popFromQueue(buildID); gsfh != nil {
+				gsq.mutex.Unlock()
+				return gsfh
+			}
+			// all GameServers on the queue are stale, so we wait for a new one
+		}
+	}
+	w := &queueWaiter{
+		ch:       make(chan *GameServerForQueue, 1),
+		elements: make(map[string]*list.Element, len(buildIDs)),
+	}
+	for _, buildID := range buildIDs {
+		if _, exists := gsq.waitersPerBuild[buildID]; !exists {
+			gsq.waitersPerBuild[buildID] = list.New()
+		}
+		w.elements[buildID] = gsq.waitersPerBuild[buildID].PushBack(w)
+	}
+	gsq.mutex.Unlock()
+
+	select {
+	case gs := <-w.ch:
+		return gs
+	case <-ctx.Done():
+		gsq.mutex.Lock()
+		defer gsq.mutex.Unlock()
+		select {
+		case gs := <-w.ch:
+			// a GameServer was handed to us right before the context was done
+			return gs
+		default:
+		}
+		gsq.removeWaiter(w)
+		return nil
+	}
+}
+
+// UnparkFresh hands the parked GameServers that are not stale anymore to the allocation requests that are waiting for them
+// parked GameServers are otherwise only checked when the queue is popped, so it should be called when new heartbeats are observed
+func (gsq *GameServersQueue) UnparkFresh() {
+	gsq.mutex.Lock()
+	defer gsq.mutex.Unlock()
+	if gsq.isStale == nil {
+		return
+	}
+	for buildID, queue := range gsq.queuesPerBuilds {
+		// without waiting requests, the GameServers are unparked when the queue is popped
+		if _, exists := gsq.waitersPerBuild[buildID]; !exists {
+			continue
+		}
+		for _, gs := range queue.takeFresh(gsq.isStale) {
+			gsq.pushToQueue(gs)
+		}
+		if len(queue.gameServerNameSet) == 0 {
+			delete(gsq.queuesPerBuilds, buildID)
+		}
+	}
+}
+
+// removeWaiter removes the provided waiter from the lists of waiters of all its GameServerBuilds
+// caller should hold the mutex
+func (gsq *GameServersQueue) removeWaiter(w *queueWaiter) {
+	for buildID, e := range w.elements {
+		waiters := gsq.waitersPerBuild[buildID]
+		waiters.Remove(e)
+		if waiters.Len() == 0 {
+			delete(gsq.waitersPerBuild, buildID)
+		}
+	}
+}
+
+// popFromQueue pops the top GameServerForQueue off the queue for the provided buildID, skipping stale GameServers
+// stale GameServers are parked next to the queue, so that they can be allocated if they start heartbeating again
+// returns nil if all GameServers on the queue are stale
+// caller should hold the mutex and make sure the queue for this buildID exists
+func (gsq *GameServersQueue) popFromQueue(buildID string) *GameServerForQueue {
+	queue := gsq.queuesPerBuilds[buildID]
+	var gsfh *GameServerForQueue
+	if gsq.isStale != nil {
+		queue.unparkFresh(gsq.isStale)
+	}
+	for {
+		gsfh = queue.PopFromQueue()
+		if gsfh == nil || gsq.isStale == nil || !gsq.isStale(gsfh) {
+			break
+		}
+		queue.parkStale(gsfh)
+	}
+	if gsfh != nil {
+		gsq.handedOut[getNamespacedName(gsfh.Namespace, gsfh.Name)] = gsfh.ResourceVersion
+	}
 	// we ran out of GameServers for this GameServerBuild
 	if len(gsq.queuesPerBuilds[buildID].gameServerNameSet) == 0 {
 		delete(gsq.queuesPerBuilds, buildID)
@@ -61,6 +217,7 @@ func (gsq *GameServersQueue) PopFromQueue(buildID string) *GameServerForQueue {
 func (gsq *GameServersQueue) RemoveFromQueue(namespace, name string) {
 	gsq.mutex.Lock()
 	defer gsq.mutex.Unlock()
+	delete(gsq.handedOut, getNamespacedName(namespace, name))
 	// get the buildID for this GameServer
 	buildID := gsq.namespacedNameToBuildId[getNamespacedName(namespace, name)]
 	if _, exists := gsq.queuesPerBuilds[buildID]; !exists {
@@ -75,15 +232,60 @@ func (gsq *GameServersQueue) RemoveFromQueue(namespace, name string) {
 	}
 }
 
+// ForgetHandedOut allows the GameServer with the provided namespace/name to be pushed again with the same ResourceVersion
+// it should be called if the GameServer was popped off the queue but it could not be allocated
+func (gsq *GameServersQueue) ForgetHandedOut(namespace, name string) {
+	gsq.mutex.Lock()
+	defer gsq.mutex.Unlock()
+	delete(gsq.handedOut, getNamespacedName(namespace, name))
+}
+
+// SetLivenessCheck sets the function that is used to skip GameServers that have stopped heartbeating
+// it should be called before the queue is used
+func (gsq *GameServersQueue) SetLivenessCheck(isStale func(*GameServerForQueue) bool) {
+	gsq.mutex.Lock()
+	defer gsq.mutex.Unlock()
+	gsq.isStale = isStale
+}
+
+// SetAllocationStrategy sets the AllocationStrategy of the queue of the provided GameServerBuild, if it exists
+func (gsq *GameServersQueue) SetAllocationStrategy(buildID string, strategy AllocationStrategy) {
+	gsq.mutex.Lock()
+	defer gsq.mutex.Unlock()
+	if queue, exists := gsq.queuesPerBuilds[buildID]; exists {
+		queue.setStrategy(strategy)
+	}
+}
+
+// UpdateNodeUtilization records whether the GameServer with the provided namespace/name is Active on the provided Node and zone
+func (gsq *GameServersQueue) UpdateNodeUtilization(namespace, name, nodeName, zone string, active bool) {
+	gsq.mutex.Lock()
+	defer gsq.mutex.Unlock()
+	if active {
+		gsq.nodeUtilization.setActive(getNamespacedName(namespace, name), nodeName, zone)
+	} else {
+		gsq.nodeUtilization.remove(getNamespacedName(namespace, name))
+	}
+}
+
 // GameServerQueueForBuild encapsulates a queue of GameServerForQueue for a specific GameServerBuild
 // also contains a map of all the GameServers for that GameServerBuild
 type GameServerQueueForBuild struct {
 	mutex *sync.RWMutex
 	// queue is the actual priority queue that stores the GameServers
 	queue *GameServerQueue
-	// gameServerNameSet is a map of all the GameServers for that GameServerBuild
+	// gameServerNameSet is a map of all the GameServers for that GameServerBuild, including the stale ones
 	// this is used to facilitate O(1) lookup of a GameServer
 	gameServerNameSet map[string]interface{}
+	// stale contains the GameServers that were skipped because their heartbeat is stale
+	// they are kept out of the queue, so that they are not popped on every allocation, until they start heartbeating again
+	stale []*GameServerForQueue
+	// strategy is the AllocationStrategy used to sort the queue, if nil GameServers are sorted by NodeAge
+	strategy AllocationStrategy
+	// nodeUtilization is shared among all queues, it is protected by the GameServersQueue mutex
+	nodeUtilization *NodeUtilization
+	// nodeUtilizationVersion is the version of nodeUtilization the queue was last sorted with
+	nodeUtilizationVersion uint64
 }
 
 // NewGameServersPerBuildQueue returns a new priority queue for a single GameServerBuild
@@ -104,7 +306,7 @@ func (gsqb *GameServerQueueForBuild) PushToQueue(gs *GameServerForQueue) {
 		gsqb.mutex.Lock()
 		defer gsqb.mutex.Unlock()
 		gsqb.gameServerNameSet[gs.Name] = struct{}{}
-		gsqb.queue.PushToQueue(gs)
+		heap.Push(gsqb.heap(), gs)
 	}
 }
 
@@ -115,7 +317,12 @@ func (gsqb *GameServerQueueForBuild) PopFromQueue() *GameServerForQueue {
 	if len(*gsqb.queue) == 0 {
 		return nil
 	}
-	gsfh := heap.Pop(gsqb.queue).(*GameServerForQueue)
+	// if the order depends on the Node utilization, we need to sort again when it has changed
+	if gsqb.strategy != nil && gsqb.strategy.usesNodeUtilization() && gsqb.nodeUtilization != nil && gsqb.nodeUtilizationVersion != gsqb.nodeUtilization.version {
+		heap.Init(gsqb.heap())
+		gsqb.nodeUtilizationVersion = gsqb.nodeUtilization.version
+	}
+	gsfh := heap.Pop(gsqb.heap()).(*GameServerForQueue)
 	delete(gsqb.gameServerNameSet, gsfh.Name)
 	return gsfh
 }
@@ -132,11 +339,101 @@ func (gsqb *GameServerQueueForBuild) RemoveFromQueue(namespace, name string) {
 	defer gsqb.mutex.Unlock()
 	for i, gs2 := range *gsqb.queue {
 		if name == gs2.Name && namespace == gs2.Namespace {
-			heap.Remove(gsqb.queue, i)
+			heap.Remove(gsqb.heap(), i)
 			delete(gsqb.gameServerNameSet, name)
 			return
 		}
 	}
+	for i, gs2 := range gsqb.stale {
+		if name == gs2.Name && namespace == gs2.Namespace {
+			gsqb.stale = append(gsqb.stale[:i], gsqb.stale[i+1:]...)
+			delete(gsqb.gameServerNameSet, name)
+			return
+		}
+	}
+}
+
+// parkStale keeps a GameServer that was popped off the queue because it is stale, until it starts heartbeating again
+func (gsqb *GameServerQueueForBuild) parkStale(gs *GameServerForQueue) {
+	gsqb.mutex.Lock()
+	defer gsqb.mutex.Unlock()
+	gsqb.gameServerNameSet[gs.Name] = struct{}{}
+	gsqb.stale = append(gsqb.stale, gs)
+}
+
+// unparkFresh pushes the parked GameServers that are not stale anymore back onto the queue
+func (gsqb *GameServerQueueForBuild) unparkFresh(isStale func(*GameServerForQueue) bool) {
+	gsqb.mutex.Lock()
+	defer gsqb.mutex.Unlock()
+	if len(gsqb.stale) == 0 {
+		return
+	}
+	stale := make([]*GameServerForQueue, 0, len(gsqb.stale))
+	for _, gs := range gsqb.stale {
+		if isStale(gs) {
+			stale = append(stale, gs)
+			continue
+		}
+		heap.Push(gsqb.heap(), gs)
+	}
+	gsqb.stale = stale
+}
+
+// takeFresh removes the parked GameServers that are not stale anymore from the queue and returns them
+func (gsqb *GameServerQueueForBuild) takeFresh(isStale func(*GameServerForQueue) bool) []*GameServerForQueue {
+	gsqb.mutex.Lock()
+	defer gsqb.mutex.Unlock()
+	var fresh []*GameServerForQueue
+	stale := make([]*GameServerForQueue, 0, len(gsqb.stale))
+	for _, gs := range gsqb.stale {
+		if isStale(gs) {
+			stale = append(stale, gs)
+			continue
+		}
+		delete(gsqb.gameServerNameSet, gs.Name)
+		fresh = append(fresh, gs)
+	}
+	gsqb.stale = stale
+	return fresh
+}
+
+// setStrategy sets the AllocationStrategy of the queue, sorting it again if it has changed
+func (gsqb *GameServerQueueForBuild) setStrategy(strategy AllocationStrategy) {
+	gsqb.mutex.Lock()
+	defer gsqb.mutex.Unlock()
+	if gsqb.strategy == strategy {
+		return
+	}
+	gsqb.strategy = strategy
+	heap.Init(gsqb.heap())
+	if gsqb.nodeUtilization != nil {
+		gsqb.nodeUtilizationVersion = gsqb.nodeUtilization.version
+	}
+}
+
+// heap returns the heap.Interface that sorts the queue using the AllocationStrategy of the queue
+// caller should hold the mutex
+func (gsqb *GameServerQueueForBuild) heap() heap.Interface {
+	if gsqb.strategy == nil {
+		return gsqb.queue
+	}
+	return &gameServerQueueWithStrategy{
+		GameServerQueue: gsqb.queue,
+		strategy:        gsqb.strategy,
+		nodeUtilization: gsqb.nodeUtilization,
+	}
+}
+
+// gameServerQueueWithStrategy wraps a GameServerQueue so that it is sorted using an AllocationStrategy
+type gameServerQueueWithStrategy struct {
+	*GameServerQueue
+	strategy        AllocationStrategy
+	nodeUtilization *NodeUtilization
+}
+
+// Less returns true if the GameServerForQueue with index i should be allocated before the one with index j
+func (h *gameServerQueueWithStrategy) Less(i, j int) bool {
+	return h.strategy.Less((*h.GameServerQueue)[i], (*h.GameServerQueue)[j], h.nodeUtilization)
 }
 
 // GameServerForQueue is a helper struct that encapsulates all the details we need from a GameServer object
@@ -146,7 +443,11 @@ type GameServerForQueue struct {
 	Namespace       string
 	BuildID         string
 	NodeAge         int
+	NodeName        string
+	Zone            string
 	ResourceVersion string
+	// AllocationStrategy is the strategy of the GameServerBuild this GameServer belongs to
+	AllocationStrategy AllocationStrategy
 }
 
 // GameServerQueue implements a PriorityQueue for GameServer objects
@@ -162,7 +463,7 @@ func (h GameServerQueue) Len() int {
 
 // Less returns true if the GameServerForHeap with index i is in a newer Node (smaller NodeAge) compared to the GameServerForHeap with index j
 func (h GameServerQueue) Less(i, j int) bool {
-	return h[i].NodeAge < h[j].NodeAge
+	return nodeAgeStrategy{}.Less(h[i], h[j], nil)
 }
 
 // Swap swaps the GameServerForHeap with index i and the GameServerForHeap with index j
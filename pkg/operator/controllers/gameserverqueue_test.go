@@ -2,11 +2,18 @@ package controllers
 
 import (
 	"container/heap"
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
 var _ = Describe("gameserverqueue tests", func() {
@@ -135,6 +142,344 @@ var _ = Describe("gameserverqueue tests", func() {
 		_, exists := c.queuesPerBuilds[testBuildID]
 		Expect(exists).To(Equal(false))
 	})
+	It("should return a game server without waiting if the queue is not empty", func() {
+		const testBuildID = "test-build-id"
+		c := NewGameServersQueue()
+		c.PushToQueue(testCreateGameServerForQueue("gs-1", "ns", testBuildID, 0))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gs := c.PopFromQueueWithWait(ctx, []string{testBuildID})
+		Expect(gs).ToNot(BeNil())
+		Expect(gs.Name).To(Equal("gs-1"))
+		Expect(ctx.Err()).ToNot(HaveOccurred())
+		_, exists := c.queuesPerBuilds[testBuildID]
+		Expect(exists).To(BeFalse())
+	})
+	It("should return nil after waiting if no game server is pushed", func() {
+		const testBuildID = "test-build-id"
+		c := NewGameServersQueue()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		gs := c.PopFromQueueWithWait(ctx, []string{testBuildID})
+		Expect(gs).To(BeNil())
+		_, exists := c.waitersPerBuild[testBuildID]
+		Expect(exists).To(BeFalse())
+		// a game server pushed after the waiter has left should go to the queue
+		c.PushToQueue(testCreateGameServerForQueue("gs-1", "ns", testBuildID, 0))
+		Expect(len(*c.queuesPerBuilds[testBuildID].queue)).To(Equal(1))
+	})
+	It("should serve waiting requests in FIFO order", func() {
+		const testBuildID = "test-build-id"
+		const totalWaiters = 3
+		c := NewGameServersQueue()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		results := make([]chan *GameServerForQueue, totalWaiters)
+		for i := 0; i < totalWaiters; i++ {
+			results[i] = make(chan *GameServerForQueue, 1)
+			go func(i int) {
+				results[i] <- c.PopFromQueueWithWait(ctx, []string{testBuildID})
+			}(i)
+			// wait for the request to be registered as a waiter, so the order is deterministic
+			Eventually(func() int {
+				c.mutex.RLock()
+				defer c.mutex.RUnlock()
+				if _, exists := c.waitersPerBuild[testBuildID]; !exists {
+					return 0
+				}
+				return c.waitersPerBuild[testBuildID].Len()
+			}).Should(Equal(i + 1))
+		}
+		for i := 0; i < totalWaiters; i++ {
+			c.PushToQueue(testCreateGameServerForQueue(fmt.Sprintf("gs-%d", i), "ns", testBuildID, 0))
+		}
+		for i := 0; i < totalWaiters; i++ {
+			var gs *GameServerForQueue
+			Eventually(results[i]).Should(Receive(&gs))
+			Expect(gs.Name).To(Equal(fmt.Sprintf("gs-%d", i)))
+		}
+		_, exists := c.waitersPerBuild[testBuildID]
+		Expect(exists).To(BeFalse())
+		_, exists = c.queuesPerBuilds[testBuildID]
+		Expect(exists).To(BeFalse())
+	})
+	It("should wait for a game server of any of the provided builds", func() {
+		const testBuildID1 = "test-build-id-1"
+		const testBuildID2 = "test-build-id-2"
+		c := NewGameServersQueue()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		result := make(chan *GameServerForQueue, 1)
+		go func() {
+			result <- c.PopFromQueueWithWait(ctx, []string{testBuildID1, testBuildID2})
+		}()
+		Eventually(func() int {
+			c.mutex.RLock()
+			defer c.mutex.RUnlock()
+			return len(c.waitersPerBuild)
+		}).Should(Equal(2))
+		c.PushToQueue(testCreateGameServerForQueue("gs-1", "ns", testBuildID2, 0))
+		var gs *GameServerForQueue
+		Eventually(result).Should(Receive(&gs))
+		Expect(gs.Name).To(Equal("gs-1"))
+		// the waiter is removed from the waiters of both builds
+		Expect(c.waitersPerBuild).To(BeEmpty())
+		c.PushToQueue(testCreateGameServerForQueue("gs-2", "ns", testBuildID1, 0))
+		Expect(c.PopFromQueue(testBuildID1).Name).To(Equal("gs-2"))
+	})
+	It("should not hand out a game server again until its ResourceVersion changes", func() {
+		const testBuildID = "test-build-id"
+		c := NewGameServersQueue()
+		gs := testCreateGameServerForQueue("gs-1", "ns", testBuildID, 0)
+		gs.ResourceVersion = "1"
+		c.PushToQueue(gs)
+		Expect(c.PopFromQueue(testBuildID)).ToNot(BeNil())
+		// a reconcile that happened before the allocation pushes the same version again
+		c.PushToQueue(gs)
+		Expect(c.PopFromQueue(testBuildID)).To(BeNil())
+
+		// the same applies to a game server handed to a waiter
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		result := make(chan *GameServerForQueue, 1)
+		go func() {
+			result <- c.PopFromQueueWithWait(ctx, []string{testBuildID})
+		}()
+		Eventually(func() bool {
+			c.mutex.RLock()
+			defer c.mutex.RUnlock()
+			_, exists := c.waitersPerBuild[testBuildID]
+			return exists
+		}).Should(BeTrue())
+		gs2 := testCreateGameServerForQueue("gs-2", "ns", testBuildID, 0)
+		gs2.ResourceVersion = "1"
+		c.PushToQueue(gs2)
+		Eventually(result).Should(Receive(Equal(gs2)))
+		c.PushToQueue(gs2)
+		Expect(c.PopFromQueue(testBuildID)).To(BeNil())
+
+		// a game server that could not be allocated, or whose version changed, can be pushed again
+		c.ForgetHandedOut("ns", "gs-2")
+		c.PushToQueue(gs2)
+		gs.ResourceVersion = "2"
+		c.PushToQueue(gs)
+		Expect(c.PopFromQueue(testBuildID)).ToNot(BeNil())
+		Expect(c.PopFromQueue(testBuildID)).ToNot(BeNil())
+	})
+	It("should skip stale game servers and keep them on the queue", func() {
+		const testBuildID = "test-build-id"
+		c := NewGameServersQueue()
+		stale := map[string]bool{"gs-0": true, "gs-1": true}
+		c.SetLivenessCheck(func(gs *GameServerForQueue) bool {
+			return stale[gs.Name]
+		})
+		for i := 0; i < 3; i++ {
+			c.PushToQueue(testCreateGameServerForQueue(fmt.Sprintf("gs-%d", i), "ns", testBuildID, i))
+		}
+		gs := c.PopFromQueue(testBuildID)
+		Expect(gs.Name).To(Equal("gs-2"))
+		// the stale game servers are parked, so they are not popped again on every allocation
+		Expect(len(*c.queuesPerBuilds[testBuildID].queue)).To(Equal(0))
+		Expect(c.queuesPerBuilds[testBuildID].stale).To(HaveLen(2))
+		// all remaining game servers are stale
+		Expect(c.PopFromQueue(testBuildID)).To(BeNil())
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		Expect(c.PopFromQueueWithWait(ctx, []string{testBuildID})).To(BeNil())
+		// a game server that starts heartbeating again can be allocated
+		delete(stale, "gs-1")
+		gs = c.PopFromQueue(testBuildID)
+		Expect(gs.Name).To(Equal("gs-1"))
+		// a parked game server can be removed
+		c.RemoveFromQueue("ns", "gs-0")
+		_, exists := c.queuesPerBuilds[testBuildID]
+		Expect(exists).To(BeFalse())
+	})
+	It("should not hand a stale game server to a waiting request", func() {
+		const testBuildID = "test-build-id"
+		c := NewGameServersQueue()
+		c.SetLivenessCheck(func(gs *GameServerForQueue) bool {
+			return gs.Name == "gs-stale"
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		result := make(chan *GameServerForQueue, 1)
+		go func() {
+			result <- c.PopFromQueueWithWait(ctx, []string{testBuildID})
+		}()
+		Eventually(func() bool {
+			c.mutex.RLock()
+			defer c.mutex.RUnlock()
+			_, exists := c.waitersPerBuild[testBuildID]
+			return exists
+		}).Should(BeTrue())
+		c.PushToQueue(testCreateGameServerForQueue("gs-stale", "ns", testBuildID, 0))
+		Consistently(result, 50*time.Millisecond).ShouldNot(Receive())
+		c.PushToQueue(testCreateGameServerForQueue("gs-fresh", "ns", testBuildID, 1))
+		var gs *GameServerForQueue
+		Eventually(result).Should(Receive(&gs))
+		Expect(gs.Name).To(Equal("gs-fresh"))
+	})
+	It("should hand a parked game server to a waiting request when it starts heartbeating again", func() {
+		const testBuildID = "test-build-id"
+		c := NewGameServersQueue()
+		var mu sync.Mutex
+		stale := true
+		c.SetLivenessCheck(func(gs *GameServerForQueue) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return stale
+		})
+		c.PushToQueue(testCreateGameServerForQueue("gs-0", "ns", testBuildID, 0))
+		Expect(c.PopFromQueue(testBuildID)).To(BeNil())
+		Expect(c.queuesPerBuilds[testBuildID].stale).To(HaveLen(1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		result := make(chan *GameServerForQueue, 1)
+		go func() {
+			result <- c.PopFromQueueWithWait(ctx, []string{testBuildID})
+		}()
+		Eventually(func() bool {
+			c.mutex.RLock()
+			defer c.mutex.RUnlock()
+			_, exists := c.waitersPerBuild[testBuildID]
+			return exists
+		}).Should(BeTrue())
+		// the game server is still stale
+		c.UnparkFresh()
+		Consistently(result, 50*time.Millisecond).ShouldNot(Receive())
+
+		mu.Lock()
+		stale = false
+		mu.Unlock()
+		c.UnparkFresh()
+		var gs *GameServerForQueue
+		Eventually(result).Should(Receive(&gs))
+		Expect(gs.Name).To(Equal("gs-0"))
+		_, exists := c.queuesPerBuilds[testBuildID]
+		Expect(exists).To(BeFalse())
+	})
+})
+
+var _ = Describe("allocation strategies tests", func() {
+	const testBuildID = "test-build-id"
+	It("should return the NodeAge strategy by default", func() {
+		Expect(NewAllocationStrategy(&mpsv1alpha1.GameServerBuildSpec{})).To(Equal(nodeAgeStrategy{}))
+		Expect(NewAllocationStrategy(&mpsv1alpha1.GameServerBuildSpec{AllocationStrategy: mpsv1alpha1.AllocationStrategyPacked})).To(Equal(packedStrategy{}))
+		Expect(NewAllocationStrategy(&mpsv1alpha1.GameServerBuildSpec{AllocationStrategy: mpsv1alpha1.AllocationStrategyWeighted})).To(Equal(weightedStrategy{nodeAgeWeight: 1, nodeUtilizationWeight: 1, zoneWeight: 1}))
+	})
+	It("should prefer the busiest Node with the Packed strategy", func() {
+		c := NewGameServersQueue()
+		c.UpdateNodeUtilization("ns", "active-1", "node-a", "", true)
+		c.UpdateNodeUtilization("ns", "active-2", "node-a", "", true)
+		c.UpdateNodeUtilization("ns", "active-3", "node-b", "", true)
+		c.PushToQueue(testCreateGameServerForQueueOnNode("gs-c", testBuildID, "node-c", "", 0, packedStrategy{}))
+		c.PushToQueue(testCreateGameServerForQueueOnNode("gs-b", testBuildID, "node-b", "", 1, packedStrategy{}))
+		c.PushToQueue(testCreateGameServerForQueueOnNode("gs-a", testBuildID, "node-a", "", 2, packedStrategy{}))
+		Expect(c.PopFromQueue(testBuildID).Name).To(Equal("gs-a"))
+		// node-b becomes the busiest one
+		c.UpdateNodeUtilization("ns", "active-1", "", "", false)
+		c.UpdateNodeUtilization("ns", "active-2", "", "", false)
+		c.UpdateNodeUtilization("ns", "active-4", "node-b", "", true)
+		Expect(c.PopFromQueue(testBuildID).Name).To(Equal("gs-b"))
+		Expect(c.PopFromQueue(testBuildID).Name).To(Equal("gs-c"))
+	})
+	It("should spread allocations across zones and Nodes with the Distributed strategy", func() {
+		c := NewGameServersQueue()
+		for i := 0; i < 2; i++ {
+			for _, node := range []string{"node-a", "node-b", "node-c"} {
+				zone := "zone-1"
+				if node == "node-c" {
+					zone = "zone-2"
+				}
+				gs := testCreateGameServerForQueueOnNode(fmt.Sprintf("gs-%s-%d", node, i), testBuildID, node, zone, 0, distributedStrategy{})
+				c.PushToQueue(gs)
+			}
+		}
+		c.UpdateNodeUtilization("ns", "active-1", "node-a", "zone-1", true)
+		var nodes []string
+		for i := 0; i < 4; i++ {
+			gs := c.PopFromQueue(testBuildID)
+			Expect(gs).ToNot(BeNil())
+			c.UpdateNodeUtilization(gs.Namespace, gs.Name, gs.NodeName, gs.Zone, true)
+			nodes = append(nodes, gs.NodeName)
+		}
+		// zone-2 has no Active servers, then zone-1 and zone-2 are tied but node-b is less busy than node-a
+		Expect(nodes).To(Equal([]string{"node-c", "node-b", "node-c", "node-a"}))
+	})
+	It("should use the configured weights with the Weighted strategy", func() {
+		c := NewGameServersQueue()
+		c.UpdateNodeUtilization("ns", "active-1", "node-a", "zone-1", true)
+		c.UpdateNodeUtilization("ns", "active-2", "node-a", "zone-1", true)
+		strategy := NewAllocationStrategy(&mpsv1alpha1.GameServerBuildSpec{
+			AllocationStrategy: mpsv1alpha1.AllocationStrategyWeighted,
+			WeightedAllocation: &mpsv1alpha1.WeightedAllocation{NodeAgeWeight: 1, ZoneWeight: 10},
+		})
+		// node-a is newer but its zone is busy
+		c.PushToQueue(testCreateGameServerForQueueOnNode("gs-a", testBuildID, "node-a", "zone-1", 1, strategy))
+		c.PushToQueue(testCreateGameServerForQueueOnNode("gs-b", testBuildID, "node-b", "zone-2", 5, strategy))
+		Expect(c.PopFromQueue(testBuildID).Name).To(Equal("gs-b"))
+	})
+	It("should sort the queue again when the strategy changes", func() {
+		c := NewGameServersQueue()
+		c.UpdateNodeUtilization("ns", "active-1", "node-b", "", true)
+		c.PushToQueue(testCreateGameServerForQueueOnNode("gs-a", testBuildID, "node-a", "", 0, nodeAgeStrategy{}))
+		c.PushToQueue(testCreateGameServerForQueueOnNode("gs-b", testBuildID, "node-b", "", 1, nodeAgeStrategy{}))
+		Expect((*c.queuesPerBuilds[testBuildID].queue)[0].Name).To(Equal("gs-a"))
+		c.PushToQueue(testCreateGameServerForQueueOnNode("gs-c", testBuildID, "node-c", "", 2, packedStrategy{}))
+		Expect(c.PopFromQueue(testBuildID).Name).To(Equal("gs-b"))
+	})
+	It("should sort the queue again only for the strategies that use the Node utilization", func() {
+		Expect(nodeAgeStrategy{}.usesNodeUtilization()).To(BeFalse())
+		Expect(packedStrategy{}.usesNodeUtilization()).To(BeTrue())
+		Expect(distributedStrategy{}.usesNodeUtilization()).To(BeTrue())
+		Expect(weightedStrategy{nodeAgeWeight: 1}.usesNodeUtilization()).To(BeFalse())
+		Expect(weightedStrategy{nodeAgeWeight: 1, zoneWeight: 1}.usesNodeUtilization()).To(BeTrue())
+
+		c := NewGameServersQueue()
+		c.PushToQueue(testCreateGameServerForQueueOnNode("gs-a", testBuildID, "node-a", "", 0, nodeAgeStrategy{}))
+		c.PushToQueue(testCreateGameServerForQueueOnNode("gs-b", testBuildID, "node-b", "", 1, nodeAgeStrategy{}))
+		c.UpdateNodeUtilization("ns", "active-1", "node-b", "", true)
+		Expect(c.PopFromQueue(testBuildID).Name).To(Equal("gs-a"))
+		Expect(c.queuesPerBuilds[testBuildID].nodeUtilizationVersion).To(BeZero())
+	})
+	It("should cache the strategy of a GameServerBuild until it is updated", func() {
+		ctx := context.Background()
+		cl := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(cl, "gs-1", "build-1", testBuildID, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, cl, allocationApiSvcPort)
+		Expect(h.getAllocationStrategy(ctx, gs)).To(Equal(nodeAgeStrategy{}))
+		h.gameServerQueue.PushToQueue(testCreateGameServerForQueueOnNode(gs.Name, testBuildID, "node-a", "", 0, nodeAgeStrategy{}))
+
+		var gsb mpsv1alpha1.GameServerBuild
+		Expect(cl.Get(ctx, client.ObjectKey{Namespace: gs.Namespace, Name: "build-1"}, &gsb)).To(Succeed())
+		gsb.Spec.AllocationStrategy = mpsv1alpha1.AllocationStrategyPacked
+		Expect(cl.Update(ctx, &gsb)).To(Succeed())
+		// the GameServerBuild is not fetched again
+		Expect(h.getAllocationStrategy(ctx, gs)).To(Equal(nodeAgeStrategy{}))
+
+		h.gameServerBuildCacheHandler().Update(ctx, event.UpdateEvent{ObjectNew: &gsb}, nil)
+		Expect(h.getAllocationStrategy(ctx, gs)).To(Equal(packedStrategy{}))
+		Expect(h.gameServerQueue.queuesPerBuilds[testBuildID].strategy).To(Equal(packedStrategy{}))
+	})
+	It("should cache the zone of a Node until it is updated", func() {
+		ctx := context.Background()
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{corev1.LabelTopologyZone: "zone-1"}}}
+		cl := testNewSimpleK8sClient()
+		Expect(cl.Create(ctx, node)).To(Succeed())
+		h := NewAllocationApiServer(nil, cl, allocationApiSvcPort)
+		Expect(h.getNodeZone(ctx, "node-a")).To(Equal("zone-1"))
+		Expect(cl.Delete(ctx, node)).To(Succeed())
+		Expect(h.getNodeZone(ctx, "node-a")).To(Equal("zone-1"))
+
+		node.Labels[corev1.LabelTopologyZone] = "zone-2"
+		h.nodeCacheHandler().Update(ctx, event.UpdateEvent{ObjectNew: node}, nil)
+		Expect(h.getNodeZone(ctx, "node-a")).To(Equal("zone-2"))
+		h.nodeCacheHandler().Delete(ctx, event.DeleteEvent{Object: node}, nil)
+		Expect(h.getNodeZone(ctx, "node-a")).To(BeEmpty())
+	})
 })
 
 func testCreateGameServerForQueue(name, namespace, buildID string, nodeAge int) *GameServerForQueue {
@@ -146,6 +491,18 @@ func testCreateGameServerForQueue(name, namespace, buildID string, nodeAge int)
 	}
 }
 
+func testCreateGameServerForQueueOnNode(name, buildID, nodeName, zone string, nodeAge int, strategy AllocationStrategy) *GameServerForQueue {
+	return &GameServerForQueue{
+		Name:               name,
+		Namespace:          "ns",
+		BuildID:            buildID,
+		NodeAge:            nodeAge,
+		NodeName:           nodeName,
+		Zone:               zone,
+		AllocationStrategy: strategy,
+	}
+}
+
 func testDeleteGameServerWithName(name string, h *GameServerQueue) {
 	for i, gs := range *h {
 		if gs.Name == name {
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+// HeartbeatLivenessChecker checks if the last heartbeat of a GameServer, as published by the NodeAgent on its Node, is stale
+// it is used by the GameServersQueue to skip GameServers whose process has stopped heartbeating but which have not been marked as Unhealthy yet
+// it reconciles Nodes, so that the heartbeats are parsed when they are published and checking a GameServer does not fetch its Node
+type HeartbeatLivenessChecker struct {
+	client client.Reader
+	// staleness is the maximum age of the last heartbeat of a GameServer that can be allocated
+	staleness time.Duration
+	nowFunc   func() time.Time
+	mu        sync.RWMutex
+	// nodes contains the parsed heartbeats of every Node that has published them
+	// key to the map is the name of the Node
+	nodes map[string]*mpsv1alpha1.NodeHeartbeats
+	// onHeartbeats is called when the heartbeats of a Node have been parsed, if not nil
+	// it is used to hand the GameServers that were skipped as stale and are heartbeating again to waiting allocation requests
+	onHeartbeats func()
+	logger       logr.Logger
+}
+
+// NewHeartbeatLivenessChecker returns a new HeartbeatLivenessChecker that considers heartbeats older than staleness to be stale
+func NewHeartbeatLivenessChecker(c client.Reader, staleness time.Duration) *HeartbeatLivenessChecker {
+	return &HeartbeatLivenessChecker{
+		client:    c,
+		staleness: staleness,
+		nowFunc:   time.Now,
+		nodes:     make(map[string]*mpsv1alpha1.NodeHeartbeats),
+		logger:    log.Log.WithName("heartbeat-liveness"),
+	}
+}
+
+// isStale returns true if the last heartbeat of the provided GameServer is older than the staleness threshold
+// if the GameServer is not included in the heartbeats of its Node, the time they were published is used instead,
+// so that all GameServers of a Node whose NodeAgent has stopped publishing are stale
+// GameServers on Nodes without published heartbeats are never stale
+func (c *HeartbeatLivenessChecker) isStale(gs *GameServerForQueue) bool {
+	c.mu.RLock()
+	heartbeats := c.nodes[gs.NodeName]
+	c.mu.RUnlock()
+	if heartbeats == nil {
+		return false
+	}
+	lastHeartbeat, exists := heartbeats.GameServers[getNamespacedName(gs.Namespace, gs.Name)]
+	if !exists {
+		lastHeartbeat = heartbeats.PublishedAt
+	}
+	if c.nowFunc().Sub(time.UnixMilli(lastHeartbeat)) <= c.staleness {
+		return false
+	}
+	AllocationsStaleGameServersSkippedCounter.WithLabelValues(gs.BuildID).Inc()
+	c.logger.V(1).Info("skipping GameServer with stale heartbeat", "name", gs.Name, "namespace", gs.Namespace, "lastHeartbeat", time.UnixMilli(lastHeartbeat))
+	return true
+}
+
+// Reconcile parses the heartbeats published on a Node, it runs when a Node is created or deleted or its annotations change
+func (c *HeartbeatLivenessChecker) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var node corev1.Node
+	if err := c.client.Get(ctx, req.NamespacedName, &node); err != nil {
+		if apierrors.IsNotFound(err) {
+			c.setNodeHeartbeats(req.Name, nil)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	var heartbeats *mpsv1alpha1.NodeHeartbeats
+	if value, exists := node.Annotations[mpsv1alpha1.NodeHeartbeatsAnnotation]; exists {
+		heartbeats = &mpsv1alpha1.NodeHeartbeats{}
+		if err := json.Unmarshal([]byte(value), heartbeats); err != nil {
+			log.FromContext(ctx).Error(err, "unable to parse heartbeats of Node", "name", node.Name)
+			heartbeats = nil
+		}
+	}
+	c.setNodeHeartbeats(node.Name, heartbeats)
+	if heartbeats != nil && c.onHeartbeats != nil {
+		c.onHeartbeats()
+	}
+	return ctrl.Result{}, nil
+}
+
+// setNodeHeartbeats sets the heartbeats of the Node with the provided name, nil removes them
+func (c *HeartbeatLivenessChecker) setNodeHeartbeats(nodeName string, heartbeats *mpsv1alpha1.NodeHeartbeats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if heartbeats == nil {
+		delete(c.nodes, nodeName)
+		return
+	}
+	c.nodes[nodeName] = heartbeats
+}
+
+// SetupWithManager sets up the HeartbeatLivenessChecker with the Manager
+// it is named, since the PortRegistry is a Node controller as well
+func (c *HeartbeatLivenessChecker) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("heartbeat-liveness").
+		For(&corev1.Node{}, builder.WithPredicates(predicate.AnnotationChangedPredicate{})).
+		Complete(c)
+}
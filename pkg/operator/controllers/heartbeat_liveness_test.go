@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("heartbeat liveness tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+	)
+	now := time.Now()
+
+	testCreateNodeWithHeartbeats := func(name string, heartbeats *mpsv1alpha1.NodeHeartbeats) *corev1.Node {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if heartbeats != nil {
+			b, err := json.Marshal(heartbeats)
+			Expect(err).ToNot(HaveOccurred())
+			node.Annotations = map[string]string{mpsv1alpha1.NodeHeartbeatsAnnotation: string(b)}
+		}
+		return node
+	}
+
+	It("should consider only old heartbeats as stale", func() {
+		client := testNewSimpleK8sClient()
+		Expect(client.Create(context.Background(), testCreateNodeWithHeartbeats("node1", &mpsv1alpha1.NodeHeartbeats{
+			PublishedAt: now.UnixMilli(),
+			GameServers: map[string]int64{
+				"default/fresh": now.Add(-time.Second).UnixMilli(),
+				"default/stale": now.Add(-time.Minute).UnixMilli(),
+			},
+		}))).To(Succeed())
+		Expect(client.Create(context.Background(), testCreateNodeWithHeartbeats("node2", &mpsv1alpha1.NodeHeartbeats{
+			PublishedAt: now.Add(-time.Minute).UnixMilli(),
+		}))).To(Succeed())
+		Expect(client.Create(context.Background(), testCreateNodeWithHeartbeats("node3", nil))).To(Succeed())
+		lc := NewHeartbeatLivenessChecker(client, 10*time.Second)
+		lc.nowFunc = func() time.Time { return now }
+		testReconcileNodes(lc, "node1", "node2", "node3", "node4")
+
+		gsOnNode := func(name, nodeName string) *GameServerForQueue {
+			return &GameServerForQueue{Name: name, Namespace: "default", BuildID: buildID1, NodeName: nodeName}
+		}
+		Expect(lc.isStale(gsOnNode("fresh", "node1"))).To(BeFalse())
+		Expect(lc.isStale(gsOnNode("stale", "node1"))).To(BeTrue())
+		// not published yet, but the NodeAgent is publishing
+		Expect(lc.isStale(gsOnNode("new", "node1"))).To(BeFalse())
+		// the NodeAgent has stopped publishing
+		Expect(lc.isStale(gsOnNode("new", "node2"))).To(BeTrue())
+		// no heartbeats published or unknown Node
+		Expect(lc.isStale(gsOnNode("fresh", "node3"))).To(BeFalse())
+		Expect(lc.isStale(gsOnNode("fresh", "node4"))).To(BeFalse())
+		Expect(lc.isStale(gsOnNode("fresh", ""))).To(BeFalse())
+
+		// the heartbeats of a deleted Node are removed
+		Expect(client.Delete(context.Background(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}})).To(Succeed())
+		testReconcileNodes(lc, "node2")
+		Expect(lc.isStale(gsOnNode("new", "node2"))).To(BeFalse())
+	})
+	It("should allocate a game server with a fresh heartbeat", func() {
+		client := testNewSimpleK8sClient()
+		stale, err := testCreateGameServerAndBuild(client, "stalegs", buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		fresh, err := testCreateGameServer(client, "freshgs", buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.Create(context.Background(), testCreateNodeWithHeartbeats("node1", &mpsv1alpha1.NodeHeartbeats{
+			PublishedAt: now.UnixMilli(),
+			GameServers: map[string]int64{
+				"default/stalegs": now.Add(-time.Minute).UnixMilli(),
+				"default/freshgs": now.UnixMilli(),
+			},
+		}))).To(Succeed())
+
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		lc := NewHeartbeatLivenessChecker(client, 10*time.Second)
+		testReconcileNodes(lc, "node1")
+		h.SetLivenessChecker(lc)
+		// the stale game server is on a newer Node, so it would be allocated first
+		for _, gs := range []*GameServerForQueue{
+			{Name: stale.Name, Namespace: stale.Namespace, BuildID: buildID1, NodeName: "node1", NodeAge: 0, ResourceVersion: stale.ResourceVersion},
+			{Name: fresh.Name, Namespace: fresh.Namespace, BuildID: buildID1, NodeName: "node1", NodeAge: 1, ResourceVersion: fresh.ResourceVersion},
+		} {
+			h.gameServerQueue.PushToQueue(gs)
+		}
+		res, err := h.allocate(context.Background(), &AllocateArgs{BuildID: buildID1, SessionID: sessionID1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Name).To(Equal("freshgs"))
+		_, err = h.allocate(context.Background(), &AllocateArgs{BuildID: buildID1, SessionID: "7b8e4f2a-3c1d-4e5f-9a6b-0c1d2e3f4a5b"})
+		Expect(err).To(HaveOccurred())
+		Expect(getAllocationErrorStatusCode(err)).To(Equal(http.StatusTooManyRequests))
+	})
+})
+
+// testReconcileNodes reconciles the Nodes with the provided names, as the manager would do when they change
+func testReconcileNodes(lc *HeartbeatLivenessChecker, nodeNames ...string) {
+	for _, nodeName := range nodeNames {
+		_, err := lc.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: nodeName}})
+		Expect(err).ToNot(HaveOccurred())
+	}
+}
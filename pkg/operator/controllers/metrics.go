@@ -8,6 +8,7 @@ import (
 
 const (
 	ActiveServerStatus       = "active"
+	ReservedServerStatus     = "reserved"
 	StandingByServerStatus   = "standingby"
 	InitializingServerStatus = "initializing"
 	PendingServerStatus      = "pending"
@@ -120,6 +121,150 @@ var (
 		},
 		[]string{"BuildName"},
 	)
+	GameServersReusedCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "gameservers_reused_total",
+			Help:      "Number of GameServers that were released back to StandingBy after hosting a session",
+		},
+		[]string{"BuildName"},
+	)
+	GameServersReleaseRequestedCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "gameservers_release_requested_total",
+			Help:      "Number of GameServer sessions whose release was requested through the allocation API service",
+		},
+		[]string{"BuildName"},
+	)
+	GameServersTerminationRequestedCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "gameservers_termination_requested_total",
+			Help:      "Number of GameServers that were marked for termination through the allocation API service",
+		},
+		[]string{"BuildName"},
+	)
+	GameServersForceTerminatedCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "gameservers_force_terminated_total",
+			Help:      "Number of GameServers that were deleted because their process did not exit within the termination grace period",
+		},
+		[]string{"BuildName"},
+	)
+	ReservationsCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "reservations_total",
+			Help:      "Number of GameServer reservations",
+		},
+		[]string{"BuildName"},
+	)
+	ReservationsConfirmedCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "reservations_confirmed_total",
+			Help:      "Number of GameServer reservations that were confirmed",
+		},
+		[]string{"BuildName"},
+	)
+	ReservationsReleasedCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "reservations_released_total",
+			Help:      "Number of GameServer reservations that were canceled or expired, by reason",
+		},
+		[]string{"BuildName", "Reason"},
+	)
+	FederatedAllocationsCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "federated_allocations_total",
+			Help:      "Number of federated GameServer allocations per region",
+		},
+		[]string{"Region"},
+	)
+	FederatedAllocationFallbacksCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "federated_allocations_fallbacks_total",
+			Help:      "Number of federated allocations that failed in a region and fell back to the next one",
+		},
+		[]string{"Region"},
+	)
+	AllocationsAuthDeniedCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "allocations_auth_denied_total",
+			Help:      "Number of calls to the allocation API service that were denied by token authentication, by reason",
+		},
+		[]string{"Reason"},
+	)
+	AllocationsRateLimitedCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "allocations_rate_limited_total",
+			Help:      "Number of allocations rejected by the rate limits or the title active sessions quotas, by reason",
+		},
+		[]string{"BuildID", "Reason"},
+	)
+	LifecycleEventsSentCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "lifecycle_events_sent_total",
+			Help:      "Number of GameServer lifecycle events sent to an endpoint, by type",
+		},
+		[]string{"Type"},
+	)
+	LifecycleEventsFailedCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "lifecycle_events_failed_total",
+			Help:      "Number of GameServer lifecycle events that could not be sent to an endpoint after all retries, by endpoint",
+		},
+		[]string{"Endpoint"},
+	)
+	LifecycleEventsDroppedCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "lifecycle_events_dropped_total",
+			Help:      "Number of GameServer lifecycle events dropped because the buffer was full, by type",
+		},
+		[]string{"Type"},
+	)
+	AllocationsStaleGameServersSkippedCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "allocations_stale_gameservers_skipped_total",
+			Help:      "Number of times a StandingBy GameServer was skipped by an allocation because its last heartbeat was stale, by BuildID",
+		},
+		[]string{"BuildID"},
+	)
+	ExternalScalingDecisionsCounter = registry.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "thundernetes",
+			Name:      "external_scaling_decisions_total",
+			Help:      "Number of requests to the external scaling endpoints, by result",
+		},
+		[]string{"BuildName", "Result"},
+	)
+	ExternalScalingDecisionGauge = registry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "thundernetes",
+			Name:      "external_scaling_decision",
+			Help:      "The last successful decision of the external scaling endpoints, after the safety bounds were applied",
+		},
+		[]string{"BuildName", "Field"},
+	)
+	CrashBackoffGauge = registry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "thundernetes",
+			Name:      "gameserverbuild_crash_backoff_seconds",
+			Help:      "The current backoff of the GameServer creations of a GameServerBuild after a crash",
+		},
+		[]string{"BuildName"},
+	)
 	GameServerReconcileDuration = registry.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: "thundernetes",
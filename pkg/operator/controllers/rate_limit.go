@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+// reasons for rate limited allocations, used as the Reason label of AllocationsRateLimitedCounter
+const (
+	rateLimitedReasonCaller     = "CallerRateLimit"
+	rateLimitedReasonBuild      = "BuildRateLimit"
+	rateLimitedReasonTitleQuota = "TitleActiveQuota"
+)
+
+// limiterSweepInterval is how often the token buckets that are not used anymore are removed
+const limiterSweepInterval = time.Minute
+
+// AllocationRateLimiter limits the allocations of the allocation API service
+// it has a token bucket per caller and per build, and optional caps on the number of concurrent Active sessions per title
+type AllocationRateLimiter struct {
+	mu sync.Mutex
+	// callerLimit and buildLimit are the rates at which the buckets are refilled, zero disables the respective limit
+	callerLimit rate.Limit
+	callerBurst int
+	buildLimit  rate.Limit
+	buildBurst  int
+	// callers and builds contain the token buckets by caller identity and by BuildID
+	// a bucket that is full is removed by the next sweep, since it behaves like a new one
+	callers map[string]*rate.Limiter
+	builds  map[string]*rate.Limiter
+	// lastSweep is the last time the full token buckets were removed
+	lastSweep time.Time
+	// titleActiveLimits contains the maximum number of Active and Reserved GameServers by TitleID
+	titleActiveLimits map[string]int
+}
+
+// NewAllocationRateLimiter returns a new AllocationRateLimiter
+// titleActiveLimits is a list of titleID=limit pairs
+func NewAllocationRateLimiter(callerQPS float64, callerBurst int, buildQPS float64, buildBurst int, titleActiveLimits []string) (*AllocationRateLimiter, error) {
+	if callerQPS < 0 || buildQPS < 0 {
+		return nil, errors.New("rate limits cannot be negative")
+	}
+	if (callerQPS > 0 && callerBurst < 1) || (buildQPS > 0 && buildBurst < 1) {
+		return nil, errors.New("rate limit bursts must be at least 1")
+	}
+	rl := &AllocationRateLimiter{
+		callerLimit:       rate.Limit(callerQPS),
+		callerBurst:       callerBurst,
+		buildLimit:        rate.Limit(buildQPS),
+		buildBurst:        buildBurst,
+		callers:           make(map[string]*rate.Limiter),
+		builds:            make(map[string]*rate.Limiter),
+		titleActiveLimits: make(map[string]int),
+	}
+	for _, titleLimit := range titleActiveLimits {
+		titleID, limit, found := strings.Cut(titleLimit, "=")
+		if !found || titleID == "" {
+			return nil, fmt.Errorf("invalid title active sessions limit %q, expected format is titleID=limit", titleLimit)
+		}
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid title active sessions limit %q, limit must be a non-negative integer", titleLimit)
+		}
+		rl.titleActiveLimits[titleID] = n
+	}
+	return rl, nil
+}
+
+// allowCaller returns an error with status code 429 if the caller of the context has exceeded its rate limit
+// calls without a caller identity are not limited, rejected calls are counted for every build they could have used
+func (rl *AllocationRateLimiter) allowCaller(ctx context.Context, buildIDs []string) error {
+	caller := callerIdentityFromContext(ctx)
+	if rl.callerLimit == 0 || caller == "" {
+		return nil
+	}
+	if !rl.getLimiter(rl.callers, caller, rl.callerLimit, rl.callerBurst).Allow() {
+		countRateLimited(buildIDs, rateLimitedReasonCaller)
+		return newAllocationError(http.StatusTooManyRequests, errors.New("rate limit exceeded"), fmt.Sprintf("caller %s has exceeded its allocation rate limit", caller))
+	}
+	return nil
+}
+
+// availableBuilds returns the BuildIDs that have not exceeded their rate limits, keeping their order
+// it returns an error with status code 429 if all of them have. It does not take a token, this is done by takeBuildToken
+// for the build that is allocated from, so that a call using a BuildAlias does not take a token from each of its builds
+func (rl *AllocationRateLimiter) availableBuilds(buildIDs []string) ([]string, error) {
+	if rl.buildLimit == 0 {
+		return buildIDs, nil
+	}
+	allowed := make([]string, 0, len(buildIDs))
+	for _, buildID := range buildIDs {
+		if rl.getLimiter(rl.builds, buildID, rl.buildLimit, rl.buildBurst).Tokens() >= 1 {
+			allowed = append(allowed, buildID)
+		}
+	}
+	if len(allowed) == 0 {
+		countRateLimited(buildIDs, rateLimitedReasonBuild)
+		return nil, newAllocationError(http.StatusTooManyRequests, errors.New("rate limit exceeded"), fmt.Sprintf("build %s has exceeded its allocation rate limit", strings.Join(buildIDs, ", ")))
+	}
+	return allowed, nil
+}
+
+// takeBuildToken takes a token from the bucket of the build with the provided BuildID
+// if concurrent allocations took the last token after availableBuilds was called, the bucket goes into debt
+// and the following allocations of the build are rejected until it is refilled
+func (rl *AllocationRateLimiter) takeBuildToken(buildID string) {
+	if rl.buildLimit == 0 {
+		return
+	}
+	rl.getLimiter(rl.builds, buildID, rl.buildLimit, rl.buildBurst).Reserve()
+}
+
+// countRateLimited counts an allocation that was rejected with the provided reason for each of the provided builds
+func countRateLimited(buildIDs []string, reason string) {
+	for _, buildID := range buildIDs {
+		AllocationsRateLimitedCounter.WithLabelValues(buildID, reason).Inc()
+	}
+}
+
+// getLimiter returns the token bucket with the provided key, creating it if it does not exist
+func (rl *AllocationRateLimiter) getLimiter(limiters map[string]*rate.Limiter, key string, limit rate.Limit, burst int) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if now := time.Now(); now.Sub(rl.lastSweep) >= limiterSweepInterval {
+		rl.removeIdleLimiters(now)
+		rl.lastSweep = now
+	}
+	l, ok := limiters[key]
+	if !ok {
+		l = rate.NewLimiter(limit, burst)
+		limiters[key] = l
+	}
+	return l
+}
+
+// removeIdleLimiters removes the token buckets that have been refilled, so that the buckets of callers and builds
+// that are not used anymore do not accumulate. Caller should hold the mutex
+func (rl *AllocationRateLimiter) removeIdleLimiters(now time.Time) {
+	for _, limiters := range []map[string]*rate.Limiter{rl.callers, rl.builds} {
+		for key, l := range limiters {
+			if l.TokensAt(now) >= float64(l.Burst()) {
+				delete(limiters, key)
+			}
+		}
+	}
+}
+
+// applyTitleQuotas returns the BuildIDs whose titles have not reached their cap of concurrent Active sessions, keeping their order
+// it returns an error with status code 429 if none of them can be used
+// Active and Reserved GameServers are counted from the cache, so concurrent allocations can briefly exceed the cap
+func (s *AllocationApiServer) applyTitleQuotas(ctx context.Context, buildIDs []string) ([]string, error) {
+	if len(s.rateLimiter.titleActiveLimits) == 0 {
+		return buildIDs, nil
+	}
+	allowed := make([]string, 0, len(buildIDs))
+	var titleID string
+	for _, buildID := range buildIDs {
+		var err error
+		if titleID, err = s.getTitleIDForBuild(ctx, buildID); err != nil {
+			return nil, err
+		}
+		limit, ok := s.rateLimiter.titleActiveLimits[titleID]
+		if !ok {
+			allowed = append(allowed, buildID)
+			continue
+		}
+		active, err := s.countActiveGameServersForTitle(ctx, titleID)
+		if err != nil {
+			return nil, err
+		}
+		if active < limit {
+			allowed = append(allowed, buildID)
+		}
+	}
+	if len(allowed) == 0 {
+		countRateLimited(buildIDs, rateLimitedReasonTitleQuota)
+		return nil, newAllocationError(http.StatusTooManyRequests, errors.New("active sessions quota exceeded"), fmt.Sprintf("title %s has reached its cap of concurrent active sessions", titleID))
+	}
+	return allowed, nil
+}
+
+// countActiveGameServersForTitle returns the number of Active and Reserved GameServers of the title with the provided TitleID
+func (s *AllocationApiServer) countActiveGameServersForTitle(ctx context.Context, titleID string) (int, error) {
+	var gameServers mpsv1alpha1.GameServerList
+	if err := s.Client.List(ctx, &gameServers, client.MatchingFields{specTitleId: titleID}); err != nil {
+		return 0, newAllocationError(http.StatusInternalServerError, err, "error listing")
+	}
+	count := 0
+	for _, gs := range gameServers.Items {
+		if gs.Status.State == mpsv1alpha1.GameServerStateActive || gs.Status.State == mpsv1alpha1.GameServerStateReserved {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// callerIdentityFromContext returns the identity of the caller of the context
+// it is the subject of the token, if the call was authenticated with a token, or the common name of the client certificate, if it was authenticated with mTLS
+func callerIdentityFromContext(ctx context.Context) string {
+	if claims := callerClaimsFromContext(ctx); claims != nil {
+		return claims.Subject
+	}
+	cn, _ := ctx.Value(clientCertificateCNContextKey{}).(string)
+	return cn
+}
+
+// clientCertificateCNContextKey is the key of the common name of the client certificate in the request context
+type clientCertificateCNContextKey struct{}
+
+// withClientCertificateCN returns a copy of the context that carries the common name of the first certificate of the provided connection state
+func withClientCertificateCN(ctx context.Context, state *tls.ConnectionState) context.Context {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, clientCertificateCNContextKey{}, state.PeerCertificates[0].Subject.CommonName)
+}
+
+// clientCertificateMiddleware returns a handler that adds the common name of the client certificate to the request context
+func clientCertificateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(withClientCertificateCN(r.Context(), r.TLS)))
+	})
+}
+
+// clientCertificateUnaryInterceptor adds the common name of the client certificate of gRPC calls to the context
+func clientCertificateUnaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			ctx = withClientCertificateCN(ctx, &tlsInfo.State)
+		}
+	}
+	return handler(ctx, req)
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("allocation API service rate limit tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		sessionID2 string = "7b8e4f2a-3c1d-4e5f-9a6b-0c1d2e3f4a5b"
+		sessionID3 string = "1f0a8b3c-5d6e-4f7a-8b9c-0d1e2f3a4b5c"
+		gsName     string = "testgs"
+		titleID1   string = "title1"
+	)
+
+	allocate := func(h *AllocationApiServer, ctx context.Context, sessionID string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"buildID\":\"%s\",\"sessionID\":\"%s\"}", buildID1, sessionID)))
+		w := httptest.NewRecorder()
+		h.handleAllocationRequest(w, req.WithContext(ctx))
+		return w.Result().StatusCode
+	}
+
+	It("should reject invalid configuration", func() {
+		_, err := NewAllocationRateLimiter(-1, 1, 0, 0, nil)
+		Expect(err).To(HaveOccurred())
+		_, err = NewAllocationRateLimiter(1, 0, 0, 0, nil)
+		Expect(err).To(HaveOccurred())
+		_, err = NewAllocationRateLimiter(0, 0, 0, 0, []string{"title1"})
+		Expect(err).To(HaveOccurred())
+		_, err = NewAllocationRateLimiter(0, 0, 0, 0, []string{"title1=-1"})
+		Expect(err).To(HaveOccurred())
+		rl, err := NewAllocationRateLimiter(0, 0, 0, 0, []string{"title1=5", "title2=0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rl.titleActiveLimits).To(Equal(map[string]int{"title1": 5, "title2": 0}))
+	})
+	It("should limit the allocations per caller", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		for i := 0; i < 2; i++ {
+			standingBy, err := testCreateGameServer(client, fmt.Sprintf("%s-%d", gsName, i), buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+			Expect(err).ToNot(HaveOccurred())
+			h.gameServerQueue.PushToQueue(&GameServerForQueue{
+				Name:            standingBy.Name,
+				Namespace:       standingBy.Namespace,
+				BuildID:         buildID1,
+				ResourceVersion: standingBy.ResourceVersion,
+			})
+		}
+		rl, err := NewAllocationRateLimiter(0.001, 1, 0, 0, nil)
+		Expect(err).ToNot(HaveOccurred())
+		h.SetRateLimiter(rl)
+
+		caller1 := withClientCertificateCN(context.Background(), &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "caller1"}}}})
+		caller2 := withCallerClaims(context.Background(), &CallerClaims{Subject: "caller2"})
+		// returning an existing session does not take a token
+		for i := 0; i < 3; i++ {
+			Expect(allocate(h, caller1, sessionID1)).To(Equal(http.StatusOK))
+		}
+		Expect(allocate(h, caller1, sessionID2)).To(Equal(http.StatusOK))
+		// a throttled caller can still retry the session it has allocated
+		Expect(allocate(h, caller1, sessionID3)).To(Equal(http.StatusTooManyRequests))
+		Expect(allocate(h, caller1, sessionID2)).To(Equal(http.StatusOK))
+		// other callers have their own buckets
+		Expect(allocate(h, caller2, sessionID3)).To(Equal(http.StatusOK))
+		// calls without a caller identity are not limited per caller
+		for i := 0; i < 3; i++ {
+			Expect(allocate(h, context.Background(), sessionID1)).To(Equal(http.StatusOK))
+		}
+	})
+	It("should limit the allocations per build", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		for i := 0; i < 2; i++ {
+			standingBy, err := testCreateGameServer(client, fmt.Sprintf("%s-%d", gsName, i), buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+			Expect(err).ToNot(HaveOccurred())
+			h.gameServerQueue.PushToQueue(&GameServerForQueue{
+				Name:            standingBy.Name,
+				Namespace:       standingBy.Namespace,
+				BuildID:         buildID1,
+				ResourceVersion: standingBy.ResourceVersion,
+			})
+		}
+		rl, err := NewAllocationRateLimiter(0, 0, 0.001, 1, nil)
+		Expect(err).ToNot(HaveOccurred())
+		h.SetRateLimiter(rl)
+		// returning an existing session does not take a token
+		Expect(allocate(h, context.Background(), sessionID1)).To(Equal(http.StatusOK))
+		Expect(allocate(h, context.Background(), sessionID2)).To(Equal(http.StatusOK))
+		Expect(allocate(h, withCallerClaims(context.Background(), &CallerClaims{Subject: "caller2"}), sessionID3)).To(Equal(http.StatusTooManyRequests))
+	})
+	It("should limit the allocations of each build of a BuildAlias", func() {
+		const (
+			buildName2 string = "testbuild2"
+			buildID2   string = "f2c1a4d8-3e7b-4c9a-8d1f-6b5e4a3c2d10"
+			aliasID    string = "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"
+		)
+		cl := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(cl, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		standingBy, err := testCreateGameServerAndBuild(cl, gsName+"2", buildName2, buildID2, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cl.Create(context.Background(), &mpsv1alpha1.BuildAlias{
+			ObjectMeta: metav1.ObjectMeta{Name: "alias", Namespace: "default"},
+			Spec: mpsv1alpha1.BuildAliasSpec{
+				AliasID: aliasID,
+				Builds:  []mpsv1alpha1.BuildAliasTarget{{BuildID: buildID1, Weight: 1}, {BuildID: buildID2, Priority: 1}},
+			},
+		})).To(Succeed())
+		h := NewAllocationApiServer(nil, cl, allocationApiSvcPort)
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            standingBy.Name,
+			Namespace:       standingBy.Namespace,
+			BuildID:         buildID2,
+			ResourceVersion: standingBy.ResourceVersion,
+		})
+		rl, err := NewAllocationRateLimiter(0, 0, 0.001, 1, nil)
+		Expect(err).ToNot(HaveOccurred())
+		h.SetRateLimiter(rl)
+		// the first build has no StandingBy servers, so the allocation takes the token of the second one
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"buildID\":\"%s\",\"sessionID\":\"%s\"}", aliasID, sessionID2)))
+		w := httptest.NewRecorder()
+		h.handleAllocationRequest(w, req)
+		Expect(w.Result().StatusCode).To(Equal(http.StatusOK))
+		Expect(rl.builds).To(HaveKey(buildID1))
+		Expect(rl.builds[buildID1].Tokens()).To(BeNumerically(">=", 1))
+		Expect(rl.builds[buildID2].Tokens()).To(BeNumerically("<", 1))
+		Expect(rl.builds).ToNot(HaveKey(aliasID))
+	})
+	It("should remove the token buckets that have been refilled", func() {
+		rl, err := NewAllocationRateLimiter(1000, 1, 1000, 1, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rl.getLimiter(rl.callers, "caller1", rl.callerLimit, rl.callerBurst).Allow()).To(BeTrue())
+		rl.takeBuildToken(buildID1)
+		Expect(rl.callers).To(HaveKey("caller1"))
+		Expect(rl.builds).To(HaveKey(buildID1))
+		// the buckets are refilled after a millisecond
+		time.Sleep(10 * time.Millisecond)
+		rl.lastSweep = time.Time{}
+		rl.getLimiter(rl.callers, "caller2", rl.callerLimit, rl.callerBurst)
+		Expect(rl.callers).To(HaveLen(1))
+		Expect(rl.callers).To(HaveKey("caller2"))
+		Expect(rl.builds).To(BeEmpty())
+	})
+	It("should cap the concurrent active sessions of a title", func() {
+		cl := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(cl, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		gs.Spec.TitleID = titleID1
+		Expect(cl.Update(context.Background(), gs)).To(Succeed())
+		var gsb mpsv1alpha1.GameServerBuild
+		Expect(cl.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: buildName1}, &gsb)).To(Succeed())
+		gsb.Spec.TitleID = titleID1
+		Expect(cl.Update(context.Background(), &gsb)).To(Succeed())
+		standingBy, err := testCreateGameServer(cl, gsName+"2", buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+
+		h := NewAllocationApiServer(nil, cl, allocationApiSvcPort)
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            standingBy.Name,
+			Namespace:       standingBy.Namespace,
+			BuildID:         buildID1,
+			ResourceVersion: standingBy.ResourceVersion,
+		})
+		rl, err := NewAllocationRateLimiter(0, 0, 0, 0, []string{titleID1 + "=1"})
+		Expect(err).ToNot(HaveOccurred())
+		h.SetRateLimiter(rl)
+		// the existing session is still returned
+		Expect(allocate(h, context.Background(), sessionID1)).To(Equal(http.StatusOK))
+		Expect(allocate(h, context.Background(), sessionID2)).To(Equal(http.StatusTooManyRequests))
+		// raising the cap allows the allocation
+		rl.titleActiveLimits[titleID1] = 2
+		Expect(allocate(h, context.Background(), sessionID2)).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+// handleReleaseRequest requests the release of an Active session, so that its GameServer can host another one
+// the NodeAgent asks the game server process to release the session, which is cleared when the process reports StandingBy again
+func (s *AllocationApiServer) handleReleaseRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	args, ok := s.parseSessionArgs(w, r)
+	if !ok {
+		return
+	}
+
+	gs, err := s.getGameServerForSession(ctx, args.SessionID)
+	if err != nil {
+		writeAllocationError(w, s.logger, err)
+		return
+	}
+	if gs.Status.State != mpsv1alpha1.GameServerStateActive {
+		writeAllocationError(w, s.logger, newAllocationError(http.StatusConflict, fmt.Errorf("GameServer is %s", gs.Status.State), fmt.Sprintf("session %s is not active", args.SessionID)))
+		return
+	}
+	// the release was already requested, we return success so that clients can retry
+	if gs.Status.ReleaseRequestedOn != nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	patch := client.MergeFromWithOptions(gs.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	now := metav1.Now()
+	gs.Status.ReleaseRequestedOn = &now
+	if err := s.Client.Status().Patch(ctx, gs, patch); err != nil {
+		writeAllocationError(w, s.logger, patchErrorToAllocationError(err))
+		return
+	}
+	s.logger.Info("Requested the release of GameServer session", "name", gs.Name, "sessionID", gs.Status.SessionID, "buildID", gs.Spec.BuildID)
+	GameServersReleaseRequestedCounter.WithLabelValues(gs.Labels[LabelBuildName]).Inc()
+	w.WriteHeader(http.StatusOK)
+}
+
+// releaseSession clears the session details of the provided GameServer, which its game server process released back to StandingBy,
+// and increments its reuse count
+// the GameServer is put back on the queue through the events channel
+func (s *AllocationApiServer) releaseSession(ctx context.Context, gs *mpsv1alpha1.GameServer) error {
+	gs2 := gs.DeepCopy()
+	// we're using optimistic lock to make sure the GameServer has not been modified in the meantime
+	patch := client.MergeFromWithOptions(gs.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	// ReachedStandingByOn is kept, the NodeAgent has set it when the game server process reported StandingBy
+	gs2.Status.State = mpsv1alpha1.GameServerStateStandingBy
+	clearSessionDetails(&gs2.Status)
+	gs2.Status.ReuseCount++
+	if err := s.Client.Status().Patch(ctx, gs2, patch); err != nil {
+		return err
+	}
+
+	s.gameServerQueue.UpdateNodeUtilization(gs.Namespace, gs.Name, "", "", false)
+	s.logger.Info("Released GameServer session", "name", gs.Name, "sessionID", gs.Status.SessionID, "buildID", gs.Spec.BuildID, "reuseCount", gs2.Status.ReuseCount)
+	GameServersReusedCounter.WithLabelValues(gs.Labels[LabelBuildName]).Inc()
+	s.events <- event.GenericEvent{
+		Object: gs2,
+	}
+	return nil
+}
+
+// clearSessionDetails clears the details of the session that was allocated or reserved on a GameServer
+func clearSessionDetails(status *mpsv1alpha1.GameServerStatus) {
+	status.SessionID = ""
+	status.SessionCookie = ""
+	status.InitialPlayers = nil
+	status.SessionMetadata = nil
+	status.ReservedUntil = nil
+	status.ReachedActiveOn = nil
+	status.ReleaseRequestedOn = nil
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("allocation API service release tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		gsName     string = "testgs"
+	)
+
+	// testRelease calls the release route with the provided sessionID and returns the status code
+	testRelease := func(h *AllocationApiServer, sessionID string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/release", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\"}", sessionID)))
+		w := httptest.NewRecorder()
+		h.handleReleaseRequest(w, req)
+		return w.Result().StatusCode
+	}
+
+	It("should request the release of an Active session", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		Expect(testRelease(h, sessionID1)).To(Equal(http.StatusOK))
+
+		// the session is kept until the game server process releases it
+		var gs mpsv1alpha1.GameServer
+		Expect(client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsName}, &gs)).To(Succeed())
+		Expect(gs.Status.State).To(Equal(mpsv1alpha1.GameServerStateActive))
+		Expect(gs.Status.SessionID).To(Equal(sessionID1))
+		Expect(gs.Status.ReleaseRequestedOn).ToNot(BeNil())
+		requestedOn := gs.Status.ReleaseRequestedOn.DeepCopy()
+		// requesting it again succeeds, so that clients can retry
+		Expect(testRelease(h, sessionID1)).To(Equal(http.StatusOK))
+		Expect(client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsName}, &gs)).To(Succeed())
+		Expect(gs.Status.ReleaseRequestedOn.Equal(requestedOn)).To(BeTrue())
+
+		// the NodeAgent sets the state to StandingBy when the game server process has released the session
+		gs.Status.State = mpsv1alpha1.GameServerStateStandingBy
+		Expect(client.Status().Update(context.Background(), &gs)).To(Succeed())
+		_, err = h.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: gsName}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsName}, &gs)).To(Succeed())
+		Expect(gs.Status.SessionID).To(BeEmpty())
+		Expect(gs.Status.ReleaseRequestedOn).To(BeNil())
+		Expect(gs.Status.ReuseCount).To(Equal(1))
+
+		// the session no longer exists
+		Expect(testRelease(h, sessionID1)).To(Equal(http.StatusNotFound))
+	})
+	It("should return conflict when releasing a session that is not Active", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateReserved)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		Expect(testRelease(h, sessionID1)).To(Equal(http.StatusConflict))
+	})
+	It("should clear the session of a game server that was released by its game server process", func() {
+		client := testNewSimpleK8sClient()
+		// the NodeAgent has set the state to StandingBy, but the session details are still there
+		gs, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		gs.Spec.BuildID = buildID1
+		Expect(client.Update(context.Background(), gs)).To(Succeed())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		_, err = h.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: gsName}})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsName}, gs)).To(Succeed())
+		Expect(gs.Status.State).To(Equal(mpsv1alpha1.GameServerStateStandingBy))
+		Expect(gs.Status.SessionID).To(BeEmpty())
+		Expect(gs.Status.ReuseCount).To(Equal(1))
+		// the game server is only put on the queue once its session has been cleared
+		Expect(h.gameServerQueue.PopFromQueue(buildID1)).To(BeNil())
+
+		_, err = h.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: gsName}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(h.gameServerQueue.PopFromQueue(buildID1)).ToNot(BeNil())
+	})
+})
@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+const (
+	// defaultReservationTTL is the time a GameServer stays Reserved if the client does not specify one
+	defaultReservationTTL = 30 * time.Second
+	// maxReservationTTL is the maximum time a GameServer can stay Reserved
+	maxReservationTTL = 10 * time.Minute
+	// reservationCanceled and reservationExpired are the reasons a reservation is released
+	reservationCanceled = "Canceled"
+	reservationExpired  = "Expired"
+)
+
+// ReserveArgs contains information necessary to reserve a GameServer
+type ReserveArgs struct {
+	AllocateArgs
+	// ReservationTTLSeconds is the number of seconds the GameServer stays Reserved before it returns to StandingBy
+	// if the reservation is not confirmed. If it is zero, the default of 30 seconds is used
+	ReservationTTLSeconds int `json:"reservationTtlSeconds"`
+}
+
+// SessionArgs identifies the session of an existing GameServer, e.g. to confirm or cancel its reservation
+type SessionArgs struct {
+	SessionID string `json:"sessionID"`
+}
+
+// ReserveResponse contains details that are returned on a successful GameServer reservation call
+type ReserveResponse struct {
+	RequestMultiplayerServerResponse
+	// State is the state of the GameServer, it is Active if the session was already allocated
+	State mpsv1alpha1.GameServerState
+	// ReservedUntil is the time the GameServer returns to StandingBy if the reservation is not confirmed
+	ReservedUntil *metav1.Time `json:",omitempty"`
+}
+
+// validateReserveArgs validates an instance of the ReserveArgs struct
+func validateReserveArgs(ra *ReserveArgs) bool {
+	if !validateAllocateArgs(&ra.AllocateArgs) {
+		return false
+	}
+	return ra.ReservationTTLSeconds >= 0 && time.Duration(ra.ReservationTTLSeconds)*time.Second <= maxReservationTTL
+}
+
+// getReservationTTL returns the reservation TTL for the provided arguments, which should have already been validated
+func getReservationTTL(ra *ReserveArgs) time.Duration {
+	if ra.ReservationTTLSeconds == 0 {
+		return defaultReservationTTL
+	}
+	return time.Duration(ra.ReservationTTLSeconds) * time.Second
+}
+
+// handleReserveRequest reserves a StandingBy GameServer, which has to be confirmed before the reservation expires
+func (s *AllocationApiServer) handleReserveRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		badRequestError(w, s.logger, errors.New("invalid method"), "Only POST is accepted")
+		return
+	}
+
+	var args ReserveArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		badRequestError(w, s.logger, err, "cannot deserialize json")
+		return
+	}
+	if !validateReserveArgs(&args) {
+		badRequestError(w, s.logger, errors.New("invalid sessionID, buildID, waitTimeoutMs or reservationTtlSeconds"), "invalid arguments")
+		return
+	}
+	extendWriteDeadline(w, args.WaitTimeoutMs)
+
+	gs, err := s.allocateOrReserve(ctx, &args.AllocateArgs, getReservationTTL(&args))
+	if err != nil {
+		writeAllocationError(w, s.logger, err)
+		return
+	}
+
+	rs := ReserveResponse{
+		RequestMultiplayerServerResponse: RequestMultiplayerServerResponse{
+			IPV4Address: gs.Status.PublicIP,
+			Ports:       gs.Status.Ports,
+			SessionID:   args.SessionID,
+		},
+		State:         gs.Status.State,
+		ReservedUntil: gs.Status.ReservedUntil,
+	}
+	if err := json.NewEncoder(w).Encode(rs); err != nil {
+		internalServerError(w, s.logger, err, "encode json response")
+	}
+}
+
+// handleConfirmReservationRequest transitions a Reserved GameServer to Active
+func (s *AllocationApiServer) handleConfirmReservationRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	w.Header().Set("Content-Type", "application/json")
+	args, ok := s.parseSessionArgs(w, r)
+	if !ok {
+		return
+	}
+
+	gs, err := s.getGameServerForSession(ctx, args.SessionID)
+	if err != nil {
+		writeAllocationError(w, s.logger, err)
+		return
+	}
+	gs, err = s.confirmReservation(ctx, gs)
+	if err != nil {
+		writeAllocationError(w, s.logger, err)
+		return
+	}
+
+	rs := RequestMultiplayerServerResponse{
+		IPV4Address: gs.Status.PublicIP,
+		Ports:       gs.Status.Ports,
+		SessionID:   args.SessionID,
+	}
+	if err := json.NewEncoder(w).Encode(rs); err != nil {
+		internalServerError(w, s.logger, err, "encode json response")
+	}
+}
+
+// handleCancelReservationRequest returns a Reserved GameServer to StandingBy
+func (s *AllocationApiServer) handleCancelReservationRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	args, ok := s.parseSessionArgs(w, r)
+	if !ok {
+		return
+	}
+
+	gs, err := s.getGameServerForSession(ctx, args.SessionID)
+	if err != nil {
+		writeAllocationError(w, s.logger, err)
+		return
+	}
+	if gs.Status.State != mpsv1alpha1.GameServerStateReserved {
+		writeAllocationError(w, s.logger, newAllocationError(http.StatusConflict, fmt.Errorf("GameServer is %s", gs.Status.State), fmt.Sprintf("session %s is not reserved", args.SessionID)))
+		return
+	}
+	if err := s.releaseReservation(ctx, gs, reservationCanceled); err != nil {
+		writeAllocationError(w, s.logger, patchErrorToAllocationError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// parseSessionArgs parses and validates the arguments of the requests that refer to an existing session
+// if they are not valid, it writes the error to the response and returns false
+func (s *AllocationApiServer) parseSessionArgs(w http.ResponseWriter, r *http.Request) (*SessionArgs, bool) {
+	if r.Method != http.MethodPost {
+		badRequestError(w, s.logger, errors.New("invalid method"), "Only POST is accepted")
+		return nil, false
+	}
+	var args SessionArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		badRequestError(w, s.logger, err, "cannot deserialize json")
+		return nil, false
+	}
+	if !isValidUUID(args.SessionID) {
+		badRequestError(w, s.logger, errors.New("invalid sessionID"), "invalid arguments")
+		return nil, false
+	}
+	return &args, true
+}
+
+// getGameServerForSession returns the GameServer that has the provided sessionID
+// if the call was authenticated with a token, the caller must be allowed to use the build of the GameServer
+func (s *AllocationApiServer) getGameServerForSession(ctx context.Context, sessionID string) (*mpsv1alpha1.GameServer, error) {
+	var gameServers mpsv1alpha1.GameServerList
+	if err := s.Client.List(ctx, &gameServers, client.MatchingFields{statusSessionId: sessionID}); err != nil {
+		return nil, newAllocationError(http.StatusInternalServerError, err, "error listing")
+	}
+	if len(gameServers.Items) == 0 {
+		return nil, newAllocationError(http.StatusNotFound, errors.New("GameServer not found"), fmt.Sprintf("GameServer with sessionID %s not found", sessionID))
+	}
+	// this should never happen, but just in case
+	if len(gameServers.Items) > 1 {
+		return nil, newAllocationError(http.StatusInternalServerError, errors.New("multiple servers found"), fmt.Sprintf("Multiple servers found for sessionID %s", sessionID))
+	}
+	if err := authorizeGameServer(ctx, &gameServers.Items[0]); err != nil {
+		return nil, err
+	}
+	return &gameServers.Items[0], nil
+}
+
+// confirmReservation transitions the provided Reserved GameServer to Active
+// if the GameServer is already Active, it is returned as is, so that confirmations can be safely retried
+func (s *AllocationApiServer) confirmReservation(ctx context.Context, gs *mpsv1alpha1.GameServer) (*mpsv1alpha1.GameServer, error) {
+	if gs.Status.State == mpsv1alpha1.GameServerStateActive {
+		return gs, nil
+	}
+	if gs.Status.State != mpsv1alpha1.GameServerStateReserved {
+		return nil, newAllocationError(http.StatusConflict, fmt.Errorf("GameServer is %s", gs.Status.State), fmt.Sprintf("session %s is not reserved", gs.Status.SessionID))
+	}
+	if gs.Status.ReservedUntil != nil && !time.Now().Before(gs.Status.ReservedUntil.Time) {
+		return nil, newAllocationError(http.StatusNotFound, errors.New("reservation expired"), fmt.Sprintf("reservation for session %s has expired", gs.Status.SessionID))
+	}
+
+	gs2 := gs.DeepCopy()
+	// we're using optimistic lock to make sure the reservation has not been released in the meantime
+	patch := client.MergeFromWithOptions(gs.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	gs2.Status.State = mpsv1alpha1.GameServerStateActive
+	now := metav1.Now()
+	gs2.Status.ReachedActiveOn = &now
+	gs2.Status.ReservedUntil = nil
+	if err := s.Client.Status().Patch(ctx, gs2, patch); err != nil {
+		return nil, patchErrorToAllocationError(err)
+	}
+
+	s.gameServerQueue.UpdateNodeUtilization(gs2.Namespace, gs2.Name, gs2.Status.NodeName, s.getNodeZone(ctx, gs2.Status.NodeName), true)
+	s.logger.Info("Confirmed GameServer reservation", "name", gs2.Name, "sessionID", gs2.Status.SessionID, "buildID", gs2.Spec.BuildID)
+	AllocationsCounter.WithLabelValues(gs2.Labels[LabelBuildName]).Inc()
+	ReservationsConfirmedCounter.WithLabelValues(gs2.Labels[LabelBuildName]).Inc()
+	s.eventSink.Emit(LifecycleEventAllocated, gs2)
+	return gs2, nil
+}
+
+// releaseReservation returns the provided Reserved GameServer to StandingBy, clearing its session details
+// the GameServer is put back on the queue through the events channel
+func (s *AllocationApiServer) releaseReservation(ctx context.Context, gs *mpsv1alpha1.GameServer, reason string) error {
+	gs2 := gs.DeepCopy()
+	// we're using optimistic lock to make sure the reservation has not been confirmed in the meantime
+	patch := client.MergeFromWithOptions(gs.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	gs2.Status.State = mpsv1alpha1.GameServerStateStandingBy
+	now := metav1.Now()
+	gs2.Status.ReachedStandingByOn = &now
+	clearSessionDetails(&gs2.Status)
+	if err := s.Client.Status().Patch(ctx, gs2, patch); err != nil {
+		return err
+	}
+
+	s.logger.Info("Released GameServer reservation", "name", gs.Name, "sessionID", gs.Status.SessionID, "buildID", gs.Spec.BuildID, "reason", reason)
+	ReservationsReleasedCounter.WithLabelValues(gs.Labels[LabelBuildName], reason).Inc()
+	s.events <- event.GenericEvent{
+		Object: gs2,
+	}
+	return nil
+}
+
+// expireReservation releases the reservation of the provided Reserved GameServer if it has expired
+// otherwise it requeues the GameServer so it's reconciled again when the reservation expires
+func (s *AllocationApiServer) expireReservation(ctx context.Context, gs *mpsv1alpha1.GameServer) (ctrl.Result, error) {
+	if gs.Status.ReservedUntil != nil {
+		if remaining := time.Until(gs.Status.ReservedUntil.Time); remaining > 0 {
+			return ctrl.Result{RequeueAfter: remaining}, nil
+		}
+	}
+	if err := s.releaseReservation(ctx, gs, reservationExpired); err != nil {
+		// the GameServer was modified in the meantime (e.g. the reservation was confirmed), so we'll get notified again
+		if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// patchErrorToAllocationError converts an error returned when patching a GameServer to an *allocationError
+func patchErrorToAllocationError(err error) error {
+	if apierrors.IsConflict(err) {
+		return newAllocationError(http.StatusConflict, err, "GameServer was modified, please retry")
+	}
+	if apierrors.IsNotFound(err) {
+		return newAllocationError(http.StatusNotFound, err, "GameServer not found")
+	}
+	return newAllocationError(http.StatusInternalServerError, err, "error patching GameServer")
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("allocation API service reservation tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		gsName     string = "testgs"
+	)
+
+	// testReserve creates a StandingBy game server, pushes it to the queue and reserves it
+	testReserve := func(client client.Client, ttlSeconds int) *AllocationApiServer {
+		gs, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		h.gameServerQueue.PushToQueue(&GameServerForQueue{
+			Name:            gs.Name,
+			Namespace:       gs.Namespace,
+			BuildID:         buildID1,
+			ResourceVersion: gs.ResourceVersion,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/reserve", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"reservationTtlSeconds\":%d}", sessionID1, buildID1, ttlSeconds)))
+		w := httptest.NewRecorder()
+		h.handleReserveRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var rs ReserveResponse
+		Expect(json.NewDecoder(res.Body).Decode(&rs)).To(Succeed())
+		Expect(rs.SessionID).To(Equal(sessionID1))
+		Expect(rs.State).To(Equal(mpsv1alpha1.GameServerStateReserved))
+		Expect(rs.ReservedUntil).ToNot(BeNil())
+		return h
+	}
+
+	getGameServer := func(client client.Client) mpsv1alpha1.GameServer {
+		var gs mpsv1alpha1.GameServer
+		Expect(client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsName}, &gs)).To(Succeed())
+		return gs
+	}
+
+	It("reservationTtlSeconds larger than the maximum should return error", func() {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/reserve", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\",\"reservationTtlSeconds\":%d}", sessionID1, buildID1, int((maxReservationTTL+time.Second).Seconds()))))
+		w := httptest.NewRecorder()
+		h := NewAllocationApiServer(nil, nil, allocationApiSvcPort)
+		h.handleReserveRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+	It("should reserve a game server and make it Active when the reservation is confirmed", func() {
+		client := testNewSimpleK8sClient()
+		h := testReserve(client, 60)
+		gs := getGameServer(client)
+		Expect(gs.Status.State).To(Equal(mpsv1alpha1.GameServerStateReserved))
+		Expect(gs.Status.SessionID).To(Equal(sessionID1))
+		Expect(gs.Status.ReservedUntil.Time).To(BeTemporally("~", time.Now().Add(60*time.Second), 5*time.Second))
+		Expect(h.gameServerQueue.PopFromQueue(buildID1)).To(BeNil())
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/reserve/confirm", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\"}", sessionID1)))
+		w := httptest.NewRecorder()
+		h.handleConfirmReservationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		gs = getGameServer(client)
+		Expect(gs.Status.State).To(Equal(mpsv1alpha1.GameServerStateActive))
+		Expect(gs.Status.ReservedUntil).To(BeNil())
+		Expect(gs.Status.ReachedActiveOn).ToNot(BeNil())
+
+		// confirming again should succeed, so that clients can retry
+		req = httptest.NewRequest(http.MethodPost, "/api/v1/reserve/confirm", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\"}", sessionID1)))
+		w = httptest.NewRecorder()
+		h.handleConfirmReservationRequest(w, req)
+		res2 := w.Result()
+		defer res2.Body.Close()
+		Expect(res2.StatusCode).To(Equal(http.StatusOK))
+	})
+	It("should confirm the reservation when allocating a reserved session", func() {
+		client := testNewSimpleK8sClient()
+		h := testReserve(client, 60)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\",\"buildID\":\"%s\"}", sessionID1, buildID1)))
+		w := httptest.NewRecorder()
+		h.handleAllocationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		Expect(getGameServer(client).Status.State).To(Equal(mpsv1alpha1.GameServerStateActive))
+	})
+	It("should return the game server to StandingBy when the reservation is canceled", func() {
+		client := testNewSimpleK8sClient()
+		h := testReserve(client, 60)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/reserve/cancel", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\"}", sessionID1)))
+		w := httptest.NewRecorder()
+		h.handleCancelReservationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		gs := getGameServer(client)
+		Expect(gs.Status.State).To(Equal(mpsv1alpha1.GameServerStateStandingBy))
+		Expect(gs.Status.SessionID).To(BeEmpty())
+		Expect(gs.Status.ReservedUntil).To(BeNil())
+		// the game server should be re-enqueued through the events channel
+		Expect(h.events).To(HaveLen(1))
+
+		// the reservation no longer exists
+		req = httptest.NewRequest(http.MethodPost, "/api/v1/reserve/confirm", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\"}", sessionID1)))
+		w = httptest.NewRecorder()
+		h.handleConfirmReservationRequest(w, req)
+		res2 := w.Result()
+		defer res2.Body.Close()
+		Expect(res2.StatusCode).To(Equal(http.StatusNotFound))
+	})
+	It("should return conflict when canceling a session that is not reserved", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/reserve/cancel", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\"}", sessionID1)))
+		w := httptest.NewRecorder()
+		h.handleCancelReservationRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusConflict))
+		Expect(getGameServer(client).Status.State).To(Equal(mpsv1alpha1.GameServerStateActive))
+	})
+	It("should requeue a reservation that has not expired", func() {
+		client := testNewSimpleK8sClient()
+		h := testReserve(client, 60)
+		gs := getGameServer(client)
+		result, err := h.expireReservation(context.Background(), &gs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 50*time.Second))
+		Expect(getGameServer(client).Status.State).To(Equal(mpsv1alpha1.GameServerStateReserved))
+		Expect(h.events).To(BeEmpty())
+	})
+	It("should return the game server to StandingBy when the reservation expires", func() {
+		cl := testNewSimpleK8sClient()
+		h := testReserve(cl, 60)
+		gs := getGameServer(cl)
+		patch := client.MergeFrom(gs.DeepCopy())
+		expired := metav1.NewTime(time.Now().Add(-time.Second))
+		gs.Status.ReservedUntil = &expired
+		Expect(cl.Status().Patch(context.Background(), &gs, patch)).To(Succeed())
+
+		result, err := h.expireReservation(context.Background(), &gs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		gs = getGameServer(cl)
+		Expect(gs.Status.State).To(Equal(mpsv1alpha1.GameServerStateStandingBy))
+		Expect(gs.Status.SessionID).To(BeEmpty())
+		Expect(h.events).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+// SessionDetails contains the details of a game session and the GameServer that hosts it
+type SessionDetails struct {
+	SessionID             string
+	BuildID               string
+	BuildName             string
+	GameServerName        string
+	Namespace             string
+	State                 mpsv1alpha1.GameServerState
+	Health                mpsv1alpha1.GameServerHealth
+	IPV4Address           string
+	Ports                 string
+	NodeName              string
+	ReachedActiveOn       *metav1.Time `json:",omitempty"`
+	ReservedUntil         *metav1.Time `json:",omitempty"`
+	ConnectedPlayersCount int
+	ConnectedPlayers      []string
+}
+
+// ListSessionsResponse contains the sessions that match the filters of a list sessions call
+type ListSessionsResponse struct {
+	Sessions []SessionDetails
+}
+
+// handleGetSessionRequest returns the details of the session with the sessionID that is provided in the path
+func (s *AllocationApiServer) handleGetSessionRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		badRequestError(w, s.logger, errors.New("invalid method"), "Only GET is accepted")
+		return
+	}
+
+	sessionID := r.PathValue("sessionID")
+	if !isValidUUID(sessionID) {
+		badRequestError(w, s.logger, errors.New("invalid sessionID"), "invalid arguments")
+		return
+	}
+
+	gs, err := s.getGameServerForSession(ctx, sessionID)
+	if err != nil {
+		writeAllocationError(w, s.logger, err)
+		return
+	}
+	gsd, err := s.getGameServerDetail(ctx, gs)
+	if err != nil {
+		internalServerError(w, s.logger, err, "error getting GameServerDetail")
+		return
+	}
+	if err := json.NewEncoder(w).Encode(newSessionDetails(gs, gsd)); err != nil {
+		internalServerError(w, s.logger, err, "encode json response")
+	}
+}
+
+// handleListSessionsRequest returns the details of all sessions, optionally filtered by the buildID, namespace, state and nodeName query parameters
+func (s *AllocationApiServer) handleListSessionsRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		badRequestError(w, s.logger, errors.New("invalid method"), "Only GET is accepted")
+		return
+	}
+
+	query := r.URL.Query()
+	buildID, namespace := query.Get("buildID"), query.Get("namespace")
+	state, nodeName := mpsv1alpha1.GameServerState(query.Get("state")), query.Get("nodeName")
+	if buildID != "" && !isValidUUID(buildID) {
+		badRequestError(w, s.logger, errors.New("invalid buildID"), "invalid arguments")
+		return
+	}
+
+	var listOptions []client.ListOption
+	if namespace != "" {
+		listOptions = append(listOptions, client.InNamespace(namespace))
+	}
+	// GameServerDetails are only labeled with the BuildName, so we filter them by BuildID through their GameServers
+	var gameServerDetails mpsv1alpha1.GameServerDetailList
+	if err := s.Client.List(ctx, &gameServerDetails, listOptions...); err != nil {
+		internalServerError(w, s.logger, err, "error listing")
+		return
+	}
+	if buildID != "" {
+		listOptions = append(listOptions, client.MatchingLabels{LabelBuildID: buildID})
+	}
+	var gameServers mpsv1alpha1.GameServerList
+	if err := s.Client.List(ctx, &gameServers, listOptions...); err != nil {
+		internalServerError(w, s.logger, err, "error listing")
+		return
+	}
+	// GameServerDetails have the same name and namespace as their GameServers
+	gameServerDetailsMap := make(map[types.NamespacedName]*mpsv1alpha1.GameServerDetail, len(gameServerDetails.Items))
+	for i := range gameServerDetails.Items {
+		gsd := &gameServerDetails.Items[i]
+		gameServerDetailsMap[types.NamespacedName{Namespace: gsd.Namespace, Name: gsd.Name}] = gsd
+	}
+
+	// callers that were authenticated with a token only see the sessions of the builds they are allowed to use
+	claims := callerClaimsFromContext(ctx)
+	sessions := make([]SessionDetails, 0)
+	for i := range gameServers.Items {
+		gs := &gameServers.Items[i]
+		if gs.Status.SessionID == "" {
+			continue
+		}
+		if claims != nil {
+			if _, err := claims.authorize(gs.Labels[LabelBuildID], gs.Spec.TitleID); err != nil {
+				continue
+			}
+		}
+		if state != "" && gs.Status.State != state {
+			continue
+		}
+		if nodeName != "" && gs.Status.NodeName != nodeName {
+			continue
+		}
+		sessions = append(sessions, newSessionDetails(gs, gameServerDetailsMap[types.NamespacedName{Namespace: gs.Namespace, Name: gs.Name}]))
+	}
+	// the order of the cache is not deterministic, so we sort the sessions
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].SessionID < sessions[j].SessionID
+	})
+
+	if err := json.NewEncoder(w).Encode(ListSessionsResponse{Sessions: sessions}); err != nil {
+		internalServerError(w, s.logger, err, "encode json response")
+	}
+}
+
+// getGameServerDetail returns the GameServerDetail of the provided GameServer
+// it returns nil if the GameServerDetail does not exist, e.g. if the NodeAgent has not created it yet
+func (s *AllocationApiServer) getGameServerDetail(ctx context.Context, gs *mpsv1alpha1.GameServer) (*mpsv1alpha1.GameServerDetail, error) {
+	var gsd mpsv1alpha1.GameServerDetail
+	if err := s.Client.Get(ctx, types.NamespacedName{Namespace: gs.Namespace, Name: gs.Name}, &gsd); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &gsd, nil
+}
+
+// newSessionDetails returns the SessionDetails for the provided GameServer and its GameServerDetail, which can be nil
+func newSessionDetails(gs *mpsv1alpha1.GameServer, gsd *mpsv1alpha1.GameServerDetail) SessionDetails {
+	sd := SessionDetails{
+		SessionID:       gs.Status.SessionID,
+		BuildID:         gs.Spec.BuildID,
+		BuildName:       gs.Labels[LabelBuildName],
+		GameServerName:  gs.Name,
+		Namespace:       gs.Namespace,
+		State:           gs.Status.State,
+		Health:          gs.Status.Health,
+		IPV4Address:     gs.Status.PublicIP,
+		Ports:           gs.Status.Ports,
+		NodeName:        gs.Status.NodeName,
+		ReachedActiveOn: gs.Status.ReachedActiveOn,
+		ReservedUntil:   gs.Status.ReservedUntil,
+	}
+	if gsd != nil {
+		sd.ConnectedPlayersCount = gsd.Spec.ConnectedPlayersCount
+		sd.ConnectedPlayers = gsd.Spec.ConnectedPlayers
+	}
+	return sd
+}
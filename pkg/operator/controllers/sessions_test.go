@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("allocation API service sessions tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		sessionID2 string = "7b8e4f2a-3c1d-4e5f-9a6b-0c1d2e3f4a5b"
+		gsName     string = "testgs"
+	)
+
+	It("should return bad request for an invalid sessionID", func() {
+		h := NewAllocationApiServer(nil, nil, allocationApiSvcPort)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions/notAGuid", nil)
+		req.SetPathValue("sessionID", "notAGuid")
+		w := httptest.NewRecorder()
+		h.handleGetSessionRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+	It("should return the details of a session along with its connected players", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.Create(context.Background(), &mpsv1alpha1.GameServerDetail{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      gsName,
+				Namespace: "default",
+			},
+			Spec: mpsv1alpha1.GameServerDetailSpec{
+				ConnectedPlayersCount: 2,
+				ConnectedPlayers:      []string{"player1", "player2"},
+			},
+		})).To(Succeed())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/sessions/%s", sessionID1), nil)
+		req.SetPathValue("sessionID", sessionID1)
+		w := httptest.NewRecorder()
+		h.handleGetSessionRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var sd SessionDetails
+		Expect(json.NewDecoder(res.Body).Decode(&sd)).To(Succeed())
+		Expect(sd.SessionID).To(Equal(sessionID1))
+		Expect(sd.GameServerName).To(Equal(gsName))
+		Expect(sd.BuildName).To(Equal(buildName1))
+		Expect(sd.State).To(Equal(mpsv1alpha1.GameServerStateActive))
+		Expect(sd.ConnectedPlayersCount).To(Equal(2))
+		Expect(sd.ConnectedPlayers).To(ConsistOf("player1", "player2"))
+	})
+	It("should return not found for a session that does not exist", func() {
+		client := testNewSimpleK8sClient()
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/sessions/%s", sessionID1), nil)
+		req.SetPathValue("sessionID", sessionID1)
+		w := httptest.NewRecorder()
+		h.handleGetSessionRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+	})
+	It("should list the sessions that match the filters", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = testCreateGameServer(client, gsName+"2", buildName1, buildID1, sessionID2, mpsv1alpha1.GameServerStateReserved)
+		Expect(err).ToNot(HaveOccurred())
+		// game servers without a session are not returned
+		_, err = testCreateGameServer(client, gsName+"3", buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+
+		listSessions := func(query string) []SessionDetails {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions"+query, nil)
+			w := httptest.NewRecorder()
+			h.handleListSessionsRequest(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusOK))
+			var rs ListSessionsResponse
+			Expect(json.NewDecoder(res.Body).Decode(&rs)).To(Succeed())
+			return rs.Sessions
+		}
+
+		Expect(listSessions("")).To(HaveLen(2))
+		Expect(listSessions("?buildID=" + buildID1)).To(HaveLen(2))
+		sessions := listSessions("?state=Reserved")
+		Expect(sessions).To(HaveLen(1))
+		Expect(sessions[0].SessionID).To(Equal(sessionID2))
+		Expect(listSessions("?buildID=" + sessionID1)).To(BeEmpty())
+	})
+})
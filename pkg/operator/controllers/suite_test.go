@@ -122,7 +122,8 @@ var _ = BeforeSuite(func() {
 			return "testNodeName", "testPublicIP", 0, nil
 		},
 		initContainerImageLinux,
-		initContainerImageWin).SetupWithManager(k8sManager)
+		initContainerImageWin,
+		5*time.Second).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
 	// allocation api service is a controller, so add it to the manager
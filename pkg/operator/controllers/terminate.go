@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+// handleTerminateRequest marks the GameServer of a session for termination
+// the NodeAgent will signal the game server process to terminate and the GameServer will be deleted if the process does not exit within the grace period
+func (s *AllocationApiServer) handleTerminateRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	args, ok := s.parseSessionArgs(w, r)
+	if !ok {
+		return
+	}
+
+	gs, err := s.getGameServerForSession(ctx, args.SessionID)
+	if err != nil {
+		writeAllocationError(w, s.logger, err)
+		return
+	}
+	// the GameServer is already marked for termination, we return success so that clients can retry
+	if gs.Status.TerminationRequestedOn != nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	patch := client.MergeFromWithOptions(gs.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	now := metav1.Now()
+	gs.Status.TerminationRequestedOn = &now
+	if err := s.Client.Status().Patch(ctx, gs, patch); err != nil {
+		writeAllocationError(w, s.logger, patchErrorToAllocationError(err))
+		return
+	}
+	s.gameServerQueue.RemoveFromQueue(gs.Namespace, gs.Name)
+	s.logger.Info("Marked GameServer for termination", "name", gs.Name, "sessionID", gs.Status.SessionID, "buildID", gs.Spec.BuildID)
+	GameServersTerminationRequestedCounter.WithLabelValues(gs.Labels[LabelBuildName]).Inc()
+	w.WriteHeader(http.StatusOK)
+}
+
+// terminateIfGracePeriodExpired deletes a GameServer that was marked for termination if its process has not exited within the termination grace period
+// if the grace period has not expired yet, the GameServer is requeued for when it does
+func (r *GameServerReconciler) terminateIfGracePeriodExpired(ctx context.Context, gs *mpsv1alpha1.GameServer) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	deadline := gs.Status.TerminationRequestedOn.Add(r.TerminationGracePeriod)
+	if remaining := time.Until(deadline); remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+	if err := r.Delete(ctx, gs); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	log.Info("Deleted GameServer since its process did not exit within the termination grace period", "gracePeriod", r.TerminationGracePeriod)
+	GameServersForceTerminatedCounter.WithLabelValues(gs.Labels[LabelBuildName]).Inc()
+	r.Recorder.Eventf(gs, corev1.EventTypeWarning, "ForceTerminated", "GameServer %s was deleted since its process did not exit within %s of the termination request", gs.Name, r.TerminationGracePeriod)
+	return ctrl.Result{}, nil
+}
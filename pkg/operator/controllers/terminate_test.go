@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("allocation API service terminate tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		gsName     string = "testgs"
+	)
+
+	It("should mark the game server of a session for termination", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		for i := 0; i < 2; i++ {
+			// marking the game server again should succeed, so that clients can retry
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/terminate", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\"}", sessionID1)))
+			w := httptest.NewRecorder()
+			h.handleTerminateRequest(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusOK))
+		}
+
+		var gs mpsv1alpha1.GameServer
+		Expect(client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsName}, &gs)).To(Succeed())
+		Expect(gs.Status.State).To(Equal(mpsv1alpha1.GameServerStateActive))
+		Expect(gs.Status.TerminationRequestedOn).ToNot(BeNil())
+	})
+	It("should return not found when terminating a session that does not exist", func() {
+		client := testNewSimpleK8sClient()
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/terminate", bytes.NewBufferString(fmt.Sprintf("{\"sessionID\":\"%s\"}", sessionID1)))
+		w := httptest.NewRecorder()
+		h.handleTerminateRequest(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+	})
+	It("should not put a game server that is marked for termination on the queue", func() {
+		cl := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(cl, gsName, buildName1, buildID1, "", mpsv1alpha1.GameServerStateStandingBy)
+		Expect(err).ToNot(HaveOccurred())
+		gs.Spec.BuildID = buildID1
+		Expect(cl.Update(context.Background(), gs)).To(Succeed())
+		patch := client.MergeFrom(gs.DeepCopy())
+		now := metav1.Now()
+		gs.Status.TerminationRequestedOn = &now
+		Expect(cl.Status().Patch(context.Background(), gs, patch)).To(Succeed())
+
+		h := NewAllocationApiServer(nil, cl, allocationApiSvcPort)
+		h.gameServerQueue = NewGameServersQueue()
+		_, err = h.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: gsName}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(h.gameServerQueue.PopFromQueue(buildID1)).To(BeNil())
+	})
+	It("should delete the game server once the termination grace period has expired", func() {
+		cl := testNewSimpleK8sClient()
+		gs, err := testCreateGameServerAndBuild(cl, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		patch := client.MergeFrom(gs.DeepCopy())
+		requestedOn := metav1.NewTime(time.Now().Add(-10 * time.Second))
+		gs.Status.TerminationRequestedOn = &requestedOn
+		Expect(cl.Status().Patch(context.Background(), gs, patch)).To(Succeed())
+
+		r := &GameServerReconciler{
+			Client:                 cl,
+			Recorder:               record.NewFakeRecorder(10),
+			TerminationGracePeriod: time.Minute,
+		}
+		// the grace period has not expired yet
+		result, err := r.terminateIfGracePeriodExpired(context.Background(), gs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", 50*time.Second, 5*time.Second))
+		Expect(cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsName}, gs)).To(Succeed())
+
+		r.TerminationGracePeriod = 5 * time.Second
+		result, err = r.terminateIfGracePeriodExpired(context.Background(), gs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		err = cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: gsName}, gs)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -99,6 +99,15 @@ func testUpdateGameServerBuild(ctx context.Context, standingBy, max int, buildNa
 	}, timeout, interval).Should(Succeed())
 }
 
+// testUpdateGameServerBuildMode updates the GameServerBuild with the requested mode
+func testUpdateGameServerBuildMode(ctx context.Context, mode mpsv1alpha1.GameServerBuildMode, buildName string) {
+	Eventually(func() error {
+		gsb := getGameServerBuild(ctx, buildName)
+		gsb.Spec.Mode = mode
+		return testk8sClient.Update(ctx, &gsb)
+	}, timeout, interval).Should(Succeed())
+}
+
 // testWaitAndVerifyTotalGameServerCount verifies the total number of game servers
 // useful to wait for the GameServers to be created, so we can update their status
 func testWaitAndVerifyTotalGameServerCount(ctx context.Context, buildID string, total int) {
@@ -180,6 +189,20 @@ func testUpdateGameServersState(ctx context.Context, buildID string, oldState, n
 	}
 }
 
+// testGetGameServerNamesByState returns the names of the GameServers in the given GameServerBuild with the given state
+func testGetGameServerNamesByState(ctx context.Context, buildID string, state mpsv1alpha1.GameServerState) []string {
+	var gameServers mpsv1alpha1.GameServerList
+	err := testk8sClient.List(ctx, &gameServers, client.InNamespace(testnamespace), client.MatchingLabels{LabelBuildID: buildID})
+	Expect(err).ToNot(HaveOccurred())
+	var names []string
+	for _, gameServer := range gameServers.Items {
+		if gameServer.Status.State == state {
+			names = append(names, gameServer.Name)
+		}
+	}
+	return names
+}
+
 // testGenerateGameServerBuild creates a GameServerBuild with the given name and ID.
 func testGenerateGameServerBuild(buildName, buildNamespace, buildID string, standingBy, max int, hostNetwork bool) mpsv1alpha1.GameServerBuild {
 	return mpsv1alpha1.GameServerBuild{
@@ -251,12 +274,18 @@ func testGenerateGameServer(buildName, buildID, gsNamespace, gsName string) *mps
 // testNewSimpleK8sClient returns a new fake k8s client
 func testNewSimpleK8sClient() client.Client {
 	cb := fake.NewClientBuilder()
-	return cb.WithStatusSubresource(&mpsv1alpha1.GameServer{}).WithIndex(&mpsv1alpha1.GameServer{}, statusSessionId, func(rawObj client.Object) []string {
+	return cb.WithStatusSubresource(&mpsv1alpha1.GameServer{}, &mpsv1alpha1.GameServerAllocation{}).WithIndex(&mpsv1alpha1.GameServer{}, statusSessionId, func(rawObj client.Object) []string {
 		gs := rawObj.(*mpsv1alpha1.GameServer)
 		return []string{gs.Status.SessionID}
 	}).WithIndex(&mpsv1alpha1.GameServerBuild{}, specBuildId, func(rawObj client.Object) []string {
 		gsb := rawObj.(*mpsv1alpha1.GameServerBuild)
 		return []string{gsb.Spec.BuildID}
+	}).WithIndex(&mpsv1alpha1.BuildAlias{}, specAliasId, func(rawObj client.Object) []string {
+		ba := rawObj.(*mpsv1alpha1.BuildAlias)
+		return []string{ba.Spec.AliasID}
+	}).WithIndex(&mpsv1alpha1.GameServer{}, specTitleId, func(rawObj client.Object) []string {
+		gs := rawObj.(*mpsv1alpha1.GameServer)
+		return []string{gs.Spec.TitleID}
 	}).Build()
 }
 
@@ -276,10 +305,15 @@ func testCreateGameServerAndBuild(client client.Client, gameServerName, buildNam
 	if err != nil {
 		return nil, err
 	}
+	return testCreateGameServer(client, gameServerName, buildName, buildID, sessionID, state)
+}
+
+// testCreateGameServer creates a GameServer with the given name that belongs to the GameServerBuild with the given name and ID.
+func testCreateGameServer(client client.Client, gameServerName, buildName, buildID, sessionID string, state mpsv1alpha1.GameServerState) (*mpsv1alpha1.GameServer, error) {
 	gs := mpsv1alpha1.GameServer{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      gameServerName,
-			Namespace: buildNamespace,
+			Namespace: "default",
 			Labels: map[string]string{
 				LabelBuildID:   buildID,
 				LabelBuildName: buildName,
@@ -290,7 +324,7 @@ func testCreateGameServerAndBuild(client client.Client, gameServerName, buildNam
 			State:     state,
 		},
 	}
-	err = client.Create(context.Background(), &gs)
+	err := client.Create(context.Background(), &gs)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,327 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+)
+
+const (
+	// defaultTokenAuthPollInterval is how often the TokenAuthenticator reloads the API keys Secret and the JWKS file
+	defaultTokenAuthPollInterval = 30 * time.Second
+	// jwtLeeway is the clock skew that is tolerated when validating the time claims of a JWT
+	jwtLeeway = 30 * time.Second
+)
+
+// reasons for denied calls, used as the Reason label of AllocationsAuthDeniedCounter
+const (
+	authDeniedReasonMissingToken   = "MissingToken"
+	authDeniedReasonInvalidToken   = "InvalidToken"
+	authDeniedReasonForbiddenBuild = "ForbiddenBuild"
+	authDeniedReasonForbiddenTitle = "ForbiddenTitle"
+)
+
+// jwtSignatureAlgorithms are the signature algorithms that are accepted for JWTs
+var jwtSignatureAlgorithms = []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512, jose.ES256, jose.ES384, jose.ES512, jose.EdDSA}
+
+// CallerClaims contains the identity of an authenticated caller and the TitleIDs and BuildIDs it is allowed to use
+// an empty list of TitleIDs or BuildIDs means that the caller is not restricted on it
+type CallerClaims struct {
+	// Subject identifies the caller, it is the name of the API key or the subject of the JWT
+	Subject  string   `json:"-"`
+	TitleIDs []string `json:"titleIDs,omitempty"`
+	BuildIDs []string `json:"buildIDs,omitempty"`
+}
+
+// apiKeyEntry is the format of the values of the API keys Secret, the key of each entry is the name of the caller
+type apiKeyEntry struct {
+	Key string `json:"key"`
+	CallerClaims
+}
+
+// callerClaimsContextKey is the key of the CallerClaims in the request context
+type callerClaimsContextKey struct{}
+
+// withCallerClaims returns a copy of the context that carries the provided CallerClaims
+func withCallerClaims(ctx context.Context, claims *CallerClaims) context.Context {
+	return context.WithValue(ctx, callerClaimsContextKey{}, claims)
+}
+
+// callerClaimsFromContext returns the CallerClaims of the context, or nil if the call was not authenticated with a token
+func callerClaimsFromContext(ctx context.Context) *CallerClaims {
+	claims, _ := ctx.Value(callerClaimsContextKey{}).(*CallerClaims)
+	return claims
+}
+
+// authorize returns an error with status code 403, along with the reason, if the caller is not allowed to use the provided build
+func (c *CallerClaims) authorize(buildID, titleID string) (string, error) {
+	if len(c.BuildIDs) > 0 && !slices.Contains(c.BuildIDs, buildID) {
+		return authDeniedReasonForbiddenBuild, newAllocationError(http.StatusForbidden, errors.New("forbidden build"), fmt.Sprintf("caller %s is not allowed to use build %s", c.Subject, buildID))
+	}
+	if len(c.TitleIDs) > 0 && !slices.Contains(c.TitleIDs, titleID) {
+		return authDeniedReasonForbiddenTitle, newAllocationError(http.StatusForbidden, errors.New("forbidden title"), fmt.Sprintf("caller %s is not allowed to use title %s", c.Subject, titleID))
+	}
+	return "", nil
+}
+
+// TokenAuthenticator authenticates calls to the allocation API service using bearer tokens
+// a token can either be a static API key, read from a Kubernetes Secret, or a JWT, whose signature is checked against a local JWKS file
+// TokenAuthenticator implements the manager.Runnable interface so it can be added to the controller manager, it periodically reloads the API keys and the JWKS
+type TokenAuthenticator struct {
+	mu sync.RWMutex
+	// apiKeys contains the claims of the API keys, by the SHA256 hash of the key
+	apiKeys map[[sha256.Size]byte]*CallerClaims
+	jwks    *jose.JSONWebKeySet
+	// reader is used to get the API keys Secret, we're using a live client so that we don't need to watch Secrets
+	reader          client.Reader
+	secretName      string
+	secretNamespace string
+	jwksPath        string
+	issuer          string
+	audience        string
+	pollInterval    time.Duration
+	logger          logr.Logger
+}
+
+// NewTokenAuthenticator returns a new TokenAuthenticator
+// API keys are read from the provided Secret, if secretName is not empty, and JWTs are validated against the provided JWKS file, if jwksPath is not empty
+// if issuer or audience are not empty, JWTs must contain the respective claims
+func NewTokenAuthenticator(reader client.Reader, secretNamespace, secretName, jwksPath, issuer, audience string) *TokenAuthenticator {
+	return &TokenAuthenticator{
+		reader:          reader,
+		secretName:      secretName,
+		secretNamespace: secretNamespace,
+		jwksPath:        jwksPath,
+		issuer:          issuer,
+		audience:        audience,
+		pollInterval:    defaultTokenAuthPollInterval,
+		logger:          log.Log.WithName("token-auth"),
+	}
+}
+
+// Load reads the API keys Secret and the JWKS file
+func (ta *TokenAuthenticator) Load(ctx context.Context) error {
+	if ta.secretName == "" && ta.jwksPath == "" {
+		return errors.New("neither an API keys Secret nor a JWKS file is configured")
+	}
+	var apiKeys map[[sha256.Size]byte]*CallerClaims
+	if ta.secretName != "" {
+		var err error
+		if apiKeys, err = ta.loadApiKeys(ctx); err != nil {
+			return err
+		}
+	}
+	var jwks *jose.JSONWebKeySet
+	if ta.jwksPath != "" {
+		b, err := os.ReadFile(ta.jwksPath)
+		if err != nil {
+			return fmt.Errorf("reading JWKS file %s: %w", ta.jwksPath, err)
+		}
+		jwks = &jose.JSONWebKeySet{}
+		if err := json.Unmarshal(b, jwks); err != nil {
+			return fmt.Errorf("parsing JWKS file %s: %w", ta.jwksPath, err)
+		}
+	}
+
+	ta.mu.Lock()
+	ta.apiKeys = apiKeys
+	ta.jwks = jwks
+	ta.mu.Unlock()
+	return nil
+}
+
+// loadApiKeys reads the API keys from the Secret
+// every entry of the Secret is a JSON document with the key and the TitleIDs and BuildIDs it can use, the name of the entry is the name of the caller
+func (ta *TokenAuthenticator) loadApiKeys(ctx context.Context) (map[[sha256.Size]byte]*CallerClaims, error) {
+	var secret corev1.Secret
+	if err := ta.reader.Get(ctx, types.NamespacedName{Namespace: ta.secretNamespace, Name: ta.secretName}, &secret); err != nil {
+		return nil, fmt.Errorf("getting API keys Secret %s/%s: %w", ta.secretNamespace, ta.secretName, err)
+	}
+	apiKeys := make(map[[sha256.Size]byte]*CallerClaims, len(secret.Data))
+	for name, value := range secret.Data {
+		var entry apiKeyEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return nil, fmt.Errorf("parsing API key %s: %w", name, err)
+		}
+		if entry.Key == "" {
+			return nil, fmt.Errorf("API key %s is empty", name)
+		}
+		claims := entry.CallerClaims
+		claims.Subject = name
+		apiKeys[sha256.Sum256([]byte(entry.Key))] = &claims
+	}
+	return apiKeys, nil
+}
+
+// Start implements the manager.Runnable interface
+// it periodically reloads the API keys and the JWKS, keeping the previous ones if reloading fails
+func (ta *TokenAuthenticator) Start(ctx context.Context) error {
+	ta.logger.Info("starting token authenticator", "secretName", ta.secretName, "jwksPath", ta.jwksPath, "pollInterval", ta.pollInterval)
+	ticker := time.NewTicker(ta.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			ta.logger.Info("stopping token authenticator")
+			return nil
+		case <-ticker.C:
+			if err := ta.Load(ctx); err != nil {
+				ta.logger.Error(err, "failed to reload API keys or JWKS, keeping the previous ones")
+			}
+		}
+	}
+}
+
+// Authenticate returns the CallerClaims of the provided token
+// tokens that have the compact JWS format are validated as JWTs, every other token is looked up in the API keys
+func (ta *TokenAuthenticator) Authenticate(token string) (*CallerClaims, error) {
+	ta.mu.RLock()
+	apiKeys, jwks := ta.apiKeys, ta.jwks
+	ta.mu.RUnlock()
+
+	if strings.Count(token, ".") != 2 {
+		// we're looking up the hash of the key, so that the lookup time does not depend on the key
+		if claims, ok := apiKeys[sha256.Sum256([]byte(token))]; ok {
+			return claims, nil
+		}
+		return nil, errors.New("unknown API key")
+	}
+
+	if jwks == nil {
+		return nil, errors.New("JWT authentication is not configured")
+	}
+	tok, err := jwt.ParseSigned(token, jwtSignatureAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("parsing JWT: %w", err)
+	}
+	var standardClaims jwt.Claims
+	var claims CallerClaims
+	if err := tok.Claims(jwks, &standardClaims, &claims); err != nil {
+		return nil, fmt.Errorf("verifying JWT: %w", err)
+	}
+	if standardClaims.Expiry == nil {
+		return nil, errors.New("JWT does not expire")
+	}
+	expected := jwt.Expected{Issuer: ta.issuer, Time: time.Now()}
+	if ta.audience != "" {
+		expected.AnyAudience = jwt.Audience{ta.audience}
+	}
+	if err := standardClaims.ValidateWithLeeway(expected, jwtLeeway); err != nil {
+		return nil, fmt.Errorf("validating JWT: %w", err)
+	}
+	claims.Subject = standardClaims.Subject
+	return &claims, nil
+}
+
+// authenticateAuthorizationHeader returns the CallerClaims for the value of an Authorization header, which must contain a bearer token
+// it increments AllocationsAuthDeniedCounter if the call is not authenticated
+func (ta *TokenAuthenticator) authenticateAuthorizationHeader(header string) (*CallerClaims, error) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		AllocationsAuthDeniedCounter.WithLabelValues(authDeniedReasonMissingToken).Inc()
+		return nil, errors.New("missing bearer token")
+	}
+	claims, err := ta.Authenticate(token)
+	if err != nil {
+		AllocationsAuthDeniedCounter.WithLabelValues(authDeniedReasonInvalidToken).Inc()
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Middleware returns a handler that authenticates calls before passing them to the provided handler
+// the CallerClaims of authenticated calls are added to the request context
+func (ta *TokenAuthenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := ta.authenticateAuthorizationHeader(r.Header.Get("Authorization"))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			unauthorizedError(w, ta.logger, err, "authentication failed")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withCallerClaims(r.Context(), claims)))
+	})
+}
+
+// authorizeBuilds returns the BuildIDs that the caller of the context is allowed to allocate from, keeping their order
+// it returns an error with status code 403 if the caller is not allowed to use any of them, or 404 if none of them exists
+func (s *AllocationApiServer) authorizeBuilds(ctx context.Context, buildIDs []string) ([]string, error) {
+	claims := callerClaimsFromContext(ctx)
+	if claims == nil {
+		return buildIDs, nil
+	}
+	allowed := make([]string, 0, len(buildIDs))
+	var reason string
+	var err, notFoundErr error
+	for _, buildID := range buildIDs {
+		var titleID string
+		if len(claims.TitleIDs) > 0 {
+			var titleErr error
+			if titleID, titleErr = s.getTitleIDForBuild(ctx, buildID); titleErr != nil {
+				if getAllocationErrorStatusCode(titleErr) != http.StatusNotFound {
+					return nil, titleErr
+				}
+				// a BuildAlias can point to a GameServerBuild that was deleted, it is not authorized
+				notFoundErr = titleErr
+				continue
+			}
+		}
+		if reason, err = claims.authorize(buildID, titleID); err != nil {
+			continue
+		}
+		allowed = append(allowed, buildID)
+	}
+	// none of the builds exists
+	if len(allowed) == 0 && err == nil && notFoundErr != nil {
+		return nil, notFoundErr
+	}
+	// for a BuildAlias, the call is only denied if the caller cannot use any of its builds
+	if len(allowed) == 0 {
+		AllocationsAuthDeniedCounter.WithLabelValues(reason).Inc()
+		return nil, err
+	}
+	return allowed, nil
+}
+
+// authorizeGameServer returns an error with status code 403 if the caller of the context is not allowed to use the build of the provided GameServer
+func authorizeGameServer(ctx context.Context, gs *mpsv1alpha1.GameServer) error {
+	claims := callerClaimsFromContext(ctx)
+	if claims == nil {
+		return nil
+	}
+	reason, err := claims.authorize(gs.Labels[LabelBuildID], gs.Spec.TitleID)
+	if err != nil {
+		AllocationsAuthDeniedCounter.WithLabelValues(reason).Inc()
+	}
+	return err
+}
+
+// getTitleIDForBuild returns the TitleID of the GameServerBuild with the provided BuildID
+func (s *AllocationApiServer) getTitleIDForBuild(ctx context.Context, buildID string) (string, error) {
+	var gameServerBuilds mpsv1alpha1.GameServerBuildList
+	if err := s.Client.List(ctx, &gameServerBuilds, client.MatchingFields{specBuildId: buildID}); err != nil {
+		return "", newAllocationError(http.StatusInternalServerError, err, "error listing")
+	}
+	if len(gameServerBuilds.Items) == 0 {
+		return "", newAllocationError(http.StatusNotFound, errors.New("GameServerBuild not found"), fmt.Sprintf("GameServerBuild with ID %s not found", buildID))
+	}
+	return gameServerBuilds.Items[0].Spec.TitleID, nil
+}
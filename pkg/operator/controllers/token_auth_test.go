@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	mpsv1alpha1 "github.com/playfab/thundernetes/pkg/operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("allocation API service token auth tests", func() {
+	const (
+		buildName1 string = "testbuild"
+		buildID1   string = "acb84898-cf73-46e2-8057-314ac557d85d"
+		buildID2   string = "0d4ef7a9-5f1b-4f4e-9ba5-6a0c2b7c4d3e"
+		sessionID1 string = "d5f075a4-517b-4bf4-8123-dfa0021aa169"
+		gsName     string = "testgs"
+		apiKey     string = "s3cr3t-api-key"
+		keyID      string = "testkey"
+		issuer     string = "https://issuer.example.com"
+		audience   string = "thundernetes"
+	)
+
+	// testNewTokenAuthenticator returns a TokenAuthenticator with an API key that can only use buildID1 and a JWKS with the public part of the returned key
+	testNewTokenAuthenticator := func() (*TokenAuthenticator, *ecdsa.PrivateKey) {
+		client := testNewSimpleK8sClient()
+		Expect(client.Create(context.Background(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "api-keys",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"matchmaker": []byte(fmt.Sprintf("{\"key\":\"%s\",\"buildIDs\":[\"%s\"]}", apiKey, buildID1)),
+			},
+		})).To(Succeed())
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: keyID, Algorithm: string(jose.ES256), Use: "sig"}}})
+		Expect(err).ToNot(HaveOccurred())
+		jwksPath := filepath.Join(GinkgoT().TempDir(), "jwks.json")
+		Expect(os.WriteFile(jwksPath, jwks, 0600)).To(Succeed())
+
+		ta := NewTokenAuthenticator(client, "default", "api-keys", jwksPath, issuer, audience)
+		Expect(ta.Load(context.Background())).To(Succeed())
+		return ta, key
+	}
+
+	// testSignJWT returns a JWT with the provided claims, signed with the provided key
+	testSignJWT := func(key *ecdsa.PrivateKey, standardClaims jwt.Claims, claims CallerClaims) string {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, (&jose.SignerOptions{}).WithHeader(jose.HeaderKey("kid"), keyID))
+		Expect(err).ToNot(HaveOccurred())
+		token, err := jwt.Signed(signer).Claims(standardClaims).Claims(claims).Serialize()
+		Expect(err).ToNot(HaveOccurred())
+		return token
+	}
+
+	It("should authenticate API keys and reject unknown ones", func() {
+		ta, _ := testNewTokenAuthenticator()
+		claims, err := ta.Authenticate(apiKey)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claims.Subject).To(Equal("matchmaker"))
+		Expect(claims.BuildIDs).To(ConsistOf(buildID1))
+		_, err = ta.Authenticate("unknown")
+		Expect(err).To(HaveOccurred())
+	})
+	It("should validate the signature and the claims of JWTs", func() {
+		ta, key := testNewTokenAuthenticator()
+		now := time.Now()
+		valid := jwt.Claims{Subject: "gateway", Issuer: issuer, Audience: jwt.Audience{audience}, Expiry: jwt.NewNumericDate(now.Add(time.Hour))}
+		claims, err := ta.Authenticate(testSignJWT(key, valid, CallerClaims{TitleIDs: []string{"title1"}}))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claims.Subject).To(Equal("gateway"))
+		Expect(claims.TitleIDs).To(ConsistOf("title1"))
+
+		expired := valid
+		expired.Expiry = jwt.NewNumericDate(now.Add(-time.Hour))
+		_, err = ta.Authenticate(testSignJWT(key, expired, CallerClaims{}))
+		Expect(err).To(HaveOccurred())
+
+		wrongAudience := valid
+		wrongAudience.Audience = jwt.Audience{"someone-else"}
+		_, err = ta.Authenticate(testSignJWT(key, wrongAudience, CallerClaims{}))
+		Expect(err).To(HaveOccurred())
+
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = ta.Authenticate(testSignJWT(otherKey, valid, CallerClaims{}))
+		Expect(err).To(HaveOccurred())
+	})
+	It("should return unauthorized for calls without a valid token", func() {
+		ta, _ := testNewTokenAuthenticator()
+		h := ta.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(callerClaimsFromContext(r.Context())).ToNot(BeNil())
+			w.WriteHeader(http.StatusOK)
+		}))
+		for header, statusCode := range map[string]int{
+			"":                 http.StatusUnauthorized,
+			"Bearer unknown":   http.StatusUnauthorized,
+			apiKey:             http.StatusUnauthorized,
+			"Bearer " + apiKey: http.StatusOK,
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+			req.Header.Set("Authorization", header)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			Expect(w.Result().StatusCode).To(Equal(statusCode))
+		}
+	})
+	It("should only allow allocations on the builds and titles of the claims", func() {
+		client := testNewSimpleK8sClient()
+		_, err := testCreateGameServerAndBuild(client, gsName, buildName1, buildID1, sessionID1, mpsv1alpha1.GameServerStateActive)
+		Expect(err).ToNot(HaveOccurred())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+
+		allocate := func(claims *CallerClaims) int {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/allocate", bytes.NewBufferString(fmt.Sprintf("{\"buildID\":\"%s\",\"sessionID\":\"%s\"}", buildID1, sessionID1)))
+			req = req.WithContext(withCallerClaims(req.Context(), claims))
+			w := httptest.NewRecorder()
+			h.handleAllocationRequest(w, req)
+			return w.Result().StatusCode
+		}
+		// the session already exists, so allowed calls return it
+		Expect(allocate(&CallerClaims{BuildIDs: []string{buildID1}})).To(Equal(http.StatusOK))
+		Expect(allocate(&CallerClaims{})).To(Equal(http.StatusOK))
+		Expect(allocate(&CallerClaims{BuildIDs: []string{buildID2}})).To(Equal(http.StatusForbidden))
+		Expect(allocate(&CallerClaims{TitleIDs: []string{"title1"}})).To(Equal(http.StatusForbidden))
+
+		// sessions of other builds are neither returned nor listed
+		ctx := withCallerClaims(context.Background(), &CallerClaims{BuildIDs: []string{buildID2}})
+		_, err = h.getGameServerForSession(ctx, sessionID1)
+		Expect(getAllocationErrorStatusCode(err)).To(Equal(http.StatusForbidden))
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		h.handleListSessionsRequest(w, req)
+		var rs ListSessionsResponse
+		Expect(json.NewDecoder(w.Result().Body).Decode(&rs)).To(Succeed())
+		Expect(rs.Sessions).To(BeEmpty())
+	})
+	It("should skip the missing builds of a BuildAlias when authorizing by title", func() {
+		client := testNewSimpleK8sClient()
+		gsb := testGenerateGameServerBuild(buildName1, "default", buildID1, 1, 2, false)
+		Expect(client.Create(context.Background(), &gsb)).To(Succeed())
+		h := NewAllocationApiServer(nil, client, allocationApiSvcPort)
+		ctx := withCallerClaims(context.Background(), &CallerClaims{TitleIDs: []string{"test-title-id"}})
+
+		// buildID2 has no GameServerBuild, the other build of the alias can still be used
+		allowed, err := h.authorizeBuilds(ctx, []string{buildID2, buildID1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(allowed).To(Equal([]string{buildID1}))
+
+		// 404 if none of the builds exists
+		_, err = h.authorizeBuilds(ctx, []string{buildID2})
+		Expect(getAllocationErrorStatusCode(err)).To(Equal(http.StatusNotFound))
+
+		// 403 if the existing builds belong to other titles
+		ctx = withCallerClaims(context.Background(), &CallerClaims{TitleIDs: []string{"title1"}})
+		_, err = h.authorizeBuilds(ctx, []string{buildID2, buildID1})
+		Expect(getAllocationErrorStatusCode(err)).To(Equal(http.StatusForbidden))
+	})
+})
@@ -126,13 +126,104 @@ func main() {
 		}
 	}
 
+	// initialize the token authenticator for the allocation API service, if token authentication is enabled
+	var tokenAuthenticator *controllers.TokenAuthenticator
+	if cfg.ApiServiceSecurity == "usetoken" {
+		// federated allocations are authenticated with the client certificates of the peer clusters
+		if len(cfg.FederationPeers) > 0 {
+			setupLog.Error(errors.New("federation requires mTLS"), "federation cannot be enabled when API_SERVICE_SECURITY is usetoken")
+			os.Exit(1)
+		}
+		tokenAuthenticator = controllers.NewTokenAuthenticator(k8sClient, cfg.AuthApiKeysSecretNamespace, cfg.AuthApiKeysSecretName, cfg.AuthJwksFile, cfg.AuthJwtIssuer, cfg.AuthJwtAudience)
+		// load the initial API keys and JWKS to fail fast if they are missing or invalid
+		if err := tokenAuthenticator.Load(context.Background()); err != nil {
+			setupLog.Error(err, "unable to load API keys or JWKS for allocation API")
+			os.Exit(1)
+		}
+		// add the token authenticator as a runnable so it reloads the API keys and JWKS alongside the manager
+		if err := mgr.Add(tokenAuthenticator); err != nil {
+			setupLog.Error(err, "unable to add token authenticator to manager")
+			os.Exit(1)
+		}
+	}
+
+	// initialize the sink of the GameServer lifecycle events, if endpoints are configured
+	var eventSink *controllers.EventSink
+	if len(cfg.LifecycleEventEndpoints) > 0 {
+		eventSink, err = controllers.NewEventSink(cfg.LifecycleEventEndpoints, cfg.LifecycleEventSource, cfg.LifecycleEventBufferSize, cfg.LifecycleEventBatchSize, time.Duration(cfg.LifecycleEventFlushIntervalMs)*time.Millisecond, cfg.LifecycleEventMaxRetries)
+		if err != nil {
+			setupLog.Error(err, "unable to initialize lifecycle event sink")
+			os.Exit(1)
+		}
+		if err := mgr.Add(eventSink); err != nil {
+			setupLog.Error(err, "unable to add lifecycle event sink to manager")
+			os.Exit(1)
+		}
+	}
+
 	// initialize the allocation API service, which is also a controller. So we add it to the manager
 	aas := controllers.NewAllocationApiServer(certWatcher, mgr.GetClient(), int32(allocationApiSvcPort))
+	if tokenAuthenticator != nil {
+		aas.SetTokenAuthenticator(tokenAuthenticator)
+	}
+	if eventSink != nil {
+		aas.SetEventSink(eventSink)
+	}
+	// enable the allocation rate limits and title quotas, if any of them is configured
+	if cfg.RateLimitPerCallerQPS > 0 || cfg.RateLimitPerBuildQPS > 0 || len(cfg.TitleActiveSessionsLimits) > 0 {
+		rl, err := controllers.NewAllocationRateLimiter(cfg.RateLimitPerCallerQPS, cfg.RateLimitPerCallerBurst, cfg.RateLimitPerBuildQPS, cfg.RateLimitPerBuildBurst, cfg.TitleActiveSessionsLimits)
+		if err != nil {
+			setupLog.Error(err, "unable to initialize allocation rate limits")
+			os.Exit(1)
+		}
+		aas.SetRateLimiter(rl)
+	}
+	// skip StandingBy GameServers that have stopped heartbeating, if enabled
+	if cfg.AllocationHeartbeatStalenessMs > 0 {
+		lc := controllers.NewHeartbeatLivenessChecker(mgr.GetClient(), time.Duration(cfg.AllocationHeartbeatStalenessMs)*time.Millisecond)
+		if err := lc.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "HeartbeatLivenessChecker")
+			os.Exit(1)
+		}
+		aas.SetLivenessChecker(lc)
+	}
+	// record every allocation attempt, if the audit log is enabled
+	if cfg.AllocationAuditSink != "" {
+		as, err := controllers.NewAuditSink(cfg.AllocationAuditSink, cfg.AllocationAuditFile, cfg.AllocationAuditMaxFileSizeMB, cfg.AllocationAuditMaxFiles, cfg.AllocationAuditMaxRecords)
+		if err != nil {
+			setupLog.Error(err, "unable to initialize allocation audit log")
+			os.Exit(1)
+		}
+		aas.SetAuditSink(as)
+	}
+	// enable federated allocations, if peer clusters are configured
+	if len(cfg.FederationPeers) > 0 {
+		fa, err := controllers.NewFederationAllocator(cfg.FederationLocalRegion, cfg.FederationPeers, certWatcher, time.Duration(cfg.FederationRequestTimeoutMs)*time.Millisecond)
+		if err != nil {
+			setupLog.Error(err, "unable to initialize federation")
+			os.Exit(1)
+		}
+		aas.SetFederationAllocator(fa)
+	}
 	if err = aas.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create HTTP allocation API Server", "Allocation API Server", "HTTP Allocation API Server")
 		os.Exit(1)
 	}
 
+	// initialize the gRPC allocation API service, if enabled. It shares the queue of the HTTP allocation API service
+	if cfg.GrpcAllocationApiSvcPort > 0 {
+		if err := mgr.Add(controllers.NewAllocationGrpcServer(aas, certWatcher, cfg.GrpcAllocationApiSvcPort)); err != nil {
+			setupLog.Error(err, "unable to create gRPC allocation API Server", "Allocation API Server", "gRPC Allocation API Server")
+			os.Exit(1)
+		}
+	}
+
+	// initialize the GameServerAllocation controller, it allocates through the queue of the HTTP allocation API service
+	if err = controllers.NewGameServerAllocationReconciler(mgr, aas).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "GameServerAllocation")
+		os.Exit(1)
+	}
+
 	// initialize the portRegistry
 	portRegistry, err := initializePortRegistry(k8sClient, mgr.GetClient(), setupLog, cfg)
 	if err != nil {
@@ -146,13 +237,17 @@ func main() {
 	}
 
 	// initialize the GameServer controller
-	if err = controllers.NewGameServerReconciler(mgr, portRegistry, controllers.GetNodeDetails, cfg.InitContainerImageLinux, cfg.InitContainerImageWin).SetupWithManager(mgr); err != nil {
+	gsr := controllers.NewGameServerReconciler(mgr, portRegistry, controllers.GetNodeDetails, cfg.InitContainerImageLinux, cfg.InitContainerImageWin, time.Duration(cfg.TerminationGracePeriodSeconds)*time.Second)
+	gsr.EventSink = eventSink
+	if err = gsr.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "GameServer")
 		os.Exit(1)
 	}
 
 	// initialize the GameServerBuild controller
-	if err = controllers.NewGameServerBuildReconciler(mgr, portRegistry, cfg).SetupWithManager(mgr); err != nil {
+	gsbr := controllers.NewGameServerBuildReconciler(mgr, portRegistry, cfg)
+	gsbr.EventSink = eventSink
+	if err = gsbr.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "GameServerBuild")
 		os.Exit(1)
 	}